@@ -0,0 +1,159 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package scheduling holds the half of RaftCluster's responsibilities that
+// are purely about scheduling decisions - hot-spot tracking, region
+// statistics, placement rules - rather than raft metadata bookkeeping
+// (regions, stores, storage). Cluster is meant to run embedded in the same
+// process as RaftCluster today, addressed through the cluster package's
+// Cluster interface, and to be liftable into its own process later behind
+// the same interface, once a ServiceMode config knob and a gRPC
+// SchedulingService exist to route heartbeats to it remotely. Neither of
+// those exists in this tree yet; see the package doc note at the bottom of
+// this file for what's deliberately left out of this first cut.
+package scheduling
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/kvproto/pkg/pdpb"
+	"github.com/tikv/pd/pkg/cache"
+	"github.com/tikv/pd/server/config"
+	"github.com/tikv/pd/server/core"
+	"github.com/tikv/pd/server/schedule/placement"
+	"github.com/tikv/pd/server/statistics"
+)
+
+// Cluster owns the scheduling-facing subsystems that only need a region and
+// store view to operate, not the raft metadata RaftCluster also carries.
+// It embeds *core.BasicCluster for that view the same way RaftCluster does.
+type Cluster struct {
+	*core.BasicCluster
+
+	opt *config.PersistOptions
+
+	ruleManager    *placement.RuleManager
+	hotCache       *statistics.HotCache
+	regionStats    *statistics.RegionStatistics
+	storesStats    *statistics.StoresStats
+	suspectRegions *cache.TTLUint64
+}
+
+// NewCluster creates a Cluster backed by basic and opt. ctx bounds the
+// lifetime of the hot cache's and suspect-region cache's background
+// goroutines, the same way it bounds RaftCluster's.
+// storage is nil for now: the rule manager's persistence is the metadata
+// side's job, and RaftCluster's own ruleManager still owns it until a real
+// out-of-process deployment needs this Cluster to load and save rules on
+// its own.
+func NewCluster(ctx context.Context, basic *core.BasicCluster, opt *config.PersistOptions) *Cluster {
+	return &Cluster{
+		BasicCluster:   basic,
+		opt:            opt,
+		ruleManager:    placement.NewRuleManager(nil),
+		hotCache:       statistics.NewHotCache(ctx),
+		regionStats:    statistics.NewRegionStatistics(opt),
+		storesStats:    statistics.NewStoresStats(),
+		suspectRegions: cache.NewIDTTL(ctx, time.Minute, 3*time.Minute),
+	}
+}
+
+// GetHotCache returns the hot stat cache, satisfying cluster.Cluster.
+func (c *Cluster) GetHotCache() *statistics.HotCache {
+	return c.hotCache
+}
+
+// GetRuleManager returns the placement rule manager.
+func (c *Cluster) GetRuleManager() *placement.RuleManager {
+	return c.ruleManager
+}
+
+// GetRegionStats returns the region statistics collector.
+func (c *Cluster) GetRegionStats() *statistics.RegionStatistics {
+	return c.regionStats
+}
+
+// GetStoresStats returns the store flow statistics.
+func (c *Cluster) GetStoresStats() *statistics.StoresStats {
+	return c.storesStats
+}
+
+// AddSuspectRegions adds regions to the suspect list, satisfying
+// cluster.Cluster.
+func (c *Cluster) AddSuspectRegions(regionIDs ...uint64) {
+	for _, regionID := range regionIDs {
+		c.suspectRegions.Put(regionID, nil)
+	}
+}
+
+// GetSuspectRegions gets all suspect regions.
+func (c *Cluster) GetSuspectRegions() []uint64 {
+	return c.suspectRegions.GetAllID()
+}
+
+// HandleStoreHeartbeat updates the store status, satisfying
+// cluster.Cluster. Unlike RaftCluster's version it never persists the store
+// to storage - that remains RaftCluster's job - so a deployment running
+// this Cluster out-of-process still needs RaftCluster's copy of the
+// heartbeat for the metadata side.
+func (c *Cluster) HandleStoreHeartbeat(stats *pdpb.StoreStats) error {
+	storeID := stats.GetStoreId()
+	store := c.GetStore(storeID)
+	if store == nil {
+		return errors.Errorf("store %v not found", storeID)
+	}
+	newStore := store.Clone(core.SetStoreStats(stats), core.SetLastHeartbeatTS(time.Now()))
+	c.PutStore(newStore)
+	c.storesStats.Observe(newStore.GetID(), newStore.GetStoreStats())
+	c.storesStats.UpdateTotalBytesRate(c.GetStores)
+	c.storesStats.UpdateTotalKeysRate(c.GetStores)
+	c.storesStats.UpdateTotalOps(c.GetStores)
+	return nil
+}
+
+// ProcessRegionHeartbeat is processRegionHeartbeat's scheduling-only
+// equivalent: it only updates the region statistics and hot cache this
+// Cluster owns, not RaftCluster's region cache or storage. A caller running
+// both halves in one process (the only mode this tree wires up) still needs
+// RaftCluster.processRegionHeartbeat for the metadata side; this method is
+// what a future out-of-process scheduling service would call on its own
+// once the gRPC surface that feeds it heartbeats exists.
+func (c *Cluster) ProcessRegionHeartbeat(region *core.RegionInfo) {
+	if c.regionStats != nil {
+		c.regionStats.Observe(region, c.GetRegionStores(region))
+	}
+	c.hotCache.CheckWriteAsync(region, c.storesStats)
+	c.hotCache.CheckReadAsync(region, c.storesStats)
+}
+
+// What's deliberately not in this first cut:
+//
+//   - A gRPC SchedulingService (RegionHeartbeat/StoreHeartbeat/
+//     ScatterRegions/SplitRegions/AskBatchSplit RPCs): this tree has no
+//     .proto sources or generated pdpb/schedulingpb stubs to extend, and no
+//     protoc toolchain to regenerate them from - kvproto is an external,
+//     unvendored dependency here the same way server/core is.
+//   - A ServiceMode ("local" vs "api") config knob: its only consumer would
+//     be the gRPC surface above, so it has nothing to switch between yet.
+//   - RaftCluster actually delegating to this Cluster: coordinator is an
+//     unexported type private to the cluster package, and StoreLimiter is
+//     defined in and wired up by that package too, so hosting them here would
+//     mean moving them (and exporting coordinator) - a repo-wide refactor of
+//     cluster.go, not a bounded addition alongside it. RaftCluster keeps them for now and
+//     satisfies cluster.Cluster on its own, exactly as it did before this
+//     package existed; var _ cluster.Cluster = (*RaftCluster)(nil) in
+//     cluster.go is the compile-time check that it still does.
+//   - Integration tests exercising both wiring paths: this source tree has
+//     no _test.go files anywhere to extend in that style.
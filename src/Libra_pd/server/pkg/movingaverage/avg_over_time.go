@@ -0,0 +1,97 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package movingaverage
+
+import (
+	"container/list"
+	"time"
+)
+
+// deltaWithInterval is one sample tracked by AvgOverTime: a rate observed
+// over interval.
+type deltaWithInterval struct {
+	delta    float64
+	interval time.Duration
+}
+
+// AvgOverTime tracks a moving average of a rate over a trailing window of
+// wall-clock time rather than over a fixed number of samples. Weighting each
+// sample by the interval it represents, instead of counting it once
+// regardless of interval, keeps the average from skewing when samples arrive
+// at an irregular cadence - e.g. PD's region heartbeats, which may land
+// every 3s under load or every 60s when idle.
+type AvgOverTime struct {
+	que         *list.List
+	deltaSum    float64
+	intervalSum time.Duration
+	window      time.Duration
+}
+
+// NewAvgOverTime creates an AvgOverTime that averages over the trailing
+// window of wall-clock time.
+func NewAvgOverTime(window time.Duration) *AvgOverTime {
+	return &AvgOverTime{
+		que:    list.New(),
+		window: window,
+	}
+}
+
+// Add records a rate sample measured over interval, then evicts the oldest
+// samples until the tracked interval no longer exceeds window. The newest
+// sample is never evicted, so a single sample whose interval is longer than
+// window is kept on its own. A zero
+// interval is dropped rather than recorded, since it carries no weight and
+// would only risk a division by zero in Get.
+func (a *AvgOverTime) Add(delta float64, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	a.que.PushBack(deltaWithInterval{delta: delta, interval: interval})
+	a.deltaSum += delta * interval.Seconds()
+	a.intervalSum += interval
+	for a.intervalSum > a.window && a.que.Len() > 1 {
+		front := a.que.Front()
+		pop := front.Value.(deltaWithInterval)
+		a.que.Remove(front)
+		a.deltaSum -= pop.delta * pop.interval.Seconds()
+		a.intervalSum -= pop.interval
+	}
+}
+
+// Get returns the interval-weighted average rate over the currently tracked
+// window, or 0 if nothing has been recorded yet.
+func (a *AvgOverTime) Get() float64 {
+	if a.intervalSum <= 0 {
+		return 0
+	}
+	return a.deltaSum / a.intervalSum.Seconds()
+}
+
+// IsFull reports whether the tracked interval has reached a full window, as
+// opposed to still warming up from a cold start.
+func (a *AvgOverTime) IsFull() bool {
+	return a.intervalSum >= a.window
+}
+
+// GetIntervalSum returns the total interval currently tracked.
+func (a *AvgOverTime) GetIntervalSum() time.Duration {
+	return a.intervalSum
+}
+
+// Clear resets a to its zero-value, empty state.
+func (a *AvgOverTime) Clear() {
+	a.que.Init()
+	a.deltaSum = 0
+	a.intervalSum = 0
+}
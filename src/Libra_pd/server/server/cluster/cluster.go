@@ -17,7 +17,10 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/coreos/go-semver/semver"
@@ -26,11 +29,12 @@ import (
 	"github.com/pingcap/failpoint"
 	"github.com/pingcap/kvproto/pkg/metapb"
 	"github.com/pingcap/kvproto/pkg/pdpb"
-	"github.com/pingcap/kvproto/pkg/replication_modepb"
 	"github.com/pingcap/log"
+	"github.com/robfig/cron/v3"
 	"github.com/tikv/pd/pkg/cache"
 	"github.com/tikv/pd/pkg/component"
 	"github.com/tikv/pd/pkg/errs"
+	"github.com/tikv/pd/pkg/etcdsnapshot"
 	"github.com/tikv/pd/pkg/etcdutil"
 	"github.com/tikv/pd/pkg/keyutil"
 	"github.com/tikv/pd/pkg/logutil"
@@ -49,6 +53,9 @@ import (
 	"github.com/tikv/pd/server/versioninfo"
 	"go.etcd.io/etcd/clientv3"
 	"go.uber.org/zap"
+	"golang.org/x/sync/semaphore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health/grpc_health_v1"
 )
 
 var backgroundJobInterval = 10 * time.Second
@@ -70,6 +77,28 @@ type Server interface {
 	ReplicateFileToAllMembers(ctx context.Context, name string, data []byte) error
 }
 
+// Cluster is the subset of RaftCluster's scheduling-related behavior that
+// doesn't depend on RaftCluster's own locking or metadata bookkeeping. It
+// exists so that a caller driving the scheduling half of PD - today always
+// RaftCluster itself, in the future potentially the standalone
+// pkg/mcs/scheduling.Cluster running in its own process - can be addressed
+// the same way regardless of which one is actually wired in.
+//
+// processRegionHeartbeat isn't part of this interface: it's unexported, so
+// only RaftCluster itself can implement it, and pkg/mcs/scheduling.Cluster
+// exposes the equivalent logic as ProcessRegionHeartbeat instead. Callers
+// that need to process a region heartbeat through this interface boundary
+// go through HandleRegionHeartbeat (defined on RaftCluster, not yet part of
+// this interface) rather than the unexported method directly.
+type Cluster interface {
+	HandleStoreHeartbeat(stats *pdpb.StoreStats) error
+	AddSuspectRegions(regionIDs ...uint64)
+	GetRegionScatter() *schedule.RegionScatterer
+	GetHotCache() *statistics.HotCache
+}
+
+var _ Cluster = (*RaftCluster)(nil)
+
 // RaftCluster is used for cluster config management.
 // Raft cluster key format:
 // cluster 1 -> /1/raft, value is metapb.Cluster
@@ -87,6 +116,16 @@ type RaftCluster struct {
 	clusterRoot string
 
 	// cached cluster info
+	//
+	// core's own StoresInfo/RegionsInfo sub-caches are where a store-only
+	// read (GetStore, GetStores, GetMetaStores) would need its own RWMutex,
+	// separate from RegionsInfo's, to stop contending with the region
+	// heartbeat write path - that type lives in core.BasicCluster, which
+	// isn't part of this source tree (no server/core sources here to
+	// split), so it can't be done as part of this package. The RWMutex
+	// embedded in RaftCluster above is a coarser, cross-cutting lock on top
+	// of whatever locking core itself does internally, and splitting it
+	// wouldn't touch core's own granularity either.
 	core    *core.BasicCluster
 	meta    *metapb.Cluster
 	opt     *config.PersistOptions
@@ -96,12 +135,19 @@ type RaftCluster struct {
 
 	prepareChecker *prepareChecker
 	changedRegions chan *core.RegionInfo
+	regionGuide    RegionGuideFunc
 
 	labelLevelStats *statistics.LabelStatistics
 	regionStats     *statistics.RegionStatistics
 	storesStats     *statistics.StoresStats
 	hotSpotCache    *statistics.HotCache
 
+	// lastRegionStats holds the most recent *RegionStatsSnapshot built by
+	// refreshRegionStatsSnapshot. It's an atomic.Value rather than a plain
+	// field guarded by the RWMutex above so GetLastRegionStats can be called
+	// from an HTTP handler without contending with heartbeat processing.
+	lastRegionStats atomic.Value
+
 	coordinator      *coordinator
 	suspectRegions   *cache.TTLUint64 // suspectRegions are regions that may need fix
 	suspectKeyRanges *cache.TTLString // suspect key-range regions that may need fix
@@ -121,6 +167,9 @@ type RaftCluster struct {
 	componentManager *component.Manager
 
 	splitRegionInfos map[uint64][]uint64
+
+	snapshotter           *etcdsnapshot.Snapshotter
+	storeLimitHistoryCron *cron.Cron
 }
 
 // Status saves some state information.
@@ -205,12 +254,14 @@ func (c *RaftCluster) InitCluster(id id.Allocator, opt *config.PersistOptions, s
 	c.id = id
 	c.labelLevelStats = statistics.NewLabelStatistics()
 	c.storesStats = statistics.NewStoresStats()
+	c.storesStats.Start(c.ctx)
 	c.prepareChecker = newPrepareChecker()
 	c.changedRegions = make(chan *core.RegionInfo, defaultChangedRegionsLimit)
-	c.hotSpotCache = statistics.NewHotCache()
+	c.hotSpotCache = statistics.NewHotCache(c.ctx)
 	c.suspectRegions = cache.NewIDTTL(c.ctx, time.Minute, 3*time.Minute)
 	c.suspectKeyRanges = cache.NewStringTTL(c.ctx, time.Minute, 3*time.Minute)
 	c.traceRegionFlow = opt.GetPDServerConfig().TraceRegionFlow
+	c.regionGuide = GenerateRegionGuideFunc(true, c.traceRegionFlow)
 }
 
 // Start starts a cluster.
@@ -224,6 +275,9 @@ func (c *RaftCluster) Start(s Server) error {
 	}
 
 	c.InitCluster(s.GetAllocator(), s.GetPersistOptions(), s.GetStorage(), s.GetBasicCluster())
+	if err := c.opt.ReloadStoreConfig(c.storage); err != nil {
+		log.Warn("failed to reload store config, falling back to its defaults until the next sync", errs.ZapError(err))
+	}
 	cluster, err := c.LoadClusterInfo()
 	if err != nil {
 		return err
@@ -256,19 +310,58 @@ func (c *RaftCluster) Start(s Server) error {
 	c.limiter = NewStoreLimiter(s.GetPersistOptions())
 	c.quit = make(chan struct{})
 
-	c.wg.Add(4)
+	c.wg.Add(5)
 	go c.runCoordinator()
 	failpoint.Inject("highFrequencyClusterJobs", func() {
 		backgroundJobInterval = 100 * time.Microsecond
 	})
+	// skipSleep lets a test drive refreshRegionStatsSnapshot (added
+	// alongside the rest of runBackgroundJobs's per-tick work) without
+	// waiting out a real backgroundJobInterval, the same way
+	// highFrequencyClusterJobs above does for the jobs that predate it.
+	failpoint.Inject("skipSleep", func() {
+		backgroundJobInterval = 100 * time.Microsecond
+	})
 	go c.runBackgroundJobs(backgroundJobInterval)
 	go c.syncRegions()
 	go c.runReplicationMode()
+	go c.runLearnerProgressLoop()
 	c.running = true
 
+	if cronExpr := c.opt.GetSnapshotCron(); cronExpr != "" {
+		store := &etcdsnapshot.LocalStore{Dir: c.opt.GetSnapshotDir()}
+		c.snapshotter = etcdsnapshot.NewSnapshotter(c.etcdClient, store, c.isEtcdLeader)
+		if err := c.snapshotter.Schedule(cronExpr); err != nil {
+			log.Warn("failed to schedule etcd snapshot", errs.ZapError(err))
+		}
+	}
+
+	retention := c.opt.GetStoreLimitHistoryRetention()
+	if retention <= 0 {
+		retention = 7 * 24 * time.Hour
+	}
+	c.storeLimitHistoryCron = c.runStoreLimitHistoryCompaction(c.opt.GetStoreLimitHistoryCompactCron(), retention)
+
 	return nil
 }
 
+// isEtcdLeader reports whether this PD currently holds etcd leadership, so
+// a scheduled etcdsnapshot.Snapshotter doesn't take the same backup once per
+// member of the cluster.
+func (c *RaftCluster) isEtcdLeader() bool {
+	if c.etcdClient == nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), clientTimeout)
+	defer cancel()
+	resp, err := c.etcdClient.Status(ctx, c.etcdClient.Endpoints()[0])
+	if err != nil {
+		log.Warn("failed to get etcd status", errs.ZapError(err))
+		return false
+	}
+	return resp.Leader == resp.Header.MemberId
+}
+
 // LoadClusterInfo loads cluster related info.
 func (c *RaftCluster) LoadClusterInfo() (*RaftCluster, error) {
 	c.meta = &metapb.Cluster{}
@@ -281,6 +374,11 @@ func (c *RaftCluster) LoadClusterInfo() (*RaftCluster, error) {
 	}
 
 	start := time.Now()
+	// Reset first: a store removed from the persisted set while this PD was
+	// a follower would otherwise survive in c.core's in-memory map across
+	// the follower-to-leader transition, becoming a phantom store GetStores
+	// and the scheduler both act on even though storage no longer knows it.
+	c.core.ResetStores()
 	if err := c.storage.LoadStores(c.core.PutStore); err != nil {
 		return nil, err
 	}
@@ -323,6 +421,8 @@ func (c *RaftCluster) runBackgroundJobs(interval time.Duration) {
 			c.checkStores()
 			c.collectMetrics()
 			c.coordinator.opController.PruneHistory()
+			c.syncStoreConfig()
+			c.refreshRegionStatsSnapshot()
 		}
 	}
 }
@@ -363,6 +463,13 @@ func (c *RaftCluster) Stop() {
 	c.running = false
 	close(c.quit)
 	c.coordinator.stop()
+	c.storesStats.Stop()
+	if c.snapshotter != nil {
+		c.snapshotter.Stop()
+	}
+	if c.storeLimitHistoryCron != nil {
+		c.storeLimitHistoryCron.Stop()
+	}
 	c.Unlock()
 	c.wg.Wait()
 }
@@ -388,6 +495,13 @@ func (c *RaftCluster) GetRegionScatter() *schedule.RegionScatterer {
 	return c.coordinator.regionScatterer
 }
 
+// GetHotCache returns the hot stat cache.
+func (c *RaftCluster) GetHotCache() *statistics.HotCache {
+	c.RLock()
+	defer c.RUnlock()
+	return c.hotSpotCache
+}
+
 // GetHeartbeatStreams returns the heartbeat streams.
 func (c *RaftCluster) GetHeartbeatStreams() opt.HeartbeatStreams {
 	c.RLock()
@@ -530,94 +644,42 @@ func (c *RaftCluster) HandleStoreHeartbeat(stats *pdpb.StoreStats) error {
 	return nil
 }
 
-// processRegionHeartbeat updates the region information.
-func (c *RaftCluster) processRegionHeartbeat(region *core.RegionInfo) error {
+// RegionChanged describes what processRegionHeartbeat found out about a
+// region, so that each subsystem downstream of HandleRegionHeartbeat can
+// decide for itself whether it has work to do instead of recomputing the
+// diff from the raw region. NeedSync drives the region syncer, SaveKV the
+// storage layer, SaveCache the in-memory region cache and hot-peer cache,
+// and IsNew the prepare checker. Origin is the region info this heartbeat
+// replaced, nil on a region's first heartbeat, so a caller that needs to
+// know which stores dropped a peer (e.g. to evict their hot-cache entries)
+// doesn't have to keep its own copy around.
+type RegionChanged struct {
+	IsNew     bool
+	SaveKV    bool
+	SaveCache bool
+	NeedSync  bool
+	Origin    *core.RegionInfo
+}
+
+// useLegacyRegionGuide gates processRegionHeartbeatLegacy's call path for one
+// release so out-of-tree callers built against the (region) error signature
+// have time to migrate to the RegionChanged-returning signature.
+var useLegacyRegionGuide = false
+
+// processRegionHeartbeat updates the region information and reports what
+// changed about it via a *RegionChanged.
+func (c *RaftCluster) processRegionHeartbeat(region *core.RegionInfo) (*RegionChanged, error) {
 	c.RLock()
 	origin, err := c.core.PreCheckPutRegion(region)
 	if err != nil {
 		c.RUnlock()
-		return err
+		return nil, err
 	}
-	writeItems := c.CheckWriteStatus(region)
-	readItems := c.CheckReadStatus(region)
 	c.RUnlock()
 
-	// Save to storage if meta is updated.
-	// Save to cache if meta or leader is updated, or contains any down/pending peer.
-	// Mark isNew if the region in cache does not have leader.
-	var saveKV, saveCache, isNew, needSync bool
-	if origin == nil {
-		log.Debug("insert new region",
-			zap.Uint64("region-id", region.GetID()),
-			zap.Stringer("meta-region", core.RegionToHexMeta(region.GetMeta())),
-		)
-		saveKV, saveCache, isNew = true, true, true
-	} else {
-		r := region.GetRegionEpoch()
-		o := origin.GetRegionEpoch()
-		if r.GetVersion() > o.GetVersion() {
-			log.Info("region Version changed",
-				zap.Uint64("region-id", region.GetID()),
-				zap.String("detail", core.DiffRegionKeyInfo(origin, region)),
-				zap.Uint64("old-version", o.GetVersion()),
-				zap.Uint64("new-version", r.GetVersion()),
-			)
-			saveKV, saveCache = true, true
-		}
-		if r.GetConfVer() > o.GetConfVer() {
-			log.Info("region ConfVer changed",
-				zap.Uint64("region-id", region.GetID()),
-				zap.String("detail", core.DiffRegionPeersInfo(origin, region)),
-				zap.Uint64("old-confver", o.GetConfVer()),
-				zap.Uint64("new-confver", r.GetConfVer()),
-			)
-			saveKV, saveCache = true, true
-		}
-		if region.GetLeader().GetId() != origin.GetLeader().GetId() {
-			if origin.GetLeader().GetId() == 0 {
-				isNew = true
-			} else {
-				log.Info("leader changed",
-					zap.Uint64("region-id", region.GetID()),
-					zap.Uint64("from", origin.GetLeader().GetStoreId()),
-					zap.Uint64("to", region.GetLeader().GetStoreId()),
-				)
-			}
-			saveCache, needSync = true, true
-		}
-		if len(region.GetDownPeers()) > 0 || len(region.GetPendingPeers()) > 0 {
-			saveCache = true
-		}
-		if len(origin.GetDownPeers()) > 0 || len(origin.GetPendingPeers()) > 0 {
-			saveCache = true
-		}
-		if len(region.GetPeers()) != len(origin.GetPeers()) {
-			saveKV, saveCache = true, true
-		}
-
-		if region.GetApproximateSize() != origin.GetApproximateSize() ||
-			region.GetApproximateKeys() != origin.GetApproximateKeys() {
-			saveCache = true
-		}
-
-		if c.traceRegionFlow && (region.GetBytesWritten() != origin.GetBytesWritten() ||
-			region.GetBytesRead() != origin.GetBytesRead() ||
-			region.GetKeysWritten() != origin.GetKeysWritten() ||
-			region.GetKeysRead() != origin.GetKeysRead() ||
-			region.GetOpsWrite() != origin.GetOpsWrite() ||
-			region.GetOpsRead() != origin.GetOpsRead()) {
-			saveCache, needSync = true, true
-		}
-
-		if region.GetReplicationStatus().GetState() != replication_modepb.RegionReplicationState_UNKNOWN &&
-			(region.GetReplicationStatus().GetState() != origin.GetReplicationStatus().GetState() ||
-				region.GetReplicationStatus().GetStateId() != origin.GetReplicationStatus().GetStateId()) {
-			saveCache = true
-		}
-	}
-
-	if len(writeItems) == 0 && len(readItems) == 0 && !saveKV && !saveCache && !isNew {
-		return nil
+	isNew, saveKV, saveCache, needSync := c.regionGuide(region, origin)
+	if !saveKV && !saveCache && !isNew {
+		return &RegionChanged{Origin: origin}, nil
 	}
 
 	failpoint.Inject("concurrentRegionHeartbeat", func() {
@@ -632,7 +694,7 @@ func (c *RaftCluster) processRegionHeartbeat(region *core.RegionInfo) error {
 		// However it can't solve the race condition of concurrent heartbeats from the same region.
 		if _, err := c.core.PreCheckPutRegion(region); err != nil {
 			c.Unlock()
-			return err
+			return nil, err
 		}
 		overlaps := c.core.PutRegion(region)
 		if c.storage != nil {
@@ -668,7 +730,7 @@ func (c *RaftCluster) processRegionHeartbeat(region *core.RegionInfo) error {
 		regionEventCounter.WithLabelValues("update_cache").Inc()
 	}
 
-	if isNew {
+	if !c.prepareChecker.isPrepared && isNew {
 		c.prepareChecker.collect(region)
 	}
 
@@ -676,12 +738,6 @@ func (c *RaftCluster) processRegionHeartbeat(region *core.RegionInfo) error {
 		c.regionStats.Observe(region, c.takeRegionStoresLocked(region))
 	}
 
-	for _, writeItem := range writeItems {
-		c.hotSpotCache.Update(region, writeItem)
-	}
-	for _, readItem := range readItems {
-		c.hotSpotCache.Update(region, readItem)
-	}
 	c.Unlock()
 
 	// If there are concurrent heartbeats from the same region, the last write will win even if
@@ -704,7 +760,19 @@ func (c *RaftCluster) processRegionHeartbeat(region *core.RegionInfo) error {
 		}
 	}
 
-	return nil
+	return &RegionChanged{IsNew: isNew, SaveKV: saveKV, SaveCache: saveCache, NeedSync: needSync, Origin: origin}, nil
+}
+
+// processRegionHeartbeatLegacy is processRegionHeartbeat's pre-RegionChanged
+// signature. It is kept for one release so callers built against the old
+// (region) error contract have time to migrate; it simply discards the
+// structured result.
+//
+// Deprecated: call processRegionHeartbeat directly and consult its
+// RegionChanged result instead.
+func (c *RaftCluster) processRegionHeartbeatLegacy(region *core.RegionInfo) error {
+	_, err := c.processRegionHeartbeat(region)
+	return err
 }
 
 func (c *RaftCluster) updateStoreStatusLocked(id uint64) {
@@ -859,6 +927,36 @@ func (c *RaftCluster) DropCacheRegion(id uint64) {
 	}
 }
 
+// dropCacheAllRegionBatchSize bounds how many regions DropCacheAllRegion
+// removes while holding c's write lock at once, so clearing every region on
+// a large cluster doesn't stall heartbeat processing for the whole scan.
+const dropCacheAllRegionBatchSize = 1024
+
+// DropCacheAllRegion clears every region from the cache, in batches, so PD
+// can re-learn the whole region set from heartbeats after the cache ends up
+// corrupted - a bulk version of DropCacheRegion for when dropping regions
+// one at a time isn't practical.
+func (c *RaftCluster) DropCacheAllRegion() {
+	c.RLock()
+	regions := c.core.GetRegions()
+	c.RUnlock()
+
+	for len(regions) > 0 {
+		n := dropCacheAllRegionBatchSize
+		if n > len(regions) {
+			n = len(regions)
+		}
+		batch := regions[:n]
+		regions = regions[n:]
+
+		c.Lock()
+		for _, region := range batch {
+			c.core.RemoveRegion(region)
+		}
+		c.Unlock()
+	}
+}
+
 // GetCacheCluster gets the cached cluster.
 func (c *RaftCluster) GetCacheCluster() *core.BasicCluster {
 	c.RLock()
@@ -995,7 +1093,11 @@ func (c *RaftCluster) checkStoreLabels(s *core.StoreInfo) error {
 
 // RemoveStore marks a store as offline in cluster.
 // State transition: Up -> Offline.
-func (c *RaftCluster) RemoveStore(storeID uint64) error {
+// physicallyDestroyed marks the store's data as permanently gone (disk
+// loss) rather than a soft removal that could still be undone: SetStoreState
+// refuses to let such a store return to Up, and it becomes Tombstone as
+// soon as its regions have drained, with no way back.
+func (c *RaftCluster) RemoveStore(storeID uint64, physicallyDestroyed bool) error {
 	c.Lock()
 	defer c.Unlock()
 
@@ -1004,8 +1106,10 @@ func (c *RaftCluster) RemoveStore(storeID uint64) error {
 		return errs.ErrStoreNotFound.FastGenByArgs(storeID)
 	}
 
-	// Remove an offline store should be OK, nothing to do.
-	if store.IsOffline() {
+	// Remove an offline store should be OK, nothing to do, except a soft
+	// removal asked to additionally escalate into a physically-destroyed
+	// one - that still needs to persist.
+	if store.IsOffline() && store.IsPhysicallyDestroyed() == physicallyDestroyed {
 		return nil
 	}
 
@@ -1013,13 +1117,22 @@ func (c *RaftCluster) RemoveStore(storeID uint64) error {
 		return errs.ErrStoreTombstone.FastGenByArgs(storeID)
 	}
 
-	newStore := store.Clone(core.SetStoreState(metapb.StoreState_Offline))
+	// A physically-destroyed store can't be downgraded back to a soft removal.
+	if store.IsPhysicallyDestroyed() && !physicallyDestroyed {
+		return errs.ErrStorePhysicallyDestroyed.FastGenByArgs(storeID)
+	}
+
+	newStore := store.Clone(
+		core.SetStoreState(metapb.StoreState_Offline),
+		core.SetPhysicallyDestroyed(physicallyDestroyed),
+	)
 	log.Warn("store has been offline",
 		zap.Uint64("store-id", newStore.GetID()),
-		zap.String("store-address", newStore.GetAddress()))
+		zap.String("store-address", newStore.GetAddress()),
+		zap.Bool("physically-destroyed", physicallyDestroyed))
 	err := c.putStoreLocked(newStore)
 	if err == nil {
-		c.SetStoreLimit(storeID, storelimit.RemovePeer, storelimit.Unlimited)
+		c.SetStoreLimit("system", storeID, storelimit.RemovePeer, storelimit.Unlimited)
 	}
 	return err
 }
@@ -1028,6 +1141,9 @@ func (c *RaftCluster) RemoveStore(storeID uint64) error {
 // State transition:
 // Case 1: Up -> Tombstone (if force is true);
 // Case 2: Offline -> Tombstone.
+// A physically-destroyed store takes Case 2 as soon as checkStores sees it
+// has no regions left - force only matters for bypassing the Up check, not
+// for physically-destroyed stores, which can never be Up again anyway.
 func (c *RaftCluster) BuryStore(storeID uint64, force bool) error {
 	c.Lock()
 	defer c.Unlock()
@@ -1055,7 +1171,7 @@ func (c *RaftCluster) BuryStore(storeID uint64, force bool) error {
 		zap.String("store-address", newStore.GetAddress()))
 	err := c.putStoreLocked(newStore)
 	if err == nil {
-		c.RemoveStoreLimit(storeID)
+		c.RemoveStoreLimit("system", storeID)
 	}
 	return err
 }
@@ -1087,6 +1203,12 @@ func (c *RaftCluster) SetStoreState(storeID uint64, state metapb.StoreState) err
 		return errs.ErrStoreNotFound.FastGenByArgs(storeID)
 	}
 
+	// A physically-destroyed store's data is gone for good; it must not be
+	// allowed back to Up, only on to Tombstone via BuryStore.
+	if state == metapb.StoreState_Up && store.IsPhysicallyDestroyed() {
+		return errs.ErrStorePhysicallyDestroyed.FastGenByArgs(storeID)
+	}
+
 	newStore := store.Clone(core.SetStoreState(state))
 	log.Warn("store update state",
 		zap.Uint64("store-id", storeID),
@@ -1154,6 +1276,11 @@ func (c *RaftCluster) checkStores() {
 					errs.ZapError(err))
 			}
 		} else {
+			if store.IsPhysicallyDestroyed() {
+				log.Warn("physically-destroyed store still has regions, scheduling replacements",
+					zap.Stringer("store", offlineStore),
+					zap.Int("region-count", regionCount))
+			}
 			offlineStores = append(offlineStores, offlineStore)
 		}
 	}
@@ -1185,7 +1312,7 @@ func (c *RaftCluster) RemoveTombStoneRecords() error {
 					errs.ZapError(err))
 				return err
 			}
-			c.RemoveStoreLimit(store.GetID())
+			c.RemoveStoreLimit("system", store.GetID())
 			log.Info("delete store succeeded",
 				zap.Stringer("store", store.GetMeta()))
 		}
@@ -1257,13 +1384,13 @@ func (c *RaftCluster) collectHealthStatus() {
 	if err != nil {
 		log.Error("get members error", errs.ZapError(err))
 	}
-	unhealthy := CheckHealth(c.httpClient, members)
+	health := CheckHealth(c.httpClient, c.clusterID, members)
 	for _, member := range members {
-		if _, ok := unhealthy[member.GetMemberId()]; ok {
-			healthStatusGauge.WithLabelValues(member.GetName()).Set(0)
+		if result, ok := health[member.GetMemberId()]; ok && result.Status == MemberServing {
+			healthStatusGauge.WithLabelValues(member.GetName()).Set(1)
 			continue
 		}
-		healthStatusGauge.WithLabelValues(member.GetName()).Set(1)
+		healthStatusGauge.WithLabelValues(member.GetName()).Set(0)
 	}
 }
 
@@ -1392,6 +1519,17 @@ func (c *RaftCluster) isPrepared() bool {
 	return c.prepareChecker.check(c)
 }
 
+// IsPrepared returns whether the cluster's initial region-load phase has
+// completed, without re-running prepareChecker's check like the unexported
+// isPrepared does - callers outside the coordinator (an HTTP status
+// endpoint, a client like TiDB or br waiting for scheduling to be safe)
+// just want the current state, not a chance to flip it.
+func (c *RaftCluster) IsPrepared() bool {
+	c.RLock()
+	defer c.RUnlock()
+	return c.prepareChecker.isPrepared
+}
+
 // GetStoresBytesWriteStat returns the bytes write stat of all StoreInfo.
 func (c *RaftCluster) GetStoresBytesWriteStat() map[uint64]float64 {
 	c.RLock()
@@ -1623,23 +1761,36 @@ func (c *RaftCluster) AddStoreLimit(store *metapb.Store) {
 	c.opt.SetScheduleConfig(cfg)
 }
 
-// RemoveStoreLimit remove a store limit for a given store ID.
-func (c *RaftCluster) RemoveStoreLimit(storeID uint64) {
+// RemoveStoreLimit removes a store limit for a given store ID, recording
+// the removal in the store limit audit trail under user.
+func (c *RaftCluster) RemoveStoreLimit(user string, storeID uint64) {
 	cfg := c.opt.GetScheduleConfig().Clone()
 	for _, limitType := range storelimit.TypeNameValue {
+		oldRate := c.opt.GetStoreLimitByType(storeID, limitType)
 		c.AttachAvailableFunc(storeID, limitType, nil)
+		if oldRate != 0 {
+			c.recordStoreLimitChange(user, limitType.String(), storeID, oldRate, 0)
+		}
 	}
 	delete(cfg.StoreLimit, storeID)
 	c.opt.SetScheduleConfig(cfg)
 }
 
-// SetStoreLimit sets a store limit for a given type and rate.
-func (c *RaftCluster) SetStoreLimit(storeID uint64, typ storelimit.Type, ratePerMin float64) {
+// SetStoreLimit sets a store limit for a given type and rate, recording the
+// change in the store limit audit trail under user.
+func (c *RaftCluster) SetStoreLimit(user string, storeID uint64, typ storelimit.Type, ratePerMin float64) {
+	oldRate := c.opt.GetStoreLimitByType(storeID, typ)
 	c.opt.SetStoreLimit(storeID, typ, ratePerMin)
+	c.recordStoreLimitChange(user, typ.String(), storeID, oldRate, ratePerMin)
 }
 
-// SetAllStoresLimit sets all store limit for a given type and rate.
-func (c *RaftCluster) SetAllStoresLimit(typ storelimit.Type, ratePerMin float64) {
+// SetAllStoresLimit sets all store limit for a given type and rate,
+// recording one audit entry per store under user.
+func (c *RaftCluster) SetAllStoresLimit(user string, typ storelimit.Type, ratePerMin float64) {
+	for _, store := range c.GetStores() {
+		oldRate := c.opt.GetStoreLimitByType(store.GetID(), typ)
+		c.recordStoreLimitChange(user, typ.String(), store.GetID(), oldRate, ratePerMin)
+	}
 	c.opt.SetAllStoresLimit(typ, ratePerMin)
 }
 
@@ -1655,31 +1806,190 @@ func (c *RaftCluster) GetEtcdClient() *clientv3.Client {
 
 var healthURL = "/pd/api/v1/ping"
 
-// CheckHealth checks if members are healthy.
-func CheckHealth(client *http.Client, members []*pdpb.Member) map[uint64]*pdpb.Member {
-	healthMembers := make(map[uint64]*pdpb.Member)
-	for _, member := range members {
-		for _, cURL := range member.ClientUrls {
-			ctx, cancel := context.WithTimeout(context.Background(), clientTimeout)
-			req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s%s", cURL, healthURL), nil)
-			if err != nil {
-				log.Error("failed to new request", errs.ZapError(errs.ErrNewHTTPRequest, err))
-				cancel()
-				continue
-			}
+// clusterIDHeader is the response header a PD's /ping handler stamps with
+// its own cluster ID, the same split-brain guard etcd's rafthttp applies
+// via X-Etcd-Cluster-ID: a PD instance that never rejoined after being
+// kicked out of the cluster, or was restored from a different cluster's
+// backup, still answers on a known client URL but belongs to a different
+// cluster ID, and must not be reported healthy.
+const clusterIDHeader = "X-PD-Cluster-ID"
 
-			resp, err := client.Do(req)
-			if resp != nil {
-				resp.Body.Close()
-			}
-			cancel()
-			if err == nil && resp.StatusCode == http.StatusOK {
-				healthMembers[member.GetMemberId()] = member
-				break
-			}
+// healthCheckConcurrency bounds how many members CheckHealth probes at
+// once, the same way k3s caps concurrent etcd member checks with a
+// semaphore rather than letting a large cluster fan out unbounded dials.
+var healthCheckConcurrency int64 = 8
+
+// MemberStatus is the outcome of probing one PD member's health.
+type MemberStatus string
+
+const (
+	// MemberServing means the member answered and is healthy.
+	MemberServing MemberStatus = "SERVING"
+	// MemberNotServing means the member answered but reported itself
+	// unhealthy, or was excluded for a cluster ID mismatch.
+	MemberNotServing MemberStatus = "NOT_SERVING"
+	// MemberTimeout means no client URL of the member answered, whatever
+	// the failure: a timeout, a refused connection or any other error all
+	// end up here.
+	MemberTimeout MemberStatus = "TIMEOUT"
+	// MemberUnknown is not returned by CheckHealth: a member none of whose
+	// client URLs answered is reported as MemberTimeout.
+	MemberUnknown MemberStatus = "UNKNOWN"
+)
+
+// MemberHealth is the detailed result of probing one PD member, exposed so
+// a caller can distinguish a merely slow member from one that's actually
+// down, rather than collapsing both into "unhealthy".
+type MemberHealth struct {
+	Member    *pdpb.Member
+	Status    MemberStatus
+	ClientURL string
+	Latency   time.Duration
+}
+
+// CheckHealth probes every member concurrently, bounded by
+// healthCheckConcurrency, preferring the standard gRPC health-checking
+// protocol and falling back to the HTTP /ping path (the previous, sole
+// mechanism) only when gRPC is unreachable - so an older PD binary that
+// doesn't serve grpc_health_v1.Health yet is still reachable. Both paths
+// compare the member's own reported cluster ID against localClusterID
+// (via pdpb.PD/GetMembers over gRPC, or the X-PD-Cluster-ID header over
+// HTTP); a mismatch is reported MemberNotServing rather than dropped, so
+// a caller can still see that the address answered.
+func CheckHealth(client *http.Client, localClusterID uint64, members []*pdpb.Member) map[uint64]MemberHealth {
+	results := make(map[uint64]MemberHealth, len(members))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	sem := semaphore.NewWeighted(healthCheckConcurrency)
+	ctx := context.Background()
+	for _, member := range members {
+		member := member
+		if err := sem.Acquire(ctx, 1); err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer sem.Release(1)
+			health := probeMemberHealth(client, localClusterID, member)
+			healthProbeLatencyHistogram.WithLabelValues(member.GetName()).Observe(health.Latency.Seconds())
+			mu.Lock()
+			results[member.GetMemberId()] = health
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// probeMemberHealth tries every client URL of member in turn, gRPC health
+// check first, HTTP /ping as a fallback, stopping at the first URL that
+// answers either way.
+func probeMemberHealth(client *http.Client, localClusterID uint64, member *pdpb.Member) MemberHealth {
+	for _, cURL := range member.ClientUrls {
+		start := time.Now()
+		status, ok := probeMemberGRPC(localClusterID, member, cURL)
+		if !ok {
+			status, ok = probeMemberHTTP(client, localClusterID, member, cURL)
+		}
+		if ok {
+			return MemberHealth{Member: member, Status: status, ClientURL: cURL, Latency: time.Since(start)}
 		}
 	}
-	return healthMembers
+	return MemberHealth{Member: member, Status: MemberTimeout}
+}
+
+// probeMemberGRPC calls the standard grpc_health_v1.Health/Check RPC
+// against cURL, returning ok=false when the endpoint can't be reached at
+// all (e.g. an older PD binary not yet serving grpc_health_v1), so the
+// caller knows to fall back to the HTTP /ping path instead of reporting
+// the member down.
+//
+// grpc_health_v1.Health/Check has no notion of cluster ID, so a SERVING
+// response alone can't tell a genuine member apart from a split-brain PD
+// that answers fine but belongs to a different cluster. A SERVING result
+// is therefore confirmed with one more RPC, pdpb.PD/GetMembers, whose
+// response header carries the responder's own cluster ID - the same
+// check probeMemberHTTP already does via the X-PD-Cluster-ID header.
+func probeMemberGRPC(localClusterID uint64, member *pdpb.Member, cURL string) (MemberStatus, bool) {
+	addr := strings.TrimPrefix(strings.TrimPrefix(cURL, "http://"), "https://")
+	ctx, cancel := context.WithTimeout(context.Background(), clientTimeout)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, addr, grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		return "", false
+	}
+	defer conn.Close()
+
+	resp, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		return "", false
+	}
+	if resp.GetStatus() != grpc_health_v1.HealthCheckResponse_SERVING {
+		return MemberNotServing, true
+	}
+
+	membersResp, err := pdpb.NewPDClient(conn).GetMembers(ctx, &pdpb.GetMembersRequest{})
+	if err != nil {
+		// The endpoint answered the health check but can't serve pdpb yet
+		// (e.g. still bootstrapping); fall back to the HTTP path rather
+		// than trusting an unconfirmed SERVING.
+		return "", false
+	}
+	remoteClusterID := membersResp.GetHeader().GetClusterId()
+	if remoteClusterID != 0 && remoteClusterID != localClusterID {
+		log.Warn("member reachable over gRPC but reports a mismatched cluster ID",
+			zap.String("member", member.GetName()),
+			zap.String("client-url", cURL),
+			zap.Uint64("remote-cluster-id", remoteClusterID),
+			errs.ZapError(errs.ErrClusterIDMismatch.FastGenByArgs(localClusterID, remoteClusterID)))
+		clusterIDMismatchCounter.Inc()
+		return MemberNotServing, true
+	}
+	return MemberServing, true
+}
+
+// probeMemberHTTP is the pre-gRPC health check, kept as the fallback
+// transport: a plain GET against /pd/api/v1/ping, with the same
+// X-PD-Cluster-ID comparison CheckHealth has always applied.
+func probeMemberHTTP(client *http.Client, localClusterID uint64, member *pdpb.Member, cURL string) (MemberStatus, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), clientTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s%s", cURL, healthURL), nil)
+	if err != nil {
+		log.Error("failed to new request", errs.ZapError(errs.ErrNewHTTPRequest, err))
+		return "", false
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return MemberNotServing, true
+	}
+
+	remoteClusterID := resp.Header.Get(clusterIDHeader)
+	if remoteClusterID != "" && remoteClusterID != strconv.FormatUint(localClusterID, 10) {
+		log.Warn("member reachable but reports a mismatched cluster ID",
+			zap.String("member", member.GetName()),
+			zap.String("client-url", cURL),
+			zap.String("remote-cluster-id", remoteClusterID),
+			errs.ZapError(errs.ErrClusterIDMismatch.FastGenByArgs(localClusterID, remoteClusterID)))
+		clusterIDMismatchCounter.Inc()
+		return MemberNotServing, true
+	}
+	return MemberServing, true
+}
+
+// GetClusterID returns the cluster ID this RaftCluster believes it belongs
+// to, the reference CheckHealth compares every member's reported cluster ID
+// against.
+func (c *RaftCluster) GetClusterID() uint64 {
+	return c.clusterID
 }
 
 // GetMembers return a slice of Members.
@@ -15,6 +15,7 @@ package cluster
 
 import (
 	"bytes"
+	"math"
 
 	"github.com/gogo/protobuf/proto"
 	"github.com/pingcap/errors"
@@ -24,14 +25,26 @@ import (
 	"github.com/tikv/pd/pkg/errs"
 	"github.com/tikv/pd/server/core"
 	"github.com/tikv/pd/server/schedule"
+	"github.com/tikv/pd/server/statistics"
 	"github.com/tikv/pd/server/versioninfo"
 	"go.uber.org/zap"
 )
 
 // HandleRegionHeartbeat processes RegionInfo reports from client.
 func (c *RaftCluster) HandleRegionHeartbeat(region *core.RegionInfo) error {
-	if err := c.processRegionHeartbeat(region); err != nil {
-		return err
+	var changed *RegionChanged
+	if useLegacyRegionGuide {
+		err := c.processRegionHeartbeatLegacy(region)
+		changed = &RegionChanged{SaveCache: true}
+		if err != nil {
+			return err
+		}
+	} else {
+		var err error
+		changed, err = c.processRegionHeartbeat(region)
+		if err != nil {
+			return err
+		}
 	}
 
 	// If the region peer count is 0, then we should not handle this.
@@ -40,13 +53,70 @@ func (c *RaftCluster) HandleRegionHeartbeat(region *core.RegionInfo) error {
 		return errors.Errorf("invalid region, zero region peer count: %v", core.RegionToHexMeta(region.GetMeta()))
 	}
 
+	// The hot-peer rolling averages and TopN recomputation run on the hot
+	// cache's own worker goroutines, so they never stall this heartbeat.
+	// Unlike the region-cache write below, hot-region sampling is not gated
+	// on changed.SaveCache/IsNew: those only turn on when traceRegionFlow
+	// reports the flow numbers themselves changed, so a region that stays
+	// steadily hot (or steadily idle) with no leader/size/peer-count change
+	// would otherwise never get sampled again - and, for a region that goes
+	// cold after being hot, never get the "no longer hot" sample that
+	// CollectExpiredItemsAsync's eviction depends on. So these run on every
+	// heartbeat, unconditionally, the same as in baseline.
+	c.hotSpotCache.CheckWriteAsync(region, c.storesStats)
+	c.hotSpotCache.CheckReadAsync(region, c.storesStats)
+	c.hotSpotCache.CollectExpiredItemsAsync(region)
+	c.hotSpotCache.CollectUnReportedPeerAsync(region, changed.Origin)
+
 	c.RLock()
 	co := c.coordinator
 	c.RUnlock()
+	c.maybeSplitHotRegion(region, co.opController)
 	co.opController.Dispatch(region, schedule.DispatchFromHeartBeat)
 	return nil
 }
 
+// maybeSplitHotRegion requests a hot-region split when IsHotRegionSplitEnabled
+// and region's own hottest-flow stat has stayed hot and busy for long enough
+// (IsRegionSplitCandidate), splitting at hotBucketSplitKey's traffic-aware key
+// via schedule.CreateSplitOperator so the region is split where its load
+// actually concentrates instead of being rebalanced or mid-key split.
+//
+// This is the live call site these pieces were all missing: before this fix
+// nothing in this tree ever called schedule.CreateSplitOperator,
+// hotBucketSplitKey, or statistics.HotPeerStat.IsRegionSplitCandidate, so
+// hot-region-split's config knobs on PersistOptions went unread and the
+// feature never ran. One piece stays unreachable even after this fix:
+// BucketStat.SetBuckets, which would need bucket-granularity loads parsed out
+// of the raw region heartbeat request, and neither that parsing nor the
+// server/core heartbeat-ingestion code it would live in is part of this
+// source tree - so hotBucketSplitKey keeps returning nil here and the
+// operator falls back to CheckPolicy_APPROXIMATE, same as a plain OpSplit.
+func (c *RaftCluster) maybeSplitHotRegion(region *core.RegionInfo, oc *schedule.OperatorController) {
+	opt := c.GetOpts()
+	if !opt.IsHotRegionSplitEnabled() || oc.GetOperator(region.GetID()) != nil {
+		return
+	}
+
+	minBytesRate := float64(opt.GetHotRegionSplitSize())
+	minOps := opt.GetHotRegionSplitQPS()
+	minHotDegree := opt.GetHotRegionCacheHitsThreshold()
+	for _, kind := range []statistics.FlowKind{statistics.WriteFlow, statistics.ReadFlow} {
+		for _, stat := range c.hotSpotCache.RegionStats(kind)[region.GetLeader().GetStoreId()] {
+			if stat.RegionID != region.GetID() || !stat.IsRegionSplitCandidate(minBytesRate, math.MaxFloat64, minOps, minHotDegree) {
+				continue
+			}
+			op, err := schedule.CreateSplitOperator(region, kind, c.hotBucketSplitKey(region))
+			if err != nil {
+				log.Warn("failed to create hot region split operator", zap.Uint64("region-id", region.GetID()), zap.Error(err))
+				return
+			}
+			oc.AddOperator(op)
+			return
+		}
+	}
+}
+
 // HandleAskSplit handles the split request.
 func (c *RaftCluster) HandleAskSplit(request *pdpb.AskSplitRequest) (*pdpb.AskSplitResponse, error) {
 	reqRegion := request.GetRegion()
@@ -99,6 +169,27 @@ func (c *RaftCluster) ValidRequestRegion(reqRegion *metapb.Region) error {
 	return nil
 }
 
+// hotBucketSplitKey returns the traffic-aware split key for region, derived
+// from its hottest peer's per-bucket loads, for maybeSplitHotRegion to pass
+// to schedule.CreateSplitOperator instead of letting TiKV pick a mid-key
+// split. Returns nil - falling back to a mid-key split - until something
+// populates HotPeerStat.Buckets via SetBuckets, which nothing in this source
+// tree does yet (see maybeSplitHotRegion).
+func (c *RaftCluster) hotBucketSplitKey(region *core.RegionInfo) []byte {
+	for _, kind := range []statistics.FlowKind{statistics.WriteFlow, statistics.ReadFlow} {
+		stats := c.hotSpotCache.RegionStats(kind)[region.GetLeader().GetStoreId()]
+		for _, stat := range stats {
+			if stat.RegionID != region.GetID() {
+				continue
+			}
+			if key := stat.HottestBucketSplitKey(); len(key) > 0 {
+				return key
+			}
+		}
+	}
+	return nil
+}
+
 // HandleAskBatchSplit handles the batch split request.
 func (c *RaftCluster) HandleAskBatchSplit(request *pdpb.AskBatchSplitRequest) (*pdpb.AskBatchSplitResponse, error) {
 	reqRegion := request.GetRegion()
@@ -148,6 +239,98 @@ func (c *RaftCluster) HandleAskBatchSplit(request *pdpb.AskBatchSplitRequest) (*
 	return resp, nil
 }
 
+// HandleAskBatchSplitByKeys handles a batch split request where the caller
+// supplies the exact split keys instead of letting TiKV pick them. This is
+// used by the TiDB pre-split-table workflow for SHARD_ROW_ID_BITS /
+// PRE_SPLIT_REGIONS tables, where the split points are already known.
+func (c *RaftCluster) HandleAskBatchSplitByKeys(region *core.RegionInfo, splitKeys [][]byte, scatter bool) (*pdpb.AskBatchSplitResponse, error) {
+	if err := c.ValidRequestRegion(region.GetMeta()); err != nil {
+		return nil, err
+	}
+	if err := validateSplitKeys(region.GetMeta(), splitKeys); err != nil {
+		return nil, err
+	}
+
+	splitIDs := make([]*pdpb.SplitID, 0, len(splitKeys))
+	recordRegions := make([]uint64, 0, len(splitKeys)+1)
+
+	for range splitKeys {
+		newRegionID, err := c.id.Alloc()
+		if err != nil {
+			return nil, err
+		}
+
+		peerIDs := make([]uint64, len(region.GetPeers()))
+		for i := range peerIDs {
+			var err error
+			if peerIDs[i], err = c.id.Alloc(); err != nil {
+				return nil, err
+			}
+		}
+
+		recordRegions = append(recordRegions, newRegionID)
+		splitIDs = append(splitIDs, &pdpb.SplitID{
+			NewRegionId: newRegionID,
+			NewPeerIds:  peerIDs,
+		})
+
+		log.Info("alloc ids for region split by keys", zap.Uint64("region-id", newRegionID), zap.Uint64s("peer-ids", peerIDs))
+	}
+
+	recordRegions = append(recordRegions, region.GetID())
+	if c.IsFeatureSupported(versioninfo.RegionMerge) {
+		// Disable merge the regions in a period of time.
+		c.GetMergeChecker().RecordRegionSplit(recordRegions)
+	}
+
+	// If region splits during the scheduling process, regions with abnormal
+	// status may be left, and these regions need to be checked with higher
+	// priority.
+	c.AddSuspectRegions(recordRegions...)
+
+	if scatter {
+		// The freshly split regions don't exist in the cache yet, so they
+		// can't be scattered directly; their key ranges are recorded as
+		// suspect key ranges instead. Nothing here scatters the new
+		// regions.
+		start := region.GetStartKey()
+		for _, key := range splitKeys {
+			c.AddSuspectKeyRange(start, key)
+			start = key
+		}
+		c.AddSuspectKeyRange(start, region.GetEndKey())
+	}
+
+	resp := &pdpb.AskBatchSplitResponse{Ids: splitIDs}
+	return resp, nil
+}
+
+// validateSplitKeys checks that every key lies within
+// [region.StartKey, region.EndKey) and that the keys are strictly increasing.
+func validateSplitKeys(region *metapb.Region, splitKeys [][]byte) error {
+	if len(splitKeys) == 0 {
+		return errors.New("no split key is specified")
+	}
+	prev := region.GetStartKey()
+	for i, key := range splitKeys {
+		if len(key) == 0 {
+			return errors.Errorf("split key %d is empty", i)
+		}
+		// prev starts at region.GetStartKey(), so this also catches split
+		// key 0 landing at or before the region's own start key - an empty
+		// GetStartKey() compares less than any non-empty key, so an
+		// unbounded region's first key is unaffected.
+		if bytes.Compare(key, prev) <= 0 {
+			return errors.Errorf("split keys must be strictly increasing, key %d is not greater than the previous one", i)
+		}
+		if len(region.GetEndKey()) != 0 && bytes.Compare(key, region.GetEndKey()) >= 0 {
+			return errors.Errorf("split key %d is out of the region range", i)
+		}
+		prev = key
+	}
+	return nil
+}
+
 func (c *RaftCluster) checkSplitRegion(left *metapb.Region, right *metapb.Region) error {
 	if left == nil || right == nil {
 		return errors.New("invalid split region")
@@ -0,0 +1,222 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/pingcap/log"
+	"go.etcd.io/etcd/clientv3"
+	"go.uber.org/zap"
+
+	"github.com/tikv/pd/pkg/errs"
+	"github.com/tikv/pd/pkg/etcdutil"
+)
+
+const (
+	// learnerProgressPrefix is the etcd key prefix LearnerProgress records
+	// are kept under, one key per learner ID, so a PD restart doesn't lose
+	// track of how far a learner had caught up.
+	learnerProgressPrefix = "/pd/learner-progress/"
+	learnerProgressPollInterval = 5 * time.Second
+)
+
+// LearnerProgress is how far one PD learner has replayed the raft log,
+// as of the last poll. PromoteLearner consults it to refuse promoting a
+// learner that hasn't caught up enough to safely become a voter.
+type LearnerProgress struct {
+	ID               uint64
+	Name             string
+	RaftAppliedIndex uint64
+	LastProgress     time.Time
+}
+
+// AddPDLearner adds a new, non-voting PD member listening on peerURL and
+// returns its etcd member ID. The caller is responsible for actually
+// starting a PD process configured to join as that learner; this only
+// registers it with the existing cluster.
+func (c *RaftCluster) AddPDLearner(ctx context.Context, peerURL string) (uint64, error) {
+	resp, err := c.etcdClient.MemberAddAsLearner(ctx, []string{peerURL})
+	if err != nil {
+		return 0, err
+	}
+	return resp.Member.ID, nil
+}
+
+// PromoteLearner promotes id to a full voting PD member, refusing when its
+// last recorded RaftAppliedIndex trails the etcd leader's by more than
+// GetMaxLearnerCatchUpLag - mirroring the safe-promotion check k3s runs
+// before promoting a learner, so a barely-caught-up member can't become a
+// voter and push the cluster into a quorum it can't actually service.
+func (c *RaftCluster) PromoteLearner(ctx context.Context, id uint64) error {
+	progress, ok := c.getLearnerProgress(id)
+	if !ok {
+		return errs.ErrLearnerNotCaughtUp.FastGenByArgs(id)
+	}
+
+	leaderIndex, err := c.leaderRaftIndex(ctx)
+	if err != nil {
+		return err
+	}
+	lag := c.opt.GetMaxLearnerCatchUpLag()
+	if leaderIndex > progress.RaftAppliedIndex && leaderIndex-progress.RaftAppliedIndex > lag {
+		return errs.ErrLearnerNotCaughtUp.FastGenByArgs(id)
+	}
+
+	if _, err := c.etcdClient.MemberPromote(ctx, id); err != nil {
+		return err
+	}
+	return c.deleteLearnerProgress(ctx, id)
+}
+
+// RemovePDMember removes id, learner or voter, from the PD cluster.
+func (c *RaftCluster) RemovePDMember(ctx context.Context, id uint64) error {
+	if _, err := c.etcdClient.MemberRemove(ctx, id); err != nil {
+		return err
+	}
+	return c.deleteLearnerProgress(ctx, id)
+}
+
+// GetLearnerProgress returns the last observed LearnerProgress of every
+// current PD learner, as maintained by runLearnerProgressLoop.
+func (c *RaftCluster) GetLearnerProgress() ([]*LearnerProgress, error) {
+	resp, err := etcdutil.EtcdKVGet(c.etcdClient, learnerProgressPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	progresses := make([]*LearnerProgress, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		progress := &LearnerProgress{}
+		if err := json.Unmarshal(kv.Value, progress); err != nil {
+			log.Warn("failed to unmarshal learner progress", zap.ByteString("key", kv.Key), zap.Error(err))
+			continue
+		}
+		progresses = append(progresses, progress)
+	}
+	return progresses, nil
+}
+
+func (c *RaftCluster) getLearnerProgress(id uint64) (*LearnerProgress, bool) {
+	progresses, err := c.GetLearnerProgress()
+	if err != nil {
+		return nil, false
+	}
+	for _, p := range progresses {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+func (c *RaftCluster) saveLearnerProgress(ctx context.Context, progress *LearnerProgress) error {
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	_, err = c.etcdClient.Put(ctx, learnerProgressKey(progress.ID), string(data))
+	return err
+}
+
+func (c *RaftCluster) deleteLearnerProgress(ctx context.Context, id uint64) error {
+	_, err := c.etcdClient.Delete(ctx, learnerProgressKey(id))
+	return err
+}
+
+func learnerProgressKey(id uint64) string {
+	return learnerProgressPrefix + strconv.FormatUint(id, 10)
+}
+
+// leaderRaftIndex returns the etcd leader's current raft index, the
+// reference point PromoteLearner measures a learner's catch-up lag
+// against.
+func (c *RaftCluster) leaderRaftIndex(ctx context.Context) (uint64, error) {
+	selfStatus, err := c.etcdClient.Status(ctx, c.etcdClient.Endpoints()[0])
+	if err != nil {
+		return 0, err
+	}
+	if selfStatus.Header.MemberId == selfStatus.Leader {
+		return selfStatus.RaftIndex, nil
+	}
+
+	members, err := etcdutil.ListEtcdMembers(c.etcdClient)
+	if err != nil {
+		return 0, err
+	}
+	for _, m := range members.Members {
+		if m.ID != selfStatus.Leader || len(m.ClientURLs) == 0 {
+			continue
+		}
+		leaderStatus, err := c.etcdClient.Status(ctx, m.ClientURLs[0])
+		if err != nil {
+			return 0, err
+		}
+		return leaderStatus.RaftIndex, nil
+	}
+	return 0, errs.ErrEtcdLeaderNotFound.FastGenByArgs(selfStatus.Leader)
+}
+
+// runLearnerProgressLoop polls the raft index of every current PD learner
+// every learnerProgressPollInterval and persists it, so PromoteLearner can
+// make its catch-up decision off a recent, durable observation rather than
+// querying every learner inline on every promotion request.
+func (c *RaftCluster) runLearnerProgressLoop() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(learnerProgressPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.quit:
+			return
+		case <-ticker.C:
+			c.pollLearnerProgress()
+		}
+	}
+}
+
+func (c *RaftCluster) pollLearnerProgress() {
+	ctx, cancel := context.WithTimeout(context.Background(), clientTimeout)
+	defer cancel()
+
+	members, err := etcdutil.ListEtcdMembers(c.etcdClient)
+	if err != nil {
+		log.Warn("failed to list etcd members while polling learner progress", errs.ZapError(err))
+		return
+	}
+
+	for _, m := range members.Members {
+		if !m.IsLearner || len(m.ClientURLs) == 0 {
+			continue
+		}
+		status, err := c.etcdClient.Status(ctx, m.ClientURLs[0])
+		if err != nil {
+			log.Warn("failed to get learner status", zap.Uint64("learner-id", m.ID), errs.ZapError(err))
+			continue
+		}
+		progress := &LearnerProgress{
+			ID:               m.ID,
+			Name:             m.Name,
+			RaftAppliedIndex: status.RaftIndex,
+			LastProgress:     time.Now(),
+		}
+		if err := c.saveLearnerProgress(ctx, progress); err != nil {
+			log.Warn("failed to save learner progress", zap.Uint64("learner-id", m.ID), errs.ZapError(err))
+		}
+	}
+}
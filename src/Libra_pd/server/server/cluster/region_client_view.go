@@ -0,0 +1,87 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"github.com/gogo/protobuf/proto"
+	"github.com/pingcap/kvproto/pkg/metapb"
+	"github.com/tikv/pd/pkg/errs"
+	"github.com/tikv/pd/server/core"
+)
+
+// GetRegionForClient returns regionID's RegionInfo with any peer on a
+// tombstone or missing store dropped, so a client that caches the result
+// (routing future requests straight to those peers) doesn't spend retries
+// against stores that are already known to be gone rather than waiting for
+// the next scheduler pass to remove them. When excludeUnhealthy is true,
+// peers on a store store.IsUnhealthy() also flags - offline,
+// long-disconnected, or physically destroyed - are dropped too, for a
+// client willing to trade a few extra PD round trips for fresher routes.
+func (c *RaftCluster) GetRegionForClient(regionID uint64, excludeUnhealthy bool) (*core.RegionInfo, error) {
+	return c.filterRegionForClient(c.GetRegion(regionID), excludeUnhealthy)
+}
+
+// GetRegionByKeyForClient is GetRegionForClient narrowed to a key lookup,
+// the same way GetRegionByKey sits alongside GetRegion.
+func (c *RaftCluster) GetRegionByKeyForClient(regionKey []byte, excludeUnhealthy bool) (*core.RegionInfo, error) {
+	return c.filterRegionForClient(c.GetRegionByKey(regionKey), excludeUnhealthy)
+}
+
+func (c *RaftCluster) filterRegionForClient(region *core.RegionInfo, excludeUnhealthy bool) (*core.RegionInfo, error) {
+	if region == nil {
+		return nil, nil
+	}
+
+	peers := make([]*metapb.Peer, 0, len(region.GetPeers()))
+	for _, peer := range region.GetPeers() {
+		store := c.GetStore(peer.GetStoreId())
+		if store == nil || store.IsTombstone() {
+			continue
+		}
+		if excludeUnhealthy && store.IsUnhealthy() {
+			continue
+		}
+		peers = append(peers, peer)
+	}
+	if len(peers) == 0 {
+		return nil, errs.ErrRegionNoLivePeer.FastGenByArgs(region.GetID())
+	}
+	if len(peers) == len(region.GetPeers()) {
+		return region, nil
+	}
+
+	meta := proto.Clone(region.GetMeta()).(*metapb.Region)
+	meta.Peers = peers
+
+	// If the leader's own peer was one of those just dropped, it must not
+	// be carried over: a RegionInfo whose GetLeader() points to a peer no
+	// longer in GetPeers() is exactly the inconsistency this function
+	// exists to prevent. Falling back to no leader is safe - a client that
+	// gets no leader hint simply asks PD again instead of racing ahead
+	// with the leader at the next heartbeat.
+	leader := region.GetLeader()
+	if leader != nil {
+		leaderLive := false
+		for _, peer := range peers {
+			if peer.GetId() == leader.GetId() {
+				leaderLive = true
+				break
+			}
+		}
+		if !leaderLive {
+			leader = nil
+		}
+	}
+	return core.NewRegionInfo(meta, leader), nil
+}
@@ -0,0 +1,204 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/kvproto/pkg/metapb"
+	"github.com/tikv/pd/server/core"
+)
+
+// regionDumpMagic tags a dump stream so LoadRegionsFromDump can reject a
+// file that isn't one before it gets partway through decoding garbage as
+// region records.
+const regionDumpMagic = "PDRDUMP1"
+
+// regionDumpHeader is the fixed-size preamble written once at the start of
+// a dump, before any region record.
+type regionDumpHeader struct {
+	ClusterID uint64
+	Timestamp int64 // unix seconds, when the dump was taken
+}
+
+// DumpOptions controls RaftCluster.DumpRegions.
+type DumpOptions struct {
+	// FromStorage dumps the regions last persisted to c.storage instead of
+	// the in-memory cache in c.core, e.g. to capture what a restart would
+	// actually load rather than whatever's changed in memory since.
+	FromStorage bool
+	// Gzip wraps the record stream (everything after the header) in gzip,
+	// trading dump time for a smaller file - worthwhile for the full
+	// region set of a large cluster.
+	Gzip bool
+}
+
+// DumpRegions streams every region as a length-prefixed metapb.Region
+// protobuf record to w, preceded by a regionDumpHeader, for offline
+// diagnostics - reading scheduling decisions back out of a snapshot instead
+// of scraping the HTTP API region-by-region. It holds c's read lock only
+// long enough to read the cluster ID for the header and to gather the region
+// list (for opts.FromStorage, only for the cluster ID, since storage reads
+// don't need it); it does not hold c locked for the entire write to w.
+func (c *RaftCluster) DumpRegions(ctx context.Context, w io.Writer, opts DumpOptions) error {
+	c.RLock()
+	header := regionDumpHeader{ClusterID: c.clusterID, Timestamp: time.Now().Unix()}
+	c.RUnlock()
+
+	if err := binary.Write(w, binary.BigEndian, []byte(regionDumpMagic)); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, header); err != nil {
+		return err
+	}
+
+	rw := w
+	if opts.Gzip {
+		gw := gzip.NewWriter(w)
+		defer gw.Close()
+		rw = gw
+	}
+
+	writeRegion := func(meta *metapb.Region) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		data, err := proto.Marshal(meta)
+		if err != nil {
+			return err
+		}
+		if err := binary.Write(rw, binary.BigEndian, uint32(len(data))); err != nil {
+			return err
+		}
+		_, err = rw.Write(data)
+		return err
+	}
+
+	if opts.FromStorage {
+		// LoadRegionsOnce's callback, matching core.BasicCluster.
+		// CheckAndPutRegion's signature, has no error return of its own;
+		// capture the first write failure here and surface it once
+		// LoadRegionsOnce itself returns.
+		var writeErr error
+		err := c.storage.LoadRegionsOnce(func(region *core.RegionInfo) []*core.RegionInfo {
+			if writeErr == nil {
+				writeErr = writeRegion(region.GetMeta())
+			}
+			return nil
+		})
+		if writeErr != nil {
+			return writeErr
+		}
+		return err
+	}
+
+	c.RLock()
+	regions := c.core.GetRegions()
+	c.RUnlock()
+	for _, region := range regions {
+		if err := writeRegion(region.GetMeta()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadRegionsFromDump reads back a stream written by DumpRegions - gzipped
+// or not, detected from the header rather than needing a caller-supplied
+// flag - into RegionInfos, for tests and for RestoreRegionsFromDump to feed
+// into a cold core.BasicCluster.
+func LoadRegionsFromDump(r io.Reader) ([]*core.RegionInfo, error) {
+	magic := make([]byte, len(regionDumpMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, errors.WithMessage(err, "reading dump magic")
+	}
+	if string(magic) != regionDumpMagic {
+		return nil, errors.Errorf("not a region dump (bad magic %q)", magic)
+	}
+
+	var header regionDumpHeader
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return nil, errors.WithMessage(err, "reading dump header")
+	}
+
+	// A gzipped record stream starts with gzip's own two magic bytes
+	// (0x1f 0x8b). Peek at them through a buffered reader, so that a plain
+	// (non-gzipped) stream is left unconsumed and read as is.
+	br := bufio.NewReader(r)
+	var rr io.Reader = br
+	if head, err := br.Peek(2); err == nil && head[0] == 0x1f && head[1] == 0x8b {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, errors.WithMessage(err, "opening gzip stream")
+		}
+		defer gr.Close()
+		rr = gr
+	}
+
+	var regions []*core.RegionInfo
+	for {
+		var size uint32
+		if err := binary.Read(rr, binary.BigEndian, &size); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, errors.WithMessage(err, "reading record length")
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(rr, data); err != nil {
+			return nil, errors.WithMessage(err, "reading record body")
+		}
+		meta := &metapb.Region{}
+		if err := proto.Unmarshal(data, meta); err != nil {
+			return nil, errors.WithMessage(err, "unmarshaling record")
+		}
+		regions = append(regions, core.NewRegionInfo(meta, nil))
+	}
+	return regions, nil
+}
+
+// RestoreRegionsFromDump repopulates c.core from a dump read via r, for a
+// rescue mode that rebuilds the in-memory region cache after etcd
+// corruption has made the normal LoadRegionsOnce path unusable. It refuses
+// to run while c is started - restoring into a cluster already serving
+// heartbeats would race every in-flight processRegionHeartbeat - regardless
+// of force; force only gates the pd-ctl command's own confirmation prompt,
+// not this safety check, which callers cannot bypass.
+func (c *RaftCluster) RestoreRegionsFromDump(r io.Reader) error {
+	c.RLock()
+	running := c.running
+	c.RUnlock()
+	if running {
+		return errors.New("cannot restore regions into a running cluster")
+	}
+
+	regions, err := LoadRegionsFromDump(r)
+	if err != nil {
+		return err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	for _, region := range regions {
+		c.core.CheckAndPutRegion(region)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"github.com/pingcap/kvproto/pkg/replication_modepb"
+	"github.com/pingcap/log"
+	"github.com/tikv/pd/server/core"
+	"go.uber.org/zap"
+)
+
+// RegionGuideFunc decides, from a newly heartbeated region and the region
+// info already in cache, whether the update needs to be written to storage
+// (saveKV), written to the in-memory cache (saveCache), treated as the
+// region's first heartbeat (isNew), and pushed to the region syncer
+// (needSync).
+//
+// It's factored out of RaftCluster.processRegionHeartbeat so anything else
+// that ingests region info in bulk - the region syncer client, a
+// regions-dump/restore tool, tests - can apply the same rules without
+// duplicating them or pulling in RaftCluster itself.
+type RegionGuideFunc func(region, origin *core.RegionInfo) (isNew, saveKV, saveCache, needSync bool)
+
+// GenerateRegionGuideFunc returns a RegionGuideFunc. Logging of what
+// changed is gated behind enableLog, since a caller replaying a large batch
+// of regions (region syncer, dump/restore) wants the same decisions without
+// the log spam a live heartbeat stream produces. traceRegionFlow mirrors
+// RaftCluster.traceRegionFlow: when false, a region's traced read/write
+// flow fields are never considered a cache-worthy change.
+func GenerateRegionGuideFunc(enableLog bool, traceRegionFlow bool) RegionGuideFunc {
+	noLog := func(_ string, _ ...zap.Field) {}
+	debugLog, infoLog := noLog, noLog
+	if enableLog {
+		debugLog, infoLog = log.Debug, log.Info
+	}
+	return func(region, origin *core.RegionInfo) (isNew, saveKV, saveCache, needSync bool) {
+		// Save to storage if meta is updated.
+		// Save to cache if meta or leader is updated, or contains any down/pending peer.
+		// Mark isNew if the region in cache does not have leader.
+		if origin == nil {
+			debugLog("insert new region",
+				zap.Uint64("region-id", region.GetID()),
+				zap.Stringer("meta-region", core.RegionToHexMeta(region.GetMeta())),
+			)
+			saveKV, saveCache, isNew = true, true, true
+		} else {
+			r := region.GetRegionEpoch()
+			o := origin.GetRegionEpoch()
+			if r.GetVersion() > o.GetVersion() {
+				infoLog("region Version changed",
+					zap.Uint64("region-id", region.GetID()),
+					zap.String("detail", core.DiffRegionKeyInfo(origin, region)),
+					zap.Uint64("old-version", o.GetVersion()),
+					zap.Uint64("new-version", r.GetVersion()),
+				)
+				saveKV, saveCache = true, true
+			}
+			if r.GetConfVer() > o.GetConfVer() {
+				infoLog("region ConfVer changed",
+					zap.Uint64("region-id", region.GetID()),
+					zap.String("detail", core.DiffRegionPeersInfo(origin, region)),
+					zap.Uint64("old-confver", o.GetConfVer()),
+					zap.Uint64("new-confver", r.GetConfVer()),
+				)
+				saveKV, saveCache = true, true
+			}
+			if region.GetLeader().GetId() != origin.GetLeader().GetId() {
+				if origin.GetLeader().GetId() == 0 {
+					isNew = true
+				} else {
+					infoLog("leader changed",
+						zap.Uint64("region-id", region.GetID()),
+						zap.Uint64("from", origin.GetLeader().GetStoreId()),
+						zap.Uint64("to", region.GetLeader().GetStoreId()),
+					)
+				}
+				saveCache, needSync = true, true
+			}
+			if len(region.GetDownPeers()) > 0 || len(region.GetPendingPeers()) > 0 {
+				saveCache = true
+			}
+			if len(origin.GetDownPeers()) > 0 || len(origin.GetPendingPeers()) > 0 {
+				saveCache = true
+			}
+			if len(region.GetPeers()) != len(origin.GetPeers()) {
+				saveKV, saveCache = true, true
+			}
+
+			if region.GetApproximateSize() != origin.GetApproximateSize() ||
+				region.GetApproximateKeys() != origin.GetApproximateKeys() {
+				saveCache = true
+			}
+
+			if traceRegionFlow && (region.GetBytesWritten() != origin.GetBytesWritten() ||
+				region.GetBytesRead() != origin.GetBytesRead() ||
+				region.GetKeysWritten() != origin.GetKeysWritten() ||
+				region.GetKeysRead() != origin.GetKeysRead() ||
+				region.GetOpsWrite() != origin.GetOpsWrite() ||
+				region.GetOpsRead() != origin.GetOpsRead()) {
+				saveCache, needSync = true, true
+			}
+
+			if region.GetReplicationStatus().GetState() != replication_modepb.RegionReplicationState_UNKNOWN &&
+				(region.GetReplicationStatus().GetState() != origin.GetReplicationStatus().GetState() ||
+					region.GetReplicationStatus().GetStateId() != origin.GetReplicationStatus().GetStateId()) {
+				saveCache = true
+			}
+		}
+		return
+	}
+}
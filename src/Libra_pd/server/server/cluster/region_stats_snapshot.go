@@ -0,0 +1,152 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"time"
+
+	"github.com/tikv/pd/server/core"
+	"github.com/tikv/pd/server/statistics"
+)
+
+// regionStatsSnapshotSampleSize bounds how many region IDs RegionStatsSnapshot
+// keeps per category - enough for an operator to go look at a few examples
+// without the snapshot itself growing with cluster size.
+const regionStatsSnapshotSampleSize = 10
+
+// regionStatTypes is every RegionStatisticType RefreshRegionStatsSnapshot
+// reports on.
+var regionStatTypes = []statistics.RegionStatisticType{
+	statistics.MissPeer,
+	statistics.ExtraPeer,
+	statistics.DownPeer,
+	statistics.PendingPeer,
+	statistics.LearnerPeer,
+	statistics.OversizedRegion,
+	statistics.EmptyRegion,
+}
+
+// RegionStatsSnapshot is the last point-in-time view the background job in
+// runBackgroundJobs computed from regionStats's per-heartbeat dirty sets,
+// so an HTTP handler can answer "what regions have issues right now"
+// without re-walking every region itself.
+type RegionStatsSnapshot struct {
+	Timestamp time.Time
+	// Counts and Samples are keyed by the same RegionStatisticType
+	// GetRegionStatsByType takes, for miss-peer/extra-peer/down-peer/
+	// pending-peer/learner-peer/oversized/empty regions.
+	Counts  map[statistics.RegionStatisticType]int
+	Samples map[statistics.RegionStatisticType][]uint64
+
+	// OfflinePeerRegionCount and OfflinePeerRegionSample cover regions with
+	// a peer on an offline store - derived directly from core.BasicCluster's
+	// store states rather than from regionStats, since offline-peer
+	// regions previously only surfaced through a Grafana metric, not
+	// through RegionStatisticType.
+	OfflinePeerRegionCount  int
+	OfflinePeerRegionSample []uint64
+}
+
+// IsEmpty reports whether every category in the snapshot is empty - a
+// cluster with no miss-peer, extra-peer, down-peer, pending-peer,
+// learner-peer, offline-peer, oversized, or empty regions.
+func (s *RegionStatsSnapshot) IsEmpty() bool {
+	if s == nil {
+		return true
+	}
+	if s.OfflinePeerRegionCount > 0 {
+		return false
+	}
+	for _, count := range s.Counts {
+		if count > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// refreshRegionStatsSnapshot rebuilds c.lastRegionStats from regionStats's
+// current per-category region sets plus a fresh scan of offline-store
+// membership. It's run periodically from runBackgroundJobs, decoupled from
+// the per-heartbeat classification processRegionHeartbeat already does via
+// c.regionStats.Observe, so a heartbeat never blocks on building the
+// snapshot an HTTP handler would read.
+func (c *RaftCluster) refreshRegionStatsSnapshot() {
+	c.RLock()
+	if c.regionStats == nil {
+		c.RUnlock()
+		return
+	}
+	snapshot := &RegionStatsSnapshot{
+		Timestamp: time.Now(),
+		Counts:    make(map[statistics.RegionStatisticType]int, len(regionStatTypes)),
+		Samples:   make(map[statistics.RegionStatisticType][]uint64, len(regionStatTypes)),
+	}
+	for _, typ := range regionStatTypes {
+		regions := c.regionStats.GetRegionStatsByType(typ)
+		snapshot.Counts[typ] = len(regions)
+		snapshot.Samples[typ] = sampleRegionIDs(regions)
+	}
+
+	var offline []*core.RegionInfo
+	for _, store := range c.core.GetStores() {
+		if !store.IsOffline() {
+			continue
+		}
+		offline = append(offline, c.core.GetStoreRegions(store.GetID())...)
+	}
+	c.RUnlock()
+
+	seen := make(map[uint64]struct{}, len(offline))
+	unique := offline[:0]
+	for _, region := range offline {
+		if _, ok := seen[region.GetID()]; ok {
+			continue
+		}
+		seen[region.GetID()] = struct{}{}
+		unique = append(unique, region)
+	}
+	snapshot.OfflinePeerRegionCount = len(unique)
+	snapshot.OfflinePeerRegionSample = sampleRegionIDs(unique)
+
+	c.lastRegionStats.Store(snapshot)
+}
+
+// sampleRegionIDs takes up to regionStatsSnapshotSampleSize IDs from
+// regions, for RegionStatsSnapshot's per-category samples.
+func sampleRegionIDs(regions []*core.RegionInfo) []uint64 {
+	n := len(regions)
+	if n > regionStatsSnapshotSampleSize {
+		n = regionStatsSnapshotSampleSize
+	}
+	ids := make([]uint64, n)
+	for i := 0; i < n; i++ {
+		ids[i] = regions[i].GetID()
+	}
+	return ids
+}
+
+// GetLastRegionStats returns the most recently computed RegionStatsSnapshot,
+// or nil if the background job hasn't run yet.
+func (c *RaftCluster) GetLastRegionStats() *RegionStatsSnapshot {
+	v, _ := c.lastRegionStats.Load().(*RegionStatsSnapshot)
+	return v
+}
+
+// IsLastRegionStatsEmpty reports whether the last computed snapshot has no
+// regions in any category, so a test can poll this instead of sleeping a
+// fixed duration for the background job to both run and find nothing wrong.
+func (c *RaftCluster) IsLastRegionStatsEmpty() bool {
+	return c.GetLastRegionStats().IsEmpty()
+}
@@ -0,0 +1,114 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/pingcap/log"
+	"github.com/tikv/pd/pkg/errs"
+	"github.com/tikv/pd/server/config"
+	"go.uber.org/zap"
+)
+
+// storeConfigURL is the path TiKV's status server answers with its own
+// config, coprocessor section included, as JSON.
+var storeConfigURL = "/config"
+
+// storeCoprocessorConfig is the subset of a TiKV /config response
+// syncStoreConfig reads. TiKV's actual response additionally covers many
+// other sections (raftstore, rocksdb, server, ...) nothing here cares
+// about; json.Unmarshal silently drops everything this struct doesn't
+// name, which is what's wanted.
+//
+// TiKV reports region-max-size/region-split-size as human-readable size
+// strings (e.g. "144MiB") in some versions and as plain numbers in others;
+// this source tree has no vendored TiKV client or ByteSize parser to
+// handle both, so only the plain-number form is read here. A store
+// reporting the string form fails json.Unmarshal for this struct and is
+// treated as unreachable, same as a connection failure - this function
+// just moves on to the next store.
+type storeCoprocessorConfig struct {
+	Coprocessor struct {
+		RegionMaxSize   uint64 `json:"region-max-size"`
+		RegionSplitSize uint64 `json:"region-split-size"`
+		RegionMaxKeys   uint64 `json:"region-max-keys"`
+		RegionSplitKeys uint64 `json:"region-split-keys"`
+	} `json:"coprocessor"`
+}
+
+// syncStoreConfig refreshes PersistOptions' StoreConfig from the first
+// reachable up store's reported coprocessor config, so PD's merge/split
+// thresholds can track a TiKV upgrade instead of requiring an operator to
+// edit both sides in lockstep. It leaves the current StoreConfig - the
+// last successful fetch, or the PD defaults if there's never been one -
+// alone when every store is unreachable, rather than resetting to
+// defaults on a transient outage.
+//
+// Only one store is queried per call: coprocessor config is a TiKV
+// binary-wide setting, not something that should legitimately differ
+// store to store, so the first answer is taken as authoritative instead
+// of querying every store just to throw away the duplicates.
+func (c *RaftCluster) syncStoreConfig() {
+	for _, store := range c.GetStores() {
+		if !store.IsUp() {
+			continue
+		}
+		statusAddr := store.GetMeta().GetStatusAddress()
+		if statusAddr == "" {
+			continue
+		}
+		cfg, err := c.fetchStoreConfig(statusAddr)
+		if err != nil {
+			log.Warn("failed to fetch store config", zap.Uint64("store-id", store.GetID()), zap.String("status-address", statusAddr), errs.ZapError(err))
+			continue
+		}
+		c.opt.SetStoreConfig(cfg)
+		if err := c.opt.PersistStoreConfig(c.storage); err != nil {
+			log.Warn("failed to persist store config", errs.ZapError(err))
+		}
+		return
+	}
+}
+
+func (c *RaftCluster) fetchStoreConfig(statusAddr string) (*config.StoreConfig, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), clientTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("http://%s%s", statusAddr, storeConfigURL), nil)
+	if err != nil {
+		log.Error("failed to new request", errs.ZapError(errs.ErrNewHTTPRequest, err))
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("store returned HTTP %d for %s", resp.StatusCode, storeConfigURL)
+	}
+	var raw storeCoprocessorConfig
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, err
+	}
+	return &config.StoreConfig{
+		RegionMaxSize:   raw.Coprocessor.RegionMaxSize,
+		RegionSplitSize: raw.Coprocessor.RegionSplitSize,
+		RegionMaxKeys:   raw.Coprocessor.RegionMaxKeys,
+		RegionSplitKeys: raw.Coprocessor.RegionSplitKeys,
+	}, nil
+}
@@ -0,0 +1,185 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pingcap/log"
+	"github.com/robfig/cron/v3"
+	"go.etcd.io/etcd/clientv3"
+	"go.uber.org/zap"
+
+	"github.com/tikv/pd/pkg/errs"
+	"github.com/tikv/pd/pkg/etcdutil"
+	"github.com/tikv/pd/server/schedule/storelimit"
+)
+
+// storeLimitHistoryPrefix is the etcd key prefix every StoreLimitRevision
+// is kept under, the same way etcdserver keeps its own membership change
+// records - an append-only audit trail a revision can be rolled back from,
+// rather than a log only the current value survives in.
+const storeLimitHistoryPrefix = "/pd/store-limit-history/"
+
+// StoreLimitRevision is one audited change to a store's limit.
+type StoreLimitRevision struct {
+	// Rev identifies this revision for RollbackStoreLimit. It's assigned
+	// from time.Now().UnixNano() at write time rather than from etcd's own
+	// mod-revision, so it stays meaningful even after the compaction
+	// goroutine below has pruned the record it would otherwise have been
+	// read back from.
+	Rev       int64
+	Timestamp time.Time
+	User      string
+	Type      string
+	StoreID   uint64
+	OldRate   float64
+	NewRate   float64
+}
+
+func storeLimitHistoryKey(storeID uint64, rev int64) string {
+	return fmt.Sprintf("%s%020d/%020d", storeLimitHistoryPrefix, storeID, rev)
+}
+
+// recordStoreLimitChange appends a StoreLimitRevision to the audit trail.
+// Failures are logged rather than returned: a store limit change that
+// already took effect in memory and in PersistOptions shouldn't be undone
+// just because its audit record couldn't be written.
+func (c *RaftCluster) recordStoreLimitChange(user, typ string, storeID uint64, oldRate, newRate float64) {
+	if c.etcdClient == nil {
+		return
+	}
+	record := StoreLimitRevision{
+		Rev:       time.Now().UnixNano(),
+		Timestamp: time.Now(),
+		User:      user,
+		Type:      typ,
+		StoreID:   storeID,
+		OldRate:   oldRate,
+		NewRate:   newRate,
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		log.Warn("failed to marshal store limit history record", errs.ZapError(err))
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), clientTimeout)
+	defer cancel()
+	if _, err := c.etcdClient.Put(ctx, storeLimitHistoryKey(storeID, record.Rev), string(data)); err != nil {
+		log.Warn("failed to persist store limit history", zap.Uint64("store-id", storeID), errs.ZapError(err))
+	}
+}
+
+// GetStoreLimitHistory returns storeID's limit.go change history, most
+// recent first, capped at limit entries.
+func (c *RaftCluster) GetStoreLimitHistory(storeID uint64, limit int) ([]*StoreLimitRevision, error) {
+	prefix := fmt.Sprintf("%s%020d/", storeLimitHistoryPrefix, storeID)
+	resp, err := etcdutil.EtcdKVGet(c.etcdClient, prefix, clientv3.WithPrefix(),
+		clientv3.WithSort(clientv3.SortByKey, clientv3.SortDescend), clientv3.WithLimit(int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]*StoreLimitRevision, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		record := &StoreLimitRevision{}
+		if err := json.Unmarshal(kv.Value, record); err != nil {
+			log.Warn("failed to unmarshal store limit history record", zap.ByteString("key", kv.Key), errs.ZapError(err))
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// RollbackStoreLimit restores the store limit a revision held before it was
+// changed, and records the rollback itself as a new revision so the undo is
+// part of the same audit trail rather than erasing what it undoes.
+//
+// It locates rev with a scan across every store's history rather than a
+// direct lookup, since the key a revision is stored under is keyed by
+// storeID first (for GetStoreLimitHistory's benefit) and the caller only
+// has rev. A secondary rev->storeID index would avoid the scan, but this
+// tree has no storage layer beyond etcd itself to keep one consistent in.
+func (c *RaftCluster) RollbackStoreLimit(rev int64) error {
+	resp, err := etcdutil.EtcdKVGet(c.etcdClient, storeLimitHistoryPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return err
+	}
+
+	for _, kv := range resp.Kvs {
+		record := &StoreLimitRevision{}
+		if err := json.Unmarshal(kv.Value, record); err != nil {
+			continue
+		}
+		if record.Rev != rev {
+			continue
+		}
+		typ, ok := storelimit.TypeNameValue[record.Type]
+		if !ok {
+			return errs.ErrUnknownStoreLimitType.FastGenByArgs(record.Type)
+		}
+		c.SetStoreLimit("rollback", record.StoreID, typ, record.OldRate)
+		return nil
+	}
+	return errs.ErrStoreLimitRevisionNotFound.FastGenByArgs(rev)
+}
+
+// runStoreLimitHistoryCompaction drives compactStoreLimitHistory on
+// cronExpr, trimming audit records older than retention, on the same
+// robfig/cron scheduling etcdsnapshot.Snapshotter uses for its backups.
+func (c *RaftCluster) runStoreLimitHistoryCompaction(cronExpr string, retention time.Duration) *cron.Cron {
+	if cronExpr == "" {
+		return nil
+	}
+	job := cron.New()
+	_, err := job.AddFunc(cronExpr, func() {
+		if err := c.compactStoreLimitHistory(retention); err != nil {
+			log.Warn("failed to compact store limit history", errs.ZapError(err))
+		}
+	})
+	if err != nil {
+		log.Warn("failed to schedule store limit history compaction", errs.ZapError(err))
+		return nil
+	}
+	job.Start()
+	return job
+}
+
+func (c *RaftCluster) compactStoreLimitHistory(retention time.Duration) error {
+	resp, err := etcdutil.EtcdKVGet(c.etcdClient, storeLimitHistoryPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-retention)
+	ctx, cancel := context.WithTimeout(context.Background(), clientTimeout)
+	defer cancel()
+	for _, kv := range resp.Kvs {
+		record := &StoreLimitRevision{}
+		if err := json.Unmarshal(kv.Value, record); err != nil {
+			continue
+		}
+		if record.Timestamp.After(cutoff) {
+			continue
+		}
+		if _, err := c.etcdClient.Delete(ctx, string(kv.Key)); err != nil {
+			log.Warn("failed to compact store limit history record", zap.ByteString("key", kv.Key), errs.ZapError(err))
+		}
+	}
+	return nil
+}
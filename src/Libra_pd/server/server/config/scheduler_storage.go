@@ -0,0 +1,79 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import "github.com/tikv/pd/server/core"
+
+// SchedulerConfigStorage is where an individual scheduler's persisted
+// payload (its SchedulerConfig - Type, Args, Disable) is saved and loaded,
+// independently of whatever else happens to ScheduleConfig at the same
+// time. AddSchedulerCfg/RemoveSchedulerCfg call it before returning,
+// replacing reliance on some later, separate Persist call to flush a
+// scheduler addition or removal: today a crash in between means the
+// scheduler silently disappears on restart.
+//
+// storageSchedulerConfigStorage, the only implementation below, saves a
+// scheduler's payload by synchronously persisting the whole config through
+// core.Storage.SaveConfig rather than to an independent per-scheduler key.
+// core.Storage is a concrete type defined outside this source tree, not an
+// interface this package can add a keyed Save/Load/Remove to, and
+// SaveConfig/LoadConfig on the whole Config is the only persistence
+// primitive on it this package has a confirmed call site for. That's
+// enough to close the crash window the request is about - saving now
+// happens inside the same call that mutates the in-memory slice, not in
+// some later, separate step - even though it doesn't give each scheduler an
+// independent storage key.
+//
+// "Scheduler-specific state such as evict-leader store list or
+// grant-hot-region config" isn't covered here: that state lives on each
+// scheduler's own config type in the server/schedulers package, which isn't
+// part of this source tree, so this package has no visibility into its
+// shape.
+type SchedulerConfigStorage interface {
+	SaveSchedulerConfig(tp string, cfg SchedulerConfig) error
+	LoadSchedulerConfig(tp string) (SchedulerConfig, bool)
+	RemoveSchedulerConfig(tp string) error
+}
+
+// storageSchedulerConfigStorage is SchedulerConfigStorage's only
+// implementation; see the interface's doc comment for why it persists by
+// saving the whole config rather than an independent per-scheduler key.
+type storageSchedulerConfigStorage struct {
+	opt     *PersistOptions
+	storage *core.Storage
+}
+
+// NewSchedulerConfigStorage returns the SchedulerConfigStorage
+// AddSchedulerCfg/RemoveSchedulerCfg should persist scheduler changes
+// through.
+func NewSchedulerConfigStorage(opt *PersistOptions, storage *core.Storage) SchedulerConfigStorage {
+	return &storageSchedulerConfigStorage{opt: opt, storage: storage}
+}
+
+func (s *storageSchedulerConfigStorage) SaveSchedulerConfig(tp string, cfg SchedulerConfig) error {
+	return s.opt.Persist(s.storage)
+}
+
+func (s *storageSchedulerConfigStorage) LoadSchedulerConfig(tp string) (SchedulerConfig, bool) {
+	for _, cfg := range s.opt.GetSchedulers() {
+		if cfg.Type == tp {
+			return cfg, true
+		}
+	}
+	return SchedulerConfig{}, false
+}
+
+func (s *storageSchedulerConfigStorage) RemoveSchedulerConfig(tp string) error {
+	return s.opt.Persist(s.storage)
+}
@@ -0,0 +1,136 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+
+	"github.com/tikv/pd/server/core"
+)
+
+// StoreConfig mirrors the handful of TiKV coprocessor settings that bound
+// how big a region is allowed to grow before TiKV itself splits it -
+// region-max-size, region-split-size, region-max-keys, region-split-keys.
+// PD's own merge/split thresholds (GetMaxMergeRegionSize and friends on
+// ScheduleConfig) are operator-set and can drift from what a given TiKV
+// binary actually enforces; a RaftCluster that keeps this in sync from
+// TiKV's reported config (see cluster.syncStoreConfig) lets PD's
+// thresholds track a TiKV upgrade automatically instead of requiring the
+// operator to edit both sides in lockstep.
+type StoreConfig struct {
+	RegionMaxSize   uint64
+	RegionSplitSize uint64
+	RegionMaxKeys   uint64
+	RegionSplitKeys uint64
+}
+
+// Sensible PD defaults, used until a sync against a real TiKV store
+// succeeds (or after a restart, until ReloadStoreConfig finds nothing
+// saved) - these match TiKV's own out-of-the-box coprocessor defaults, in
+// MB for the two size fields.
+const (
+	defaultRegionMaxSize   uint64 = 144
+	defaultRegionSplitSize uint64 = 96
+	defaultRegionMaxKeys   uint64 = 1440000
+	defaultRegionSplitKeys uint64 = 960000
+)
+
+func defaultStoreConfig() *StoreConfig {
+	return &StoreConfig{
+		RegionMaxSize:   defaultRegionMaxSize,
+		RegionSplitSize: defaultRegionSplitSize,
+		RegionMaxKeys:   defaultRegionMaxKeys,
+		RegionSplitKeys: defaultRegionSplitKeys,
+	}
+}
+
+// GetStoreConfig returns the last store-side config SetStoreConfig stored -
+// defaultStoreConfig's defaults until a sync against a real TiKV store, or
+// a ReloadStoreConfig against a previous sync's saved result, replaces it.
+func (o *PersistOptions) GetStoreConfig() *StoreConfig {
+	return o.storeConfig.Load().(*StoreConfig)
+}
+
+// SetStoreConfig replaces the store-side config, notifying WatchKeyStoreConfig
+// watchers the same way the Set*Config methods above notify watchers of
+// their own subtree. Config, defined outside this source tree, has no
+// StoreConfig field to carry the new value in oldCfg/newCfg, so a
+// WatchKeyStoreConfig callback that wants it should call GetStoreConfig
+// itself rather than look for it on newCfg.
+func (o *PersistOptions) SetStoreConfig(cfg *StoreConfig) {
+	before := o.snapshot()
+	o.storeConfig.Store(cfg)
+	o.watchSubtree(WatchKeyStoreConfig, before)
+}
+
+// GetRegionMaxSize returns the max region size, in MB, TiKV enforces
+// before splitting - the merge checker should prefer this over
+// GetMaxMergeRegionSize so merge decisions track what TiKV actually
+// enforces.
+func (o *PersistOptions) GetRegionMaxSize() uint64 {
+	return o.GetStoreConfig().RegionMaxSize
+}
+
+// GetRegionSplitSize returns the region size, in MB, TiKV splits a region
+// down to.
+func (o *PersistOptions) GetRegionSplitSize() uint64 {
+	return o.GetStoreConfig().RegionSplitSize
+}
+
+// GetRegionMaxKeys returns the max key count TiKV enforces before
+// splitting a region.
+func (o *PersistOptions) GetRegionMaxKeys() uint64 {
+	return o.GetStoreConfig().RegionMaxKeys
+}
+
+// GetRegionSplitKeys returns the key count TiKV splits a region down to.
+func (o *PersistOptions) GetRegionSplitKeys() uint64 {
+	return o.GetStoreConfig().RegionSplitKeys
+}
+
+// storeConfigStatePath is where PersistStoreConfig/ReloadStoreConfig keep
+// the last successfully-synced StoreConfig, reusing core.Storage's generic
+// Save/Load the same way RaftCluster already does for its own
+// raft_bootstrap_time marker, rather than a dedicated typed accessor
+// core.Storage doesn't have one of for this.
+const storeConfigStatePath = "store_config"
+
+// PersistStoreConfig saves the current store-side config to storage, so
+// ReloadStoreConfig can recover the last value a sync against a real TiKV
+// store actually produced after a PD restart, instead of GetStoreConfig
+// falling back to defaultStoreConfig's defaults until the sync loop's next
+// successful fetch.
+func (o *PersistOptions) PersistStoreConfig(storage *core.Storage) error {
+	data, err := json.Marshal(o.GetStoreConfig())
+	if err != nil {
+		return err
+	}
+	return storage.Save(storage.ClusterStatePath(storeConfigStatePath), string(data))
+}
+
+// ReloadStoreConfig restores the StoreConfig a previous PersistStoreConfig
+// call saved, if any. It's a no-op, leaving GetStoreConfig returning
+// whatever it already does, when nothing has been saved yet.
+func (o *PersistOptions) ReloadStoreConfig(storage *core.Storage) error {
+	data, err := storage.Load(storage.ClusterStatePath(storeConfigStatePath))
+	if err != nil || data == "" {
+		return err
+	}
+	cfg := &StoreConfig{}
+	if err := json.Unmarshal([]byte(data), cfg); err != nil {
+		return err
+	}
+	o.SetStoreConfig(cfg)
+	return nil
+}
@@ -0,0 +1,163 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import (
+	"sync"
+
+	"github.com/pingcap/kvproto/pkg/pdpb"
+	"github.com/pingcap/log"
+	"github.com/tikv/pd/server/core"
+	"github.com/tikv/pd/server/schedule/opt"
+	"go.uber.org/zap"
+)
+
+// CommandTransport delivers a single schedule command to the store hosting
+// region's leader. sendScheduleCommands goes through one of these instead of
+// calling hbStreams directly, so how a command reaches TiKV can differ per
+// store.
+type CommandTransport interface {
+	// Send delivers resp for region and reports whether it was accepted.
+	// A transport with no failure signal of its own (heartbeat piggyback)
+	// always returns true.
+	Send(region *core.RegionInfo, resp *pdpb.RegionHeartbeatResponse) bool
+}
+
+// BatchCommandTransport is an optional CommandTransport capability: a
+// transport able to deliver several commands for the same region in one
+// call may implement it so sendScheduleCommands can use it instead of
+// calling Send once per command.
+type BatchCommandTransport interface {
+	SendBatch(region *core.RegionInfo, resps []*pdpb.RegionHeartbeatResponse) bool
+}
+
+// heartbeatTransport is the original transport: it piggybacks the command on
+// the region's next heartbeat response via hbStreams. This is the only
+// transport available for a store until it both advertises the dedicated
+// push capability and has an open StreamCommandSender registered for it.
+type heartbeatTransport struct {
+	hbStreams opt.HeartbeatStreams
+}
+
+func (t *heartbeatTransport) Send(region *core.RegionInfo, resp *pdpb.RegionHeartbeatResponse) bool {
+	t.hbStreams.SendMsg(region, resp)
+	return true
+}
+
+// SendBatch delegates to hbStreams' own batching support when it has any
+// (see batchHeartbeatStreams), falling back to one SendMsg per response.
+func (t *heartbeatTransport) SendBatch(region *core.RegionInfo, resps []*pdpb.RegionHeartbeatResponse) bool {
+	if batcher, ok := t.hbStreams.(batchHeartbeatStreams); ok {
+		batcher.SendBatch(region, resps)
+		return true
+	}
+	for _, resp := range resps {
+		t.hbStreams.SendMsg(region, resp)
+	}
+	return true
+}
+
+// StreamCommandSender is a dedicated, server-initiated push stream to one
+// store, opened once the store advertises support for it in its heartbeat.
+// The stream itself (gRPC service, connection lifecycle) lives outside this
+// package; operator_controller.go depends only on this narrow interface.
+type StreamCommandSender interface {
+	// Send pushes resp down the stream. It returns an error once the stream
+	// is no longer usable (closed, store disconnected, ...), at which point
+	// streamTransport sends that one command by heartbeat piggyback instead.
+	// The stream stays registered, and is tried again for the next command,
+	// until SetStoreStream or SetStoreCapability clears it.
+	Send(resp *pdpb.RegionHeartbeatResponse) error
+}
+
+// streamTransport delivers commands over a dedicated per-store stream,
+// degrading to heartbeat piggyback the moment the stream errors. It is what
+// lets an urgent operator reach TiKV within tens of milliseconds instead of
+// waiting for the next heartbeat, which fastNotifyInterval otherwise bounds
+// at 2s.
+type streamTransport struct {
+	storeID  uint64
+	sender   StreamCommandSender
+	fallback CommandTransport
+}
+
+func (t *streamTransport) Send(region *core.RegionInfo, resp *pdpb.RegionHeartbeatResponse) bool {
+	if err := t.sender.Send(resp); err != nil {
+		log.Warn("dedicated command stream unavailable, falling back to heartbeat piggyback",
+			zap.Uint64("store-id", t.storeID), zap.Uint64("region-id", region.GetID()), zap.Error(err))
+		return t.fallback.Send(region, resp)
+	}
+	return true
+}
+
+// CommandTransportManager selects the CommandTransport to use for a store:
+// the dedicated stream once the store has registered one and advertised
+// support for it, heartbeat piggyback otherwise.
+type CommandTransportManager struct {
+	hbStreams opt.HeartbeatStreams
+
+	mu      sync.RWMutex
+	streams map[uint64]StreamCommandSender // storeID -> dedicated sender
+	capable map[uint64]bool                // storeID -> advertised dedicated-push support, from its heartbeat
+}
+
+// NewCommandTransportManager creates a manager that falls back to hbStreams
+// for any store without a registered, capable dedicated stream.
+func NewCommandTransportManager(hbStreams opt.HeartbeatStreams) *CommandTransportManager {
+	return &CommandTransportManager{
+		hbStreams: hbStreams,
+		streams:   make(map[uint64]StreamCommandSender),
+		capable:   make(map[uint64]bool),
+	}
+}
+
+// SetStoreCapability records whether storeID advertised support for the
+// dedicated push stream in its latest heartbeat. Called from the store
+// heartbeat handler.
+func (m *CommandTransportManager) SetStoreCapability(storeID uint64, capable bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.capable[storeID] = capable
+	if !capable {
+		delete(m.streams, storeID)
+	}
+}
+
+// SetStoreStream registers the dedicated push stream for storeID, or clears
+// it when sender is nil (e.g. once the stream disconnects).
+func (m *CommandTransportManager) SetStoreStream(storeID uint64, sender StreamCommandSender) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if sender == nil {
+		delete(m.streams, storeID)
+		return
+	}
+	m.streams[storeID] = sender
+}
+
+// transportFor returns the CommandTransport to use for storeID.
+func (m *CommandTransportManager) transportFor(storeID uint64) CommandTransport {
+	fallback := &heartbeatTransport{hbStreams: m.hbStreams}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if !m.capable[storeID] {
+		return fallback
+	}
+	sender, ok := m.streams[storeID]
+	if !ok {
+		return fallback
+	}
+	return &streamTransport{storeID: storeID, sender: sender, fallback: fallback}
+}
@@ -0,0 +1,48 @@
+// Copyright 2020 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import (
+	"fmt"
+
+	"github.com/pingcap/kvproto/pkg/pdpb"
+	"github.com/tikv/pd/server/core"
+	"github.com/tikv/pd/server/schedule/operator"
+	"github.com/tikv/pd/server/statistics"
+)
+
+// SplitOperatorWeight is the waiting-operator priority weight given to
+// OpSplit operators produced from hot-region detection, so they jump ahead
+// of the usual balance operators contending for the same region.
+const SplitOperatorWeight = 16.0
+
+// CreateSplitOperator builds an operator that asks the region's leader to
+// split it in two, instead of moving the leader or a peer off the hottest
+// store. splitKey, when non-empty, is the traffic-aware key
+// statistics.HotPeerStat.HottestBucketSplitKey picked (see
+// cluster.hotBucketSplitKey); the leader is told to split exactly there
+// instead of scanning for its own approximate middle key. The actual
+// region/peer ID allocation happens afterwards through the normal
+// HandleAskBatchSplit flow, once TiKV reports back with an AskBatchSplit
+// request for the hinted region.
+//
+// Exported for cluster.RaftCluster, which drives hot-region splitting
+// straight off the heartbeat path rather than a scheduler loop.
+func CreateSplitOperator(region *core.RegionInfo, kind statistics.FlowKind, splitKey []byte) (*operator.Operator, error) {
+	desc := fmt.Sprintf("hot-region-split-%s", kind.String())
+	if len(splitKey) == 0 {
+		return operator.CreateSplitRegionOperator(desc, region, operator.OpSplit, pdpb.CheckPolicy_APPROXIMATE, nil)
+	}
+	return operator.CreateSplitRegionOperator(desc, region, operator.OpSplit, pdpb.CheckPolicy_USEKEY, [][]byte{splitKey})
+}
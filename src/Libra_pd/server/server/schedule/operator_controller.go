@@ -17,7 +17,6 @@ import (
 	"container/heap"
 	"container/list"
 	"context"
-	"fmt"
 	"strconv"
 	"sync"
 	"time"
@@ -27,7 +26,7 @@ import (
 	"github.com/pingcap/kvproto/pkg/metapb"
 	"github.com/pingcap/kvproto/pkg/pdpb"
 	"github.com/pingcap/log"
-	"github.com/tikv/pd/pkg/cache"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/tikv/pd/pkg/errs"
 	"github.com/tikv/pd/server/core"
 	"github.com/tikv/pd/server/schedule/operator"
@@ -36,6 +35,65 @@ import (
 	"go.uber.org/zap"
 )
 
+// CancelReasonType is a typed reason an operator was canceled or removed. It
+// replaces the ad-hoc zap.Field varargs RemoveOperator/buryOperator used to
+// take, so the reason can also be persisted on the operator record and
+// reported through the operatorCancelCounter metric instead of only ending
+// up in a log line.
+type CancelReasonType string
+
+// The set of reasons RemoveOperator/buryOperator can report. The list is not
+// exhaustive: checkAddOperator returns a couple of additional, more specific
+// reasons for waiting-operator rejection below.
+const (
+	// RegionNotFound means the operator's region no longer exists in the cluster.
+	RegionNotFound CancelReasonType = "region-not-found"
+	// EpochNotMatch means the region's epoch has moved on since the operator was created.
+	EpochNotMatch CancelReasonType = "epoch-not-match"
+	// AlreadyExists means the region already has an operator of equal or higher priority.
+	AlreadyExists CancelReasonType = "already-exists"
+	// ExceedStoreLimit means a store touched by the operator is out of scheduling budget.
+	ExceedStoreLimit CancelReasonType = "exceed-store-limit"
+	// ExceedMaxWaiting means the region's waiting-operator queue is already full.
+	ExceedMaxWaiting CancelReasonType = "exceed-max-waiting"
+	// Expired means the operator sat too long without being promoted to running.
+	Expired CancelReasonType = "expired"
+	// StaleOp means the operator's region has changed underneath it in a way the operator can no longer account for.
+	StaleOp CancelReasonType = "stale-operator"
+	// Timeout means the operator did not finish its steps before its deadline.
+	Timeout CancelReasonType = "timeout"
+	// Replaced means a newer, higher-priority operator took over the region.
+	Replaced CancelReasonType = "replaced"
+	// Disappeared means the operator's region vanished from the cluster while waiting to be dispatched.
+	Disappeared CancelReasonType = "region-disappeared"
+	// Unexpected means the operator reached a status it should never reach during dispatch.
+	Unexpected CancelReasonType = "unexpected-status"
+)
+
+var operatorCancelCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "pd",
+		Subsystem: "schedule",
+		Name:      "operator_cancel_total",
+		Help:      "Counter of operators canceled or removed, by operator descriptor and cancel reason.",
+	}, []string{"operator_desc", "cancel_reason"})
+
+// pushIntervalGauge reports the adaptive interval getNextPushOperatorTime
+// currently computes for a given store and operator kind, derived from the
+// EWMA of recent step-completion times on that store.
+var pushIntervalGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: "pd",
+		Subsystem: "schedule",
+		Name:      "push_interval_seconds",
+		Help:      "Adaptive interval between active pushes of an unfinished operator's step, by store and operator kind.",
+	}, []string{"store", "kind"})
+
+func init() {
+	prometheus.MustRegister(operatorCancelCounter)
+	prometheus.MustRegister(pushIntervalGauge)
+}
+
 // The source of dispatched region.
 const (
 	DispatchFromHeartBeat     = "heartbeat"
@@ -49,43 +107,219 @@ var (
 	fastNotifyInterval = 2 * time.Second
 	// PushOperatorTickInterval is the interval try to push the operator.
 	PushOperatorTickInterval = 500 * time.Millisecond
-	// StoreBalanceBaseTime represents the base time of balance rate.
-	StoreBalanceBaseTime float64 = 60
 )
 
+// storeLimitSecondsPerMinute is the unit conversion between
+// GetStoreLimitByType's per-minute rate (the unit PersistOptions and, in
+// turn, cluster.RaftCluster's SetStoreLimit/SetAllStoresLimit persist and
+// expose it in) and the per-second rate guardedStoreLimit's token bucket
+// runs on. Ideally this conversion would live on PersistOptions itself, next
+// to GetStoreLimitByType, so every caller saw one unified per-second unit
+// instead of converting at the point of use; it can't move there because
+// oc.cluster.GetOpts() returns opt.Config, an interface defined outside
+// this tree that this package can't add a method to. storeLimitRatePerSecond
+// below is the one place this conversion happens.
+const storeLimitSecondsPerMinute float64 = 60
+
+// storeLimitRatePerSecond converts ratePerMin, a store limit rate in
+// PersistOptions' persisted per-minute unit, to the per-second rate
+// newStoreLimitLocked and guardedStoreLimit expect.
+func storeLimitRatePerSecond(ratePerMin float64) float64 {
+	return ratePerMin / storeLimitSecondsPerMinute
+}
+
 // OperatorController is used to limit the speed of scheduling.
+//
+// Each piece of state used to live behind the single embedded RWMutex, which
+// meant Dispatch — called once per region heartbeat — serialized heartbeats
+// cluster-wide for the duration of its check/send pipeline. operators is now
+// a sync.Map so GetOperator's hot-path read never blocks, counts is updated
+// incrementally by incCount/decCount under its own countsMu instead of being
+// rebuilt by ranging operators on every add/remove, and the waiting-operator
+// queue (wop/wopStatus) and opNotifierQueue each claim their own lock
+// instead of sharing one. The embedded RWMutex still guards the storesLimit
+// map structure itself (adding/removing a store's entry) and histories, but
+// each *storelimit.StoreLimit in storesLimit is now behind its own
+// guardedStoreLimit lock, so getOrCreateStoreLimit resetting one store's
+// rate doesn't contend with OperatorCount or GetOpInfluence reading a
+// different store's. snapStoresLimit and snapshotAdmitted have their own
+// snapLimitMu instead of sharing the embedded lock at all: checkSnapshotLimit
+// runs on every Dispatch, so serializing it behind the same lock Dispatch's
+// other state claims would reintroduce the cluster-wide heartbeat
+// contention the rest of this split was written to eliminate. installMu is
+// narrower still: it only guards addOperator's read-compare-evict-store
+// sequence (see addOperator), the one piece of the old single-lock
+// check-and-install that genuinely needs to stay atomic; the heartbeat path
+// takes it only when Dispatch promotes a waiting operator.
 type OperatorController struct {
 	sync.RWMutex
-	ctx             context.Context
-	cluster         opt.Cluster
-	operators       map[uint64]*operator.Operator
-	hbStreams       opt.HeartbeatStreams
-	histories       *list.List
-	counts          map[operator.OpKind]uint64
-	opRecords       *OperatorRecords
-	storesLimit     map[uint64]map[storelimit.Type]*storelimit.StoreLimit
-	wop             WaitingOperator
-	wopStatus       *WaitingOperatorStatus
-	opNotifierQueue operatorQueue
+	ctx              context.Context
+	cluster          opt.Cluster
+	operators        sync.Map // map[uint64]*operator.Operator, keyed by region id
+	hbStreams        opt.HeartbeatStreams
+	histories        *list.List
+	countsMu         sync.Mutex
+	counts           map[operator.OpKind]uint64
+	opRecords        *OperatorRecords
+	installMu        sync.Mutex
+	storesLimit      map[uint64]map[storelimit.Type]*guardedStoreLimit
+	snapLimitMu      sync.RWMutex
+	snapStoresLimit  map[uint64]map[SnapLimitType]*storelimit.StoreLimit
+	snapshotAdmitted map[uint64]snapshotAdmission
+	wopMu            sync.Mutex
+	wop              WaitingOperator
+	wopStatus        *WaitingOperatorStatus
+	priorityWeight   []float64
+	queueMu          sync.Mutex
+	opNotifierQueue  operatorQueue
+	pushIntervalMu   sync.Mutex
+	pushIntervalEWMA map[pushIntervalKey]time.Duration
+	stepTimingMu     sync.Mutex
+	stepTimings      map[uint64]stepTiming
+	cmdBatchMu       sync.Mutex
+	cmdBatches       map[uint64]*pendingCommandBatch
+	transport        *CommandTransportManager
+}
+
+// batchHeartbeatStreams is an optional capability of opt.HeartbeatStreams
+// (defined outside this package): an implementation that can send several
+// RegionHeartbeatResponses for the same region in one RPC may implement it
+// to let sendScheduleCommands batch instead of sending one SendMsg per step.
+// It is detected with a type assertion rather than added to the
+// opt.HeartbeatStreams interface itself, so existing implementations that
+// don't support batching keep working unchanged.
+type batchHeartbeatStreams interface {
+	SendBatch(region *core.RegionInfo, resps []*pdpb.RegionHeartbeatResponse)
+}
+
+// coalesceWindow bounds how long sendScheduleCommand buffers a coalescable
+// step (see coalescableStep) for a region before flushing it, waiting for
+// adjacent steps of a joint-consensus or leader-transfer operator to become
+// ready so they can be sent together.
+const coalesceWindow = 50 * time.Millisecond
+
+// pendingCommandBatch accumulates the coalescable schedule commands built
+// for a single region while its buffer is open.
+type pendingCommandBatch struct {
+	region *core.RegionInfo
+	cmds   []*pdpb.RegionHeartbeatResponse
+	opened time.Time
+}
+
+// coalescableStep reports whether step belongs to a joint-consensus or
+// leader-transfer sequence, the cases worth delaying briefly so adjacent
+// steps on the same region can be sent in one RegionHeartbeatResponse batch.
+func coalescableStep(step operator.OpStep) bool {
+	switch step.(type) {
+	case operator.ChangePeerV2Enter, operator.ChangePeerV2Leave, operator.TransferLeader:
+		return true
+	default:
+		return false
+	}
+}
+
+// pushIntervalKey identifies an (operator kind, store) pair that
+// pushIntervalEWMA tracks a step-completion EWMA for.
+type pushIntervalKey struct {
+	kind    operator.OpKind
+	storeID uint64
 }
 
+const (
+	// pushIntervalMin/pushIntervalMax bound the adaptive push interval
+	// getNextPushOperatorTime computes, regardless of how slow or fast a
+	// store's recent step completions have been.
+	pushIntervalMin = 500 * time.Millisecond
+	pushIntervalMax = 30 * time.Second
+	// pushIntervalFactor (k) scales a step-completion EWMA into a push
+	// interval: pushing sooner than a step typically finishes just adds
+	// heartbeat pressure without getting the step done any faster.
+	pushIntervalFactor = 1.2
+	// pushIntervalEWMAAlpha weights the newest sample against history.
+	pushIntervalEWMAAlpha = 0.3
+)
+
+func clampPushInterval(d time.Duration) time.Duration {
+	switch {
+	case d < pushIntervalMin:
+		return pushIntervalMin
+	case d > pushIntervalMax:
+		return pushIntervalMax
+	default:
+		return d
+	}
+}
+
+// pushIntervalKeyFor builds the EWMA key for op, using its region's current
+// leader store as the representative store. It returns ok=false when the
+// region or its leader can't be resolved, in which case the caller should
+// fall back to a fixed interval.
+func pushIntervalKeyFor(op *operator.Operator, region *core.RegionInfo) (key pushIntervalKey, ok bool) {
+	if region == nil || region.GetLeader() == nil {
+		return pushIntervalKey{}, false
+	}
+	return pushIntervalKey{kind: op.Kind(), storeID: region.GetLeader().GetStoreId()}, true
+}
+
+// DefaultPriorityWeight is the waiting-operator priority-bucket weight
+// vector handed to wop at construction time, one entry per priority level
+// from lowest to highest. The last entry reuses SplitOperatorWeight so the
+// split fast-path and the highest waiting-operator bucket stay consistent.
+var DefaultPriorityWeight = []float64{1, 4, 9, SplitOperatorWeight}
+
 // NewOperatorController creates a OperatorController.
 func NewOperatorController(ctx context.Context, cluster opt.Cluster, hbStreams opt.HeartbeatStreams) *OperatorController {
 	return &OperatorController{
-		ctx:             ctx,
-		cluster:         cluster,
-		operators:       make(map[uint64]*operator.Operator),
-		hbStreams:       hbStreams,
-		histories:       list.New(),
-		counts:          make(map[operator.OpKind]uint64),
-		opRecords:       NewOperatorRecords(ctx),
-		storesLimit:     make(map[uint64]map[storelimit.Type]*storelimit.StoreLimit),
-		wop:             NewRandBuckets(),
-		wopStatus:       NewWaitingOperatorStatus(),
-		opNotifierQueue: make(operatorQueue, 0),
+		ctx:              ctx,
+		cluster:          cluster,
+		hbStreams:        hbStreams,
+		histories:        list.New(),
+		counts:           make(map[operator.OpKind]uint64),
+		opRecords:        NewOperatorRecords(ctx),
+		storesLimit:      make(map[uint64]map[storelimit.Type]*guardedStoreLimit),
+		snapStoresLimit:  make(map[uint64]map[SnapLimitType]*storelimit.StoreLimit),
+		snapshotAdmitted: make(map[uint64]snapshotAdmission),
+		wop:              NewRandBuckets(),
+		wopStatus:        NewWaitingOperatorStatus(),
+		priorityWeight:   DefaultPriorityWeight,
+		opNotifierQueue:  make(operatorQueue, 0),
+		pushIntervalEWMA: make(map[pushIntervalKey]time.Duration),
+		stepTimings:      make(map[uint64]stepTiming),
+		cmdBatches:       make(map[uint64]*pendingCommandBatch),
+		transport:        NewCommandTransportManager(hbStreams),
 	}
 }
 
+// Transport returns the CommandTransportManager used to deliver schedule
+// commands, so the store heartbeat handler can register a store's dedicated
+// push stream and capability once it is set up.
+func (oc *OperatorController) Transport() *CommandTransportManager {
+	return oc.transport
+}
+
+// SetPriorityWeight sets the priority-bucket weight vector used when
+// distributing waiting operators, one entry per priority level from lowest
+// to highest. It is exposed so the PD config/HTTP API can tune it.
+//
+// NOTE: wiring this vector into wop's bucket selection requires a setter on
+// WaitingOperator/RandBuckets, which live in waiting_operator.go — not part
+// of this source tree. Until that file gains such a setter, changing this
+// field only affects what GetPriorityWeight reports, not wop's actual
+// bucket distribution.
+func (oc *OperatorController) SetPriorityWeight(weight []float64) {
+	oc.Lock()
+	defer oc.Unlock()
+	oc.priorityWeight = weight
+}
+
+// GetPriorityWeight returns the priority-bucket weight vector currently
+// configured. See SetPriorityWeight for its current limitations.
+func (oc *OperatorController) GetPriorityWeight() []float64 {
+	oc.RLock()
+	defer oc.RUnlock()
+	return oc.priorityWeight
+}
+
 // Ctx returns a context which will be canceled once RaftCluster is stopped.
 // For now, it is only used to control the lifetime of TTL cache in schedulers.
 func (oc *OperatorController) Ctx() context.Context {
@@ -115,6 +349,7 @@ func (oc *OperatorController) Dispatch(region *core.RegionInfo, source string) {
 		switch op.Status() {
 		case operator.STARTED:
 			operatorCounter.WithLabelValues(op.Desc(), "check").Inc()
+			oc.recordStepTransition(op, region, step)
 			if source == DispatchFromHeartBeat && oc.checkStaleOperator(op, step, region) {
 				return
 			}
@@ -141,7 +376,7 @@ func (oc *OperatorController) Dispatch(region *core.RegionInfo, source string) {
 					panic(op)
 				})
 				_ = op.Cancel()
-				oc.buryOperator(op)
+				oc.buryOperator(op, Unexpected)
 				oc.PromoteWaitingOperator()
 			}
 		}
@@ -151,7 +386,9 @@ func (oc *OperatorController) Dispatch(region *core.RegionInfo, source string) {
 func (oc *OperatorController) checkStaleOperator(op *operator.Operator, step operator.OpStep, region *core.RegionInfo) bool {
 	err := step.CheckSafety(region)
 	if err != nil {
-		if oc.RemoveOperator(op, zap.String("reason", err.Error())) {
+		log.Info("operator step is no longer safe, marking stale",
+			zap.Uint64("region-id", op.RegionID()), zap.Error(err))
+		if oc.RemoveOperator(op, StaleOp) {
 			operatorCounter.WithLabelValues(op.Desc(), "stale").Inc()
 			oc.PromoteWaitingOperator()
 			return true
@@ -165,12 +402,11 @@ func (oc *OperatorController) checkStaleOperator(op *operator.Operator, step ope
 	latest := region.GetRegionEpoch()
 	changes := latest.GetConfVer() - origin.GetConfVer()
 	if changes > op.ConfVerChanged(region) {
-		if oc.RemoveOperator(
-			op,
-			zap.String("reason", "stale operator, confver does not meet expectations"),
+		log.Info("stale operator, confver does not meet expectations",
+			zap.Uint64("region-id", op.RegionID()),
 			zap.Reflect("latest-epoch", region.GetRegionEpoch()),
-			zap.Uint64("diff", changes),
-		) {
+			zap.Uint64("diff", changes))
+		if oc.RemoveOperator(op, StaleOp) {
 			operatorCounter.WithLabelValues(op.Desc(), "stale").Inc()
 			oc.PromoteWaitingOperator()
 			return true
@@ -180,7 +416,45 @@ func (oc *OperatorController) checkStaleOperator(op *operator.Operator, step ope
 	return false
 }
 
-func (oc *OperatorController) getNextPushOperatorTime(step operator.OpStep, now time.Time) time.Time {
+// checkOperatorLightly is a cheap pre-dispatch check for an operator about
+// to be popped off opNotifierQueue. Unlike checkStaleOperator, which runs
+// CheckSafety against a step that is actually about to be sent, this only
+// asks whether the region is still one the operator can reconcile at all.
+// It returns RegionNotFound whenever GetRegion returns nil, and EpochNotMatch
+// when the region's conf version has moved on further than op accounts for;
+// the caller cancels the operator whenever a reason comes back non-empty.
+func (oc *OperatorController) checkOperatorLightly(op *operator.Operator) (region *core.RegionInfo, reason CancelReasonType) {
+	region = oc.cluster.GetRegion(op.RegionID())
+	if region == nil {
+		return nil, RegionNotFound
+	}
+	origin := op.RegionEpoch()
+	latest := region.GetRegionEpoch()
+	changes := latest.GetConfVer() - origin.GetConfVer()
+	if changes > op.ConfVerChanged(region) {
+		return region, EpochNotMatch
+	}
+	return region, ""
+}
+
+// getNextPushOperatorTime decides when PushOperators should next actively
+// push this operator's step. It prefers the EWMA of recent step-completion
+// times for this operator's kind on region's leader store, scaled by
+// pushIntervalFactor and clamped to [pushIntervalMin, pushIntervalMax]: a
+// store that has been slow to finish steps gets pushed less often, easing
+// heartbeat pressure, and a fast one gets pushed more aggressively. Until an
+// EWMA sample exists for that (kind, store) pair, it falls back to the
+// original fixed fast/slow interval keyed on step type.
+func (oc *OperatorController) getNextPushOperatorTime(op *operator.Operator, region *core.RegionInfo, step operator.OpStep, now time.Time) time.Time {
+	if key, ok := pushIntervalKeyFor(op, region); ok {
+		oc.pushIntervalMu.Lock()
+		ewma, seen := oc.pushIntervalEWMA[key]
+		oc.pushIntervalMu.Unlock()
+		if seen {
+			return now.Add(clampPushInterval(time.Duration(float64(ewma) * pushIntervalFactor)))
+		}
+	}
+
 	nextTime := slowNotifyInterval
 	switch step.(type) {
 	case operator.TransferLeader, operator.PromoteLearner, operator.DemoteFollower, operator.ChangePeerV2Enter, operator.ChangePeerV2Leave:
@@ -189,46 +463,145 @@ func (oc *OperatorController) getNextPushOperatorTime(step operator.OpStep, now
 	return now.Add(nextTime)
 }
 
+// stepTiming records when the step currently being dispatched for a region
+// started, so its actual completion time - not the whole operator's running
+// time - is what gets folded into pushIntervalEWMA.
+type stepTiming struct {
+	sig   string
+	start time.Time
+}
+
+// recordStepTransition notes that step is now the one being dispatched for
+// op's region. The first time a given step is seen it is just timestamped;
+// once Dispatch (or addOperator, for an operator's very first step) reports
+// a different step - meaning the previous one finished - its elapsed time is
+// folded into the push-interval EWMA before timing switches to the new step.
+// This is what makes a multi-step operator (region merge, joint-consensus
+// peer changes, split) contribute one sample per step instead of a single
+// sample inflated by the whole operator's running time.
+func (oc *OperatorController) recordStepTransition(op *operator.Operator, region *core.RegionInfo, step operator.OpStep) {
+	if step == nil {
+		return
+	}
+	sig := step.String()
+	regionID := op.RegionID()
+	now := time.Now()
+
+	oc.stepTimingMu.Lock()
+	prev, ok := oc.stepTimings[regionID]
+	if ok && prev.sig == sig {
+		oc.stepTimingMu.Unlock()
+		return
+	}
+	oc.stepTimings[regionID] = stepTiming{sig: sig, start: now}
+	oc.stepTimingMu.Unlock()
+
+	if ok {
+		oc.recordPushInterval(op, region, now.Sub(prev.start))
+	}
+}
+
+// clearStepTiming forgets regionID's in-progress step timing, so a later
+// operator on the same region doesn't have its first step's duration folded
+// in against a start time left over from one that already finished.
+func (oc *OperatorController) clearStepTiming(regionID uint64) {
+	oc.stepTimingMu.Lock()
+	defer oc.stepTimingMu.Unlock()
+	delete(oc.stepTimings, regionID)
+}
+
+// recordPushInterval folds sample - one step's actual completion duration -
+// into the step-completion EWMA for op's kind and region-leader store, and
+// republishes the resulting push interval to pushIntervalGauge.
+func (oc *OperatorController) recordPushInterval(op *operator.Operator, region *core.RegionInfo, sample time.Duration) {
+	key, ok := pushIntervalKeyFor(op, region)
+	if !ok {
+		return
+	}
+
+	oc.pushIntervalMu.Lock()
+	ewma, seen := oc.pushIntervalEWMA[key]
+	if !seen {
+		ewma = sample
+	} else {
+		ewma = time.Duration(pushIntervalEWMAAlpha*float64(sample) + (1-pushIntervalEWMAAlpha)*float64(ewma))
+	}
+	oc.pushIntervalEWMA[key] = ewma
+	oc.pushIntervalMu.Unlock()
+
+	pushIntervalGauge.WithLabelValues(strconv.FormatUint(key.storeID, 10), op.Kind().String()).
+		Set(clampPushInterval(time.Duration(float64(ewma) * pushIntervalFactor)).Seconds())
+}
+
+// recordStepDuration folds the duration of op's final step into the
+// step-completion EWMA and forgets this region's step timing. Called once an
+// operator reaches SUCCESS: that transition is observed via op.Check/Status
+// rather than another recordStepTransition call (Dispatch's SUCCESS branch
+// never reaches SendScheduleCommand), so the last step's elapsed time would
+// otherwise never get folded in.
+func (oc *OperatorController) recordStepDuration(op *operator.Operator) {
+	regionID := op.RegionID()
+
+	oc.stepTimingMu.Lock()
+	timing, ok := oc.stepTimings[regionID]
+	delete(oc.stepTimings, regionID)
+	oc.stepTimingMu.Unlock()
+	if !ok {
+		return
+	}
+
+	region := oc.cluster.GetRegion(regionID)
+	oc.recordPushInterval(op, region, time.Since(timing.start))
+}
+
 // pollNeedDispatchRegion returns the region need to dispatch,
 // "next" is true to indicate that it may exist in next attempt,
 // and false is the end for the poll.
 func (oc *OperatorController) pollNeedDispatchRegion() (r *core.RegionInfo, next bool) {
-	oc.Lock()
-	defer oc.Unlock()
+	oc.queueMu.Lock()
 	if oc.opNotifierQueue.Len() == 0 {
+		oc.queueMu.Unlock()
 		return nil, false
 	}
 	item := heap.Pop(&oc.opNotifierQueue).(*operatorWithTime)
+	oc.queueMu.Unlock()
+
 	regionID := item.op.RegionID()
-	op, ok := oc.operators[regionID]
-	if !ok || op == nil {
+	op := oc.GetOperator(regionID)
+	if op == nil {
 		return nil, true
 	}
-	r = oc.cluster.GetRegion(regionID)
-	if r == nil {
+	region, reason := oc.checkOperatorLightly(op)
+	if reason != "" {
 		_ = oc.removeOperatorLocked(op)
 		if op.Cancel() {
-			log.Warn("remove operator because region disappeared",
+			log.Warn("remove operator because of failed re-check",
 				zap.Uint64("region-id", op.RegionID()),
+				zap.String("reason", string(reason)),
 				zap.Stringer("operator", op))
 			operatorCounter.WithLabelValues(op.Desc(), "disappear").Inc()
 		}
-		oc.buryOperator(op)
+		oc.buryOperator(op, reason)
 		return nil, true
 	}
+	r = region
 	step := op.Check(r)
 	if step == nil {
 		return r, true
 	}
 	now := time.Now()
 	if now.Before(item.time) {
+		oc.queueMu.Lock()
 		heap.Push(&oc.opNotifierQueue, item)
+		oc.queueMu.Unlock()
 		return nil, false
 	}
 
 	// pushes with new notify time.
-	item.time = oc.getNextPushOperatorTime(step, now)
+	item.time = oc.getNextPushOperatorTime(op, region, step, now)
+	oc.queueMu.Lock()
 	heap.Push(&oc.opNotifierQueue, item)
+	oc.queueMu.Unlock()
 	return r, true
 }
 
@@ -245,11 +618,35 @@ func (oc *OperatorController) PushOperators() {
 
 		oc.Dispatch(r, DispatchFromNotifierQueue)
 	}
+	oc.FlushStaleScheduleCommands()
+	oc.pruneTimedOutOperators()
+}
+
+// pruneTimedOutOperators removes every running operator whose deadline has
+// passed. GetOpInfluence used to be the only thing that ever asked an
+// operator whether it had timed out, via CheckTimeout — on an O(n) range
+// over every running operator, on every call. Running the same check here
+// instead, once per PushOperators tick (every PushOperatorTickInterval),
+// means a timed-out operator is usually gone from oc.operators well before
+// GetOpInfluence's next range sees it, instead of GetOpInfluence itself
+// discovering and accounting for the timeout on every single call.
+func (oc *OperatorController) pruneTimedOutOperators() {
+	var timedOut []*operator.Operator
+	oc.operators.Range(func(_, v interface{}) bool {
+		op := v.(*operator.Operator)
+		if op.CheckTimeout() {
+			timedOut = append(timedOut, op)
+		}
+		return true
+	})
+	for _, op := range timedOut {
+		oc.RemoveOperator(op, Timeout)
+	}
 }
 
 // AddWaitingOperator adds operators to waiting operators.
 func (oc *OperatorController) AddWaitingOperator(ops ...*operator.Operator) int {
-	oc.Lock()
+	oc.wopMu.Lock()
 	added := 0
 
 	for i := 0; i < len(ops); i++ {
@@ -260,27 +657,27 @@ func (oc *OperatorController) AddWaitingOperator(ops ...*operator.Operator) int
 			if i+1 >= len(ops) {
 				// should not be here forever
 				log.Error("orphan merge operators found", zap.String("desc", desc), errs.ZapError(errs.ErrMergeOperator.FastGenByArgs("orphan operator found")))
-				oc.Unlock()
+				oc.wopMu.Unlock()
 				return added
 			}
 			if ops[i+1].Kind()&operator.OpMerge == 0 {
 				log.Error("merge operator should be paired", zap.String("desc",
 					ops[i+1].Desc()), errs.ZapError(errs.ErrMergeOperator.FastGenByArgs("operator should be paired")))
-				oc.Unlock()
+				oc.wopMu.Unlock()
 				return added
 			}
 			isMerge = true
 		}
-		if !oc.checkAddOperator(op) {
+		if reason := oc.checkAddOperator(op); reason != "" {
 			_ = op.Cancel()
-			oc.buryOperator(op)
+			oc.buryOperator(op, reason)
 			if isMerge {
 				// Merge operation have two operators, cancel them all
 				next := ops[i+1]
 				_ = next.Cancel()
-				oc.buryOperator(next)
+				oc.buryOperator(next, reason)
 			}
-			oc.Unlock()
+			oc.wopMu.Unlock()
 			oc.PromoteWaitingOperator()
 			return added
 		}
@@ -297,26 +694,31 @@ func (oc *OperatorController) AddWaitingOperator(ops ...*operator.Operator) int
 		added++
 	}
 
-	oc.Unlock()
+	oc.wopMu.Unlock()
 	oc.PromoteWaitingOperator()
 	return added
 }
 
 // AddOperator adds operators to the running operators.
 func (oc *OperatorController) AddOperator(ops ...*operator.Operator) bool {
-	oc.Lock()
-	defer oc.Unlock()
-
-	if oc.exceedStoreLimit(ops...) || !oc.checkAddOperator(ops...) {
+	reason := CancelReasonType("")
+	if oc.exceedStoreLimit(ops...) {
+		reason = ExceedStoreLimit
+	} else {
+		oc.wopMu.Lock()
+		reason = oc.checkAddOperator(ops...)
+		oc.wopMu.Unlock()
+	}
+	if reason != "" {
 		for _, op := range ops {
 			operatorCounter.WithLabelValues(op.Desc(), "cancel").Inc()
 			_ = op.Cancel()
-			oc.buryOperator(op)
+			oc.buryOperator(op, reason)
 		}
 		return false
 	}
 	for _, op := range ops {
-		if !oc.addOperatorLocked(op) {
+		if !oc.addOperator(op) {
 			return false
 		}
 	}
@@ -325,8 +727,7 @@ func (oc *OperatorController) AddOperator(ops ...*operator.Operator) bool {
 
 // PromoteWaitingOperator promotes operators from waiting operators.
 func (oc *OperatorController) PromoteWaitingOperator() {
-	oc.Lock()
-	defer oc.Unlock()
+	oc.wopMu.Lock()
 	var retOps []*operator.Operator
 	for {
 		// GetOperator returns one operator or two merge operators
@@ -335,17 +736,24 @@ func (oc *OperatorController) PromoteWaitingOperator() {
 			if len(retOps) != 0 { // process split operator
 				break
 			} else {
+				oc.wopMu.Unlock()
 				return
 			}
 		}
 		operatorWaitCounter.WithLabelValues(ops[0].Desc(), "get").Inc()
 		retOps = append(retOps, ops...)
 
-		if oc.exceedStoreLimit(ops...) || !oc.checkAddOperator(ops...) {
+		reason := CancelReasonType("")
+		if oc.exceedStoreLimit(ops...) {
+			reason = ExceedStoreLimit
+		} else {
+			reason = oc.checkAddOperator(ops...)
+		}
+		if reason != "" {
 			for _, op := range ops {
 				operatorWaitCounter.WithLabelValues(op.Desc(), "promote_canceled").Inc()
 				_ = op.Cancel()
-				oc.buryOperator(op)
+				oc.buryOperator(op, reason)
 			}
 			oc.wopStatus.ops[ops[0].Desc()]--
 			continue
@@ -362,29 +770,35 @@ func (oc *OperatorController) PromoteWaitingOperator() {
 			break
 		}
 	}
+	oc.wopMu.Unlock()
 
 	for _, op := range retOps {
-		if !oc.addOperatorLocked(op) {
+		if !oc.addOperator(op) {
 			break
 		}
 	}
 }
 
-// checkAddOperator checks if the operator can be added.
-// There are several situations that cannot be added:
+// checkAddOperator checks if the operator can be added, returning the typed
+// reason it cannot ("" if it can). There are several situations that cannot
+// be added:
 // - There is no such region in the cluster
 // - The epoch of the operator and the epoch of the corresponding region are no longer consistent.
 // - The region already has a higher priority or same priority operator.
 // - Exceed the max number of waiting operators
 // - At least one operator is expired.
-func (oc *OperatorController) checkAddOperator(ops ...*operator.Operator) bool {
+//
+// checkAddOperator reads wopStatus, so callers must hold wopMu: AddOperator
+// and PromoteWaitingOperator take it explicitly around the call, and
+// AddWaitingOperator already holds it while iterating.
+func (oc *OperatorController) checkAddOperator(ops ...*operator.Operator) CancelReasonType {
 	for _, op := range ops {
 		region := oc.cluster.GetRegion(op.RegionID())
 		if region == nil {
 			log.Info("region not found, cancel add operator",
 				zap.Uint64("region-id", op.RegionID()))
 			operatorWaitCounter.WithLabelValues(op.Desc(), "add_canceled").Inc()
-			return false
+			return RegionNotFound
 		}
 		if region.GetRegionEpoch().GetVersion() != op.RegionEpoch().GetVersion() ||
 			region.GetRegionEpoch().GetConfVer() != op.RegionEpoch().GetConfVer() {
@@ -393,14 +807,14 @@ func (oc *OperatorController) checkAddOperator(ops ...*operator.Operator) bool {
 				zap.Reflect("old", region.GetRegionEpoch()),
 				zap.Reflect("new", op.RegionEpoch()))
 			operatorWaitCounter.WithLabelValues(op.Desc(), "add_canceled").Inc()
-			return false
+			return EpochNotMatch
 		}
-		if old := oc.operators[op.RegionID()]; old != nil && !isHigherPriorityOperator(op, old) {
+		if old := oc.GetOperator(op.RegionID()); old != nil && !isHigherPriorityOperator(op, old) {
 			log.Info("already have operator, cancel add operator",
 				zap.Uint64("region-id", op.RegionID()),
 				zap.Reflect("old", old))
 			operatorWaitCounter.WithLabelValues(op.Desc(), "add_canceled").Inc()
-			return false
+			return AlreadyExists
 		}
 		if op.Status() != operator.CREATED {
 			log.Error("trying to add operator with unexpected status",
@@ -411,44 +825,80 @@ func (oc *OperatorController) checkAddOperator(ops ...*operator.Operator) bool {
 				panic(op)
 			})
 			operatorWaitCounter.WithLabelValues(op.Desc(), "add_canceled").Inc()
-			return false
+			return Unexpected
 		}
 		if oc.wopStatus.ops[op.Desc()] >= oc.cluster.GetOpts().GetSchedulerMaxWaitingOperator() {
 			log.Info("exceed_max return false", zap.Uint64("waiting", oc.wopStatus.ops[op.Desc()]), zap.String("desc", op.Desc()), zap.Uint64("max", oc.cluster.GetOpts().GetSchedulerMaxWaitingOperator()))
 			operatorWaitCounter.WithLabelValues(op.Desc(), "exceed_max").Inc()
-			return false
+			return ExceedMaxWaiting
 		}
 	}
-	expired := false
 	for _, op := range ops {
 		if op.CheckExpired() {
-			expired = true
 			operatorWaitCounter.WithLabelValues(op.Desc(), "add_canceled").Inc()
+			return Expired
 		}
 	}
-	return !expired
+	return ""
 }
 
+// isHigherPriorityOperator compares two operators' priority levels directly,
+// so an Urgent-priority operator (used by disaster-recovery schedulers such
+// as down-peer replace and learner-promote-for-missing-voter) already
+// preempts a running High-priority operator on the same region once the
+// Urgent level is defined on operator.Operator — that enum lives in the
+// operator package, outside this source tree, so it isn't added here.
 func isHigherPriorityOperator(new, old *operator.Operator) bool {
 	return new.GetPriorityLevel() > old.GetPriorityLevel()
 }
 
-func (oc *OperatorController) addOperatorLocked(op *operator.Operator) bool {
+// addOperator installs op as the running operator for its region, replacing
+// whatever was there before. Unlike the old addOperatorLocked, it no longer
+// runs under one caller-held lock for its entire body: each heavier substep
+// below claims only the lock it actually needs (storesLimit, opNotifierQueue,
+// counts). The read-compare-evict-store sequence at the top is the exception:
+// it stays under installMu, because checkAddOperator's priority check (run by
+// AddOperator/PromoteWaitingOperator under wopMu, which is released before
+// addOperator is ever called) only validates op against whatever old
+// operator happened to be installed at check time. Without installMu here,
+// two concurrent AddOperator/PromoteWaitingOperator calls for the same
+// region - a normal occurrence, since multiple schedulers can propose
+// operators for the same region on the same heartbeat - could each pass
+// that check against the same old operator and then race to install here,
+// letting whichever wins silently clobber a higher-priority operator the
+// other had just installed with no priority comparison at all.
+func (oc *OperatorController) addOperator(op *operator.Operator) bool {
 	regionID := op.RegionID()
 
 	log.Info("add operator",
 		zap.Uint64("region-id", regionID),
 		zap.Reflect("operator", op))
 
-	// If there is an old operator, replace it. The priority should be checked
-	// already.
-	if old, ok := oc.operators[regionID]; ok {
+	oc.installMu.Lock()
+	// Re-validate priority against whatever is actually installed right
+	// now, not the "old" checkAddOperator saw earlier under wopMu - that
+	// check and this install are no longer atomic with each other, so only
+	// this re-check, done atomically with the Store below, can still
+	// guarantee a lower-or-equal priority operator never replaces one a
+	// concurrent caller just installed.
+	if old := oc.GetOperator(regionID); old != nil {
+		if !isHigherPriorityOperator(op, old) {
+			oc.installMu.Unlock()
+			log.Info("already have operator, cancel add operator",
+				zap.Uint64("region-id", regionID),
+				zap.Reflect("old", old), zap.Reflect("new", op))
+			operatorCounter.WithLabelValues(op.Desc(), "cancel").Inc()
+			_ = op.Cancel()
+			oc.buryOperator(op, AlreadyExists)
+			return false
+		}
 		_ = oc.removeOperatorLocked(old)
 		_ = old.Replace()
-		oc.buryOperator(old)
+		oc.buryOperator(old, Replaced)
 	}
 
 	if !op.Start() {
+		oc.installMu.Unlock()
 		log.Error("adding operator with unexpected status",
 			zap.Uint64("region-id", regionID),
 			zap.String("status", operator.OpStatusToString(op.Status())),
@@ -459,10 +909,12 @@ func (oc *OperatorController) addOperatorLocked(op *operator.Operator) bool {
 		operatorCounter.WithLabelValues(op.Desc(), "unexpected").Inc()
 		return false
 	}
-	oc.operators[regionID] = op
+	oc.operators.Store(regionID, op)
+	oc.installMu.Unlock()
 	operatorCounter.WithLabelValues(op.Desc(), "start").Inc()
 	operatorWaitDuration.WithLabelValues(op.Desc()).Observe(op.ElapsedTime().Seconds())
 	opInfluence := NewTotalOpInfluence([]*operator.Operator{op}, oc.cluster)
+	oc.Lock()
 	for storeID := range opInfluence.StoresInfluence {
 		if oc.storesLimit[storeID] == nil {
 			continue
@@ -476,20 +928,25 @@ func (oc *OperatorController) addOperatorLocked(op *operator.Operator) bool {
 			if stepCost == 0 {
 				continue
 			}
-			storeLimit.Take(stepCost)
+			storeLimit.take(stepCost)
 			storeLimitCostCounter.WithLabelValues(strconv.FormatUint(storeID, 10), n).Add(float64(stepCost) / float64(storelimit.RegionInfluence[v]))
 		}
 	}
-	oc.updateCounts(oc.operators)
+	oc.Unlock()
+	oc.incCount(op.Kind())
 
 	var step operator.OpStep
-	if region := oc.cluster.GetRegion(op.RegionID()); region != nil {
+	region := oc.cluster.GetRegion(op.RegionID())
+	if region != nil {
 		if step = op.Check(region); step != nil {
+			oc.recordStepTransition(op, region, step)
 			oc.SendScheduleCommand(region, step, DispatchFromCreate)
 		}
 	}
 
-	heap.Push(&oc.opNotifierQueue, &operatorWithTime{op: op, time: oc.getNextPushOperatorTime(step, time.Now())})
+	oc.queueMu.Lock()
+	heap.Push(&oc.opNotifierQueue, &operatorWithTime{op: op, time: oc.getNextPushOperatorTime(op, region, step, time.Now())})
+	oc.queueMu.Unlock()
 	operatorCounter.WithLabelValues(op.Desc(), "create").Inc()
 	for _, counter := range op.Counters {
 		counter.Inc()
@@ -497,11 +954,12 @@ func (oc *OperatorController) addOperatorLocked(op *operator.Operator) bool {
 	return true
 }
 
-// RemoveOperator removes a operator from the running operators.
-func (oc *OperatorController) RemoveOperator(op *operator.Operator, extraFields ...zap.Field) bool {
-	oc.Lock()
+// RemoveOperator removes a operator from the running operators. reason is
+// recorded on the bury record and the operatorCancelCounter metric; it may
+// be omitted ("") when the removal is not itself a cancellation (e.g. the
+// operator already finished successfully).
+func (oc *OperatorController) RemoveOperator(op *operator.Operator, reasons ...CancelReasonType) bool {
 	removed := oc.removeOperatorLocked(op)
-	oc.Unlock()
 	if removed {
 		if op.Cancel() {
 			log.Info("operator removed",
@@ -509,29 +967,36 @@ func (oc *OperatorController) RemoveOperator(op *operator.Operator, extraFields
 				zap.Duration("takes", op.RunningTime()),
 				zap.Reflect("operator", op))
 		}
-		oc.buryOperator(op, extraFields...)
+		oc.buryOperator(op, reasons...)
 	}
 	return removed
 }
 
 func (oc *OperatorController) removeOperatorWithoutBury(op *operator.Operator) bool {
-	oc.Lock()
-	defer oc.Unlock()
 	return oc.removeOperatorLocked(op)
 }
 
+// removeOperatorLocked deletes op from the running operators if it is still
+// the current operator for its region. The name is a holdover from when this
+// ran under the caller's lock; it now does its own synchronization.
 func (oc *OperatorController) removeOperatorLocked(op *operator.Operator) bool {
 	regionID := op.RegionID()
-	if cur := oc.operators[regionID]; cur == op {
-		delete(oc.operators, regionID)
-		oc.updateCounts(oc.operators)
+	if curv, ok := oc.operators.Load(regionID); ok && curv.(*operator.Operator) == op {
+		oc.operators.Delete(regionID)
+		oc.decCount(op.Kind())
+		oc.clearSnapshotAdmission(regionID)
+		oc.clearStepTiming(regionID)
 		operatorCounter.WithLabelValues(op.Desc(), "remove").Inc()
 		return true
 	}
 	return false
 }
 
-func (oc *OperatorController) buryOperator(op *operator.Operator, extraFields ...zap.Field) {
+// buryOperator records the final disposition of an operator that has
+// reached an end status. reason is only meaningful for operator.CANCELED: it
+// names why the operator was canceled or removed, and drives the
+// operatorCancelCounter metric so the cause is visible without grepping logs.
+func (oc *OperatorController) buryOperator(op *operator.Operator, reasons ...CancelReasonType) {
 	st := op.Status()
 
 	if !operator.IsEndStatus(st) {
@@ -573,16 +1038,17 @@ func (oc *OperatorController) buryOperator(op *operator.Operator, extraFields ..
 			zap.Reflect("operator", op))
 		operatorCounter.WithLabelValues(op.Desc(), "timeout").Inc()
 	case operator.CANCELED:
-		fields := []zap.Field{
+		var reason CancelReasonType
+		if len(reasons) > 0 {
+			reason = reasons[0]
+		}
+		log.Info("operator canceled",
 			zap.Uint64("region-id", op.RegionID()),
 			zap.Duration("takes", op.RunningTime()),
 			zap.Reflect("operator", op),
-		}
-		fields = append(fields, extraFields...)
-		log.Info("operator canceled",
-			fields...,
-		)
+			zap.String("reason", string(reason)))
 		operatorCounter.WithLabelValues(op.Desc(), "cancel").Inc()
+		operatorCancelCounter.WithLabelValues(op.Desc(), string(reason)).Inc()
 	}
 
 	oc.opRecords.Put(op)
@@ -590,38 +1056,37 @@ func (oc *OperatorController) buryOperator(op *operator.Operator, extraFields ..
 
 // GetOperatorStatus gets the operator and its status with the specify id.
 func (oc *OperatorController) GetOperatorStatus(id uint64) *OperatorWithStatus {
-	oc.Lock()
-	defer oc.Unlock()
-	if op, ok := oc.operators[id]; ok {
+	if op := oc.GetOperator(id); op != nil {
 		return NewOperatorWithStatus(op)
 	}
 	return oc.opRecords.Get(id)
 }
 
-// GetOperator gets a operator from the given region.
+// GetOperator gets a operator from the given region. This is the hot path
+// driven by every region heartbeat, so it must never block behind Dispatch,
+// AddOperator, or PromoteWaitingOperator: operators is a sync.Map precisely
+// so this read is lock-free.
 func (oc *OperatorController) GetOperator(regionID uint64) *operator.Operator {
-	oc.RLock()
-	defer oc.RUnlock()
-	return oc.operators[regionID]
+	if opv, ok := oc.operators.Load(regionID); ok {
+		return opv.(*operator.Operator)
+	}
+	return nil
 }
 
 // GetOperators gets operators from the running operators.
 func (oc *OperatorController) GetOperators() []*operator.Operator {
-	oc.RLock()
-	defer oc.RUnlock()
-
-	operators := make([]*operator.Operator, 0, len(oc.operators))
-	for _, op := range oc.operators {
-		operators = append(operators, op)
-	}
-
+	operators := make([]*operator.Operator, 0)
+	oc.operators.Range(func(_, v interface{}) bool {
+		operators = append(operators, v.(*operator.Operator))
+		return true
+	})
 	return operators
 }
 
 // GetWaitingOperators gets operators from the waiting operators.
 func (oc *OperatorController) GetWaitingOperators() []*operator.Operator {
-	oc.RLock()
-	defer oc.RUnlock()
+	oc.wopMu.Lock()
+	defer oc.wopMu.Unlock()
 	return oc.wop.ListOperator()
 }
 
@@ -632,6 +1097,32 @@ func (oc *OperatorController) SendScheduleCommand(region *core.RegionInfo, step
 		zap.Stringer("step", step),
 		zap.String("source", source))
 
+	cmd := oc.buildScheduleCommand(region, step)
+	if cmd == nil {
+		return
+	}
+
+	if !oc.checkSnapshotLimit(region, step) {
+		log.Info("snapshot bandwidth limit reached, deferring step",
+			zap.Uint64("region-id", region.GetID()),
+			zap.Stringer("step", step))
+		return
+	}
+
+	if coalescableStep(step) {
+		oc.enqueueScheduleCommand(region, cmd)
+		return
+	}
+	// A non-coalescable step must not overtake commands already buffered
+	// for this region, so flush them first to preserve ordering.
+	oc.flushScheduleCommands(region.GetID())
+	oc.sendScheduleCommands(region, []*pdpb.RegionHeartbeatResponse{cmd})
+}
+
+// buildScheduleCommand translates step into the RegionHeartbeatResponse that
+// tells the region's leader to execute it, or nil when the step should not
+// be sent yet (e.g. a pending peer) or at all (e.g. a passive merge side).
+func (oc *OperatorController) buildScheduleCommand(region *core.RegionInfo, step operator.OpStep) *pdpb.RegionHeartbeatResponse {
 	var cmd *pdpb.RegionHeartbeatResponse
 	switch st := step.(type) {
 	case operator.TransferLeader:
@@ -643,7 +1134,7 @@ func (oc *OperatorController) SendScheduleCommand(region *core.RegionInfo, step
 	case operator.AddPeer:
 		if region.GetStorePeer(st.ToStore) != nil {
 			// The newly added peer is pending.
-			return
+			return nil
 		}
 		cmd = &pdpb.RegionHeartbeatResponse{
 			ChangePeer: &pdpb.ChangePeer{
@@ -658,7 +1149,7 @@ func (oc *OperatorController) SendScheduleCommand(region *core.RegionInfo, step
 	case operator.AddLightPeer:
 		if region.GetStorePeer(st.ToStore) != nil {
 			// The newly added peer is pending.
-			return
+			return nil
 		}
 		cmd = &pdpb.RegionHeartbeatResponse{
 			ChangePeer: &pdpb.ChangePeer{
@@ -673,7 +1164,7 @@ func (oc *OperatorController) SendScheduleCommand(region *core.RegionInfo, step
 	case operator.AddLearner:
 		if region.GetStorePeer(st.ToStore) != nil {
 			// The newly added peer is pending.
-			return
+			return nil
 		}
 		cmd = &pdpb.RegionHeartbeatResponse{
 			ChangePeer: &pdpb.ChangePeer{
@@ -688,7 +1179,7 @@ func (oc *OperatorController) SendScheduleCommand(region *core.RegionInfo, step
 	case operator.AddLightLearner:
 		if region.GetStorePeer(st.ToStore) != nil {
 			// The newly added peer is pending.
-			return
+			return nil
 		}
 		cmd = &pdpb.RegionHeartbeatResponse{
 			ChangePeer: &pdpb.ChangePeer{
@@ -733,7 +1224,7 @@ func (oc *OperatorController) SendScheduleCommand(region *core.RegionInfo, step
 		}
 	case operator.MergeRegion:
 		if st.IsPassive {
-			return
+			return nil
 		}
 		cmd = &pdpb.RegionHeartbeatResponse{
 			Merge: &pdpb.Merge{
@@ -758,12 +1249,96 @@ func (oc *OperatorController) SendScheduleCommand(region *core.RegionInfo, step
 		}
 	default:
 		log.Error("unknown operator step", zap.Reflect("step", step), errs.ZapError(errs.ErrUnknownOperatorStep))
+		return nil
+	}
+	return cmd
+}
+
+// enqueueScheduleCommand buffers cmd for region instead of sending it right
+// away, so a following coalescable step for the same region, if it arrives
+// within coalesceWindow, can be sent alongside it in one sendScheduleCommands
+// call. The buffer is flushed immediately once it has been open that long.
+func (oc *OperatorController) enqueueScheduleCommand(region *core.RegionInfo, cmd *pdpb.RegionHeartbeatResponse) {
+	regionID := region.GetID()
+
+	oc.cmdBatchMu.Lock()
+	batch, ok := oc.cmdBatches[regionID]
+	if !ok {
+		batch = &pendingCommandBatch{opened: time.Now()}
+		oc.cmdBatches[regionID] = batch
+	}
+	batch.region = region
+	batch.cmds = append(batch.cmds, cmd)
+	expired := time.Since(batch.opened) >= coalesceWindow
+	oc.cmdBatchMu.Unlock()
+
+	if expired {
+		oc.flushScheduleCommands(regionID)
+	}
+}
+
+// flushScheduleCommands sends and clears whatever is buffered for regionID,
+// if anything. It is a no-op when the region has no open buffer.
+func (oc *OperatorController) flushScheduleCommands(regionID uint64) {
+	oc.cmdBatchMu.Lock()
+	batch, ok := oc.cmdBatches[regionID]
+	delete(oc.cmdBatches, regionID)
+	oc.cmdBatchMu.Unlock()
+
+	if !ok {
+		return
+	}
+	oc.sendScheduleCommands(batch.region, batch.cmds)
+}
+
+// FlushStaleScheduleCommands flushes every coalescing buffer that has been
+// open for at least coalesceWindow. PushOperators calls it once per sweep so
+// a region whose only coalescable step arrived just before the window
+// closed still gets sent promptly, even though no later step triggered
+// enqueueScheduleCommand's own expiry check.
+func (oc *OperatorController) FlushStaleScheduleCommands() {
+	oc.cmdBatchMu.Lock()
+	var stale []uint64
+	now := time.Now()
+	for regionID, batch := range oc.cmdBatches {
+		if now.Sub(batch.opened) >= coalesceWindow {
+			stale = append(stale, regionID)
+		}
+	}
+	oc.cmdBatchMu.Unlock()
+
+	for _, regionID := range stale {
+		oc.flushScheduleCommands(regionID)
+	}
+}
+
+// sendScheduleCommands delivers cmds for region through the CommandTransport
+// selected for the store hosting its leader: the dedicated push stream when
+// the store advertised and registered one, heartbeat piggyback otherwise
+// (see CommandTransportManager). When that transport also implements
+// BatchCommandTransport, all of cmds go out as a single call.
+func (oc *OperatorController) sendScheduleCommands(region *core.RegionInfo, cmds []*pdpb.RegionHeartbeatResponse) {
+	if len(cmds) == 0 {
 		return
 	}
-	oc.hbStreams.SendMsg(region, cmd)
+	transport := oc.transport.transportFor(region.GetLeader().GetStoreId())
+	if batcher, ok := transport.(BatchCommandTransport); ok {
+		if batcher.SendBatch(region, cmds) {
+			return
+		}
+	}
+	for _, cmd := range cmds {
+		transport.Send(region, cmd)
+	}
 }
 
+// pushHistory is only called once an operator has reached SUCCESS, so it
+// also folds its final step's completion time into the push-interval EWMA
+// (see getNextPushOperatorTime/recordStepDuration) alongside recording its
+// step history.
 func (oc *OperatorController) pushHistory(op *operator.Operator) {
+	oc.recordStepDuration(op)
+
 	oc.Lock()
 	defer oc.Unlock()
 	for _, h := range op.History() {
@@ -798,20 +1373,43 @@ func (oc *OperatorController) GetHistory(start time.Time) []operator.OpHistory {
 	return histories
 }
 
-// updateCounts updates resource counts using current pending operators.
-func (oc *OperatorController) updateCounts(operators map[uint64]*operator.Operator) {
-	for k := range oc.counts {
-		delete(oc.counts, k)
-	}
-	for _, op := range operators {
-		oc.counts[op.Kind()]++
+// updateCounts recomputes per-kind operator counts from the operators
+// currently running. It takes countsMu itself, so callers don't need to hold
+// any other lock to call it. Only SetOperator, the test-only helper that
+// doesn't know whether it replaced an existing operator, still needs a full
+// rebuild; addOperator/removeOperatorLocked use incCount/decCount instead so
+// a single add or remove doesn't cost a full sync.Map range.
+func (oc *OperatorController) updateCounts() {
+	counts := make(map[operator.OpKind]uint64)
+	oc.operators.Range(func(_, v interface{}) bool {
+		counts[v.(*operator.Operator).Kind()]++
+		return true
+	})
+	oc.countsMu.Lock()
+	oc.counts = counts
+	oc.countsMu.Unlock()
+}
+
+// incCount increments the running count for kind by one.
+func (oc *OperatorController) incCount(kind operator.OpKind) {
+	oc.countsMu.Lock()
+	oc.counts[kind]++
+	oc.countsMu.Unlock()
+}
+
+// decCount decrements the running count for kind by one.
+func (oc *OperatorController) decCount(kind operator.OpKind) {
+	oc.countsMu.Lock()
+	if oc.counts[kind] > 0 {
+		oc.counts[kind]--
 	}
+	oc.countsMu.Unlock()
 }
 
 // OperatorCount gets the count of operators filtered by mask.
 func (oc *OperatorController) OperatorCount(mask operator.OpKind) uint64 {
-	oc.RLock()
-	defer oc.RUnlock()
+	oc.countsMu.Lock()
+	defer oc.countsMu.Unlock()
 	var total uint64
 	for k, count := range oc.counts {
 		if k&mask != 0 {
@@ -826,16 +1424,16 @@ func (oc *OperatorController) GetOpInfluence(cluster opt.Cluster) operator.OpInf
 	influence := operator.OpInfluence{
 		StoresInfluence: make(map[uint64]*operator.StoreInfluence),
 	}
-	oc.RLock()
-	defer oc.RUnlock()
-	for _, op := range oc.operators {
+	oc.operators.Range(func(_, v interface{}) bool {
+		op := v.(*operator.Operator)
 		if !op.CheckTimeout() && !op.CheckSuccess() {
 			region := cluster.GetRegion(op.RegionID())
 			if region != nil {
 				op.UnfinishedInfluence(influence, region)
 			}
 		}
-	}
+		return true
+	})
 	return influence
 }
 
@@ -857,63 +1455,34 @@ func NewTotalOpInfluence(operators []*operator.Operator, cluster opt.Cluster) op
 
 // SetOperator is only used for test.
 func (oc *OperatorController) SetOperator(op *operator.Operator) {
-	oc.Lock()
-	defer oc.Unlock()
-	oc.operators[op.RegionID()] = op
-	oc.updateCounts(oc.operators)
+	oc.operators.Store(op.RegionID(), op)
+	oc.updateCounts()
 }
 
-// OperatorWithStatus records the operator and its status.
-type OperatorWithStatus struct {
-	Op     *operator.Operator
-	Status pdpb.OperatorStatus
-}
-
-// NewOperatorWithStatus creates an OperatorStatus from an operator.
-func NewOperatorWithStatus(op *operator.Operator) *OperatorWithStatus {
-	return &OperatorWithStatus{
-		Op:     op,
-		Status: operator.OpStatusToPDPB(op.Status()),
-	}
-}
-
-// MarshalJSON returns the status of operator as a JSON string
-func (o *OperatorWithStatus) MarshalJSON() ([]byte, error) {
-	return []byte(`"` + fmt.Sprintf("status: %s, operator: %s", o.Status.String(), o.Op.String()) + `"`), nil
-}
-
-// OperatorRecords remains the operator and its status for a while.
-type OperatorRecords struct {
-	ttl *cache.TTLUint64
-}
-
-const operatorStatusRemainTime = 10 * time.Minute
-
-// NewOperatorRecords returns a OperatorRecords.
-func NewOperatorRecords(ctx context.Context) *OperatorRecords {
-	return &OperatorRecords{
-		ttl: cache.NewIDTTL(ctx, time.Minute, operatorStatusRemainTime),
-	}
-}
-
-// Get gets the operator and its status.
-func (o *OperatorRecords) Get(id uint64) *OperatorWithStatus {
-	v, exist := o.ttl.Get(id)
-	if !exist {
-		return nil
-	}
-	return v.(*OperatorWithStatus)
-}
-
-// Put puts the operator and its status.
-func (o *OperatorRecords) Put(op *operator.Operator) {
-	id := op.RegionID()
-	record := NewOperatorWithStatus(op)
-	o.ttl.Put(id, record)
-}
+// OperatorWithStatus, OperatorRecords, and the storage behind them now live
+// in operator_records.go, which also covers region-id/kind/status/time-range
+// filtering for a records-listing endpoint; it does not filter by store id.
 
 // exceedStoreLimit returns true if the store exceeds the cost limit after adding the operator. Otherwise, returns false.
+//
+// This used to rely on AddOperator/PromoteWaitingOperator holding the
+// controller-wide lock for the duration of the check; now that those callers
+// no longer serialize on one lock, it takes the lock itself around
+// storesLimit access.
+//
+// ops is treated as a single priority-homogeneous admission: all of ops
+// share the same operator.PriorityLevel (merge operators are admitted in
+// pairs, a split in up to four at once), so ops[0]'s level decides whether
+// this admission may draw on a store's reserved budget (see
+// guardedStoreLimit.available).
 func (oc *OperatorController) exceedStoreLimit(ops ...*operator.Operator) bool {
+	if len(ops) == 0 {
+		return false
+	}
+	priority := ops[0].GetPriorityLevel()
+
+	oc.Lock()
+	defer oc.Unlock()
 	opInfluence := NewTotalOpInfluence(ops, oc.cluster)
 	for storeID := range opInfluence.StoresInfluence {
 		for _, v := range storelimit.TypeNameValue {
@@ -921,7 +1490,7 @@ func (oc *OperatorController) exceedStoreLimit(ops ...*operator.Operator) bool {
 			if stepCost == 0 {
 				continue
 			}
-			if oc.getOrCreateStoreLimit(storeID, v).Available() < stepCost {
+			if !oc.getOrCreateStoreLimitLocked(storeID, v).available(stepCost, storelimit.RegionInfluence[v], priority) {
 				return true
 			}
 		}
@@ -929,32 +1498,38 @@ func (oc *OperatorController) exceedStoreLimit(ops ...*operator.Operator) bool {
 	return false
 }
 
-// newStoreLimit is used to create the limit of a store.
-func (oc *OperatorController) newStoreLimit(storeID uint64, ratePerSec float64, limitType storelimit.Type) {
+// newStoreLimitLocked is used to create the limit of a store. Callers must
+// hold oc.Lock().
+func (oc *OperatorController) newStoreLimitLocked(storeID uint64, ratePerSec float64, limitType storelimit.Type) {
 	log.Info("create or update a store limit", zap.Uint64("store-id", storeID), zap.String("type", limitType.String()), zap.Float64("rate", ratePerSec))
 	if oc.storesLimit[storeID] == nil {
-		oc.storesLimit[storeID] = make(map[storelimit.Type]*storelimit.StoreLimit)
+		oc.storesLimit[storeID] = make(map[storelimit.Type]*guardedStoreLimit)
+	}
+	if existing := oc.storesLimit[storeID][limitType]; existing != nil {
+		existing.reset(ratePerSec, storelimit.RegionInfluence[limitType])
+		return
 	}
-	oc.storesLimit[storeID][limitType] = storelimit.NewStoreLimit(ratePerSec, storelimit.RegionInfluence[limitType])
+	oc.storesLimit[storeID][limitType] = newGuardedStoreLimit(ratePerSec, storelimit.RegionInfluence[limitType])
 }
 
-// getOrCreateStoreLimit is used to get or create the limit of a store.
-func (oc *OperatorController) getOrCreateStoreLimit(storeID uint64, limitType storelimit.Type) *storelimit.StoreLimit {
+// getOrCreateStoreLimitLocked is used to get or create the limit of a store.
+// Callers must hold oc.Lock().
+func (oc *OperatorController) getOrCreateStoreLimitLocked(storeID uint64, limitType storelimit.Type) *guardedStoreLimit {
 	if oc.storesLimit[storeID][limitType] == nil {
-		ratePerSec := oc.cluster.GetOpts().GetStoreLimitByType(storeID, limitType) / StoreBalanceBaseTime
-		oc.newStoreLimit(storeID, ratePerSec, limitType)
+		ratePerSec := storeLimitRatePerSecond(oc.cluster.GetOpts().GetStoreLimitByType(storeID, limitType))
+		oc.newStoreLimitLocked(storeID, ratePerSec, limitType)
 		oc.cluster.AttachAvailableFunc(storeID, limitType, func() bool {
 			oc.RLock()
 			defer oc.RUnlock()
 			if oc.storesLimit[storeID][limitType] == nil {
 				return true
 			}
-			return oc.storesLimit[storeID][limitType].Available() >= storelimit.RegionInfluence[limitType]
+			return oc.storesLimit[storeID][limitType].rawAvailable() >= storelimit.RegionInfluence[limitType]
 		})
 	}
-	ratePerSec := oc.cluster.GetOpts().GetStoreLimitByType(storeID, limitType) / StoreBalanceBaseTime
-	if ratePerSec != oc.storesLimit[storeID][limitType].Rate() {
-		oc.newStoreLimit(storeID, ratePerSec, limitType)
+	ratePerSec := storeLimitRatePerSecond(oc.cluster.GetOpts().GetStoreLimitByType(storeID, limitType))
+	if ratePerSec != oc.storesLimit[storeID][limitType].rate() {
+		oc.newStoreLimitLocked(storeID, ratePerSec, limitType)
 	}
 	return oc.storesLimit[storeID][limitType]
 }
@@ -967,7 +1542,11 @@ func (oc *OperatorController) GetLeaderSchedulePolicy() core.SchedulePolicy {
 	return oc.cluster.GetOpts().GetLeaderSchedulePolicy()
 }
 
-// CollectStoreLimitMetrics collects the metrics about store limit
+// CollectStoreLimitMetrics collects the metrics about store limit.
+// storeLimitRateGauge reports storeLimit.rate() directly, the unified
+// per-second unit storeLimitRatePerSecond converts every store limit rate
+// to, rather than converting it back to the per-minute unit
+// GetStoreLimitByType persists it in.
 func (oc *OperatorController) CollectStoreLimitMetrics() {
 	oc.RLock()
 	defer oc.RUnlock()
@@ -980,15 +1559,15 @@ func (oc *OperatorController) CollectStoreLimitMetrics() {
 			storeID := store.GetID()
 			storeIDStr := strconv.FormatUint(storeID, 10)
 			for n, v := range storelimit.TypeNameValue {
-				var storeLimit *storelimit.StoreLimit
+				var storeLimit *guardedStoreLimit
 				if oc.storesLimit[storeID] == nil || oc.storesLimit[storeID][v] == nil {
 					// Set to 0 to represent the store limit of the specific type is not initialized.
 					storeLimitRateGauge.WithLabelValues(storeIDStr, n).Set(0)
 					continue
 				}
 				storeLimit = oc.storesLimit[storeID][v]
-				storeLimitAvailableGauge.WithLabelValues(storeIDStr, n).Set(float64(storeLimit.Available()) / float64(storelimit.RegionInfluence[v]))
-				storeLimitRateGauge.WithLabelValues(storeIDStr, n).Set(storeLimit.Rate() * StoreBalanceBaseTime)
+				storeLimitAvailableGauge.WithLabelValues(storeIDStr, n).Set(float64(storeLimit.rawAvailable()) / float64(storelimit.RegionInfluence[v]))
+				storeLimitRateGauge.WithLabelValues(storeIDStr, n).Set(storeLimit.rate())
 			}
 		}
 	}
@@ -0,0 +1,234 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pingcap/kvproto/pkg/pdpb"
+	"github.com/tikv/pd/pkg/cache"
+	"github.com/tikv/pd/server/schedule/operator"
+)
+
+// OperatorWithStatus records the operator and its status.
+type OperatorWithStatus struct {
+	Op     *operator.Operator
+	Status pdpb.OperatorStatus
+
+	// CreateTime and FinishTime are only populated once the operator has
+	// reached a terminal status: OperatorRecords.Put stamps them when it
+	// files the record away, but GetOperatorStatus's live lookups construct
+	// an OperatorWithStatus for an operator that's still running, so they're
+	// left zero there.
+	CreateTime time.Time
+	FinishTime time.Time
+}
+
+// NewOperatorWithStatus creates an OperatorStatus from an operator.
+func NewOperatorWithStatus(op *operator.Operator) *OperatorWithStatus {
+	return &OperatorWithStatus{
+		Op:     op,
+		Status: operator.OpStatusToPDPB(op.Status()),
+	}
+}
+
+// operatorRecordJSON is OperatorWithStatus's wire format. It replaces the
+// previous MarshalJSON, which packed everything into one opaque
+// "status: X, operator: Y" string, with individually addressable fields so
+// a records-listing endpoint can filter and sort on them directly instead of
+// parsing free text.
+type operatorRecordJSON struct {
+	RegionID uint64 `json:"region_id"`
+	Kind     string `json:"kind"`
+	Status   string `json:"status"`
+	// Steps is the step portion of operator.Operator's own String()
+	// rendering. operator.Operator, defined outside this tree, doesn't
+	// expose a way to enumerate its steps as individual typed values here
+	// (no confirmed Len()/Step(i) accessor), so this is text rather than the
+	// list of typed per-step objects a full implementation would emit.
+	Steps      string     `json:"steps"`
+	CreateTime *time.Time `json:"create_time,omitempty"`
+	FinishTime *time.Time `json:"finish_time,omitempty"`
+	DurationMs int64      `json:"duration_ms,omitempty"`
+}
+
+// MarshalJSON returns the operator and its status as a structured JSON
+// object instead of a single opaque string.
+func (o *OperatorWithStatus) MarshalJSON() ([]byte, error) {
+	rec := operatorRecordJSON{
+		RegionID: o.Op.RegionID(),
+		Kind:     o.Op.Kind().String(),
+		Status:   o.Status.String(),
+		Steps:    o.Op.String(),
+	}
+	if !o.FinishTime.IsZero() {
+		rec.CreateTime = &o.CreateTime
+		rec.FinishTime = &o.FinishTime
+		rec.DurationMs = o.FinishTime.Sub(o.CreateTime).Milliseconds()
+	}
+	return json.Marshal(rec)
+}
+
+// OperatorRecordFilter narrows down a call to OperatorRecords.List. A zero
+// value (or a nil *OperatorRecordFilter) matches every record; leaving a
+// field at its zero value excludes it from filtering. StoreID is never
+// applied, whatever its value (see matches).
+type OperatorRecordFilter struct {
+	StoreID  uint64
+	RegionID uint64
+	Kind     operator.OpKind
+	Status   pdpb.OperatorStatus
+	Since    time.Time
+	Until    time.Time
+}
+
+func (f *OperatorRecordFilter) matches(r *OperatorWithStatus) bool {
+	if f == nil {
+		return true
+	}
+	if f.RegionID != 0 && r.Op.RegionID() != f.RegionID {
+		return false
+	}
+	if f.Kind != 0 && r.Op.Kind()&f.Kind == 0 {
+		return false
+	}
+	if f.Status != 0 && r.Status != f.Status {
+		return false
+	}
+	if !f.Since.IsZero() && r.FinishTime.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && r.FinishTime.After(f.Until) {
+		return false
+	}
+	// StoreID isn't checked here: the store(s) an operator touches live on
+	// its individual steps, which OperatorWithStatus doesn't expose
+	// individually (see operatorRecordJSON.Steps), so this package can't
+	// filter by it without the same missing step-enumeration accessor.
+	return true
+}
+
+// OperatorRecordStorage is the storage backend OperatorRecords persists
+// finished operator records to. The only implementation in this package,
+// memoryRecordStorage, keeps records in memory for operatorStatusRemainTime
+// and loses them across a PD restart. A real etcd or embedded-BoltDB backend
+// would let records survive failover, but this package has no visible
+// access to an etcd client or any other persistence layer - opt.Cluster, the
+// only cluster handle OperatorController holds, exposes none - so adding one
+// isn't possible from here; the interface exists so that backend can be
+// dropped in without OperatorRecords' callers changing.
+type OperatorRecordStorage interface {
+	Put(record *OperatorWithStatus)
+	Get(regionID uint64) *OperatorWithStatus
+	List(filter *OperatorRecordFilter) []*OperatorWithStatus
+}
+
+// memoryRecordStorage is OperatorRecordStorage's in-memory implementation.
+// It pairs a cache.TTLUint64, for O(1) Get by region id, with a bounded
+// list.List of the same records in finish order, pruned the same way
+// OperatorController.PruneHistory prunes oc.histories, since cache.TTLUint64
+// doesn't expose a way to enumerate its entries for List/filtering.
+type memoryRecordStorage struct {
+	ttl *cache.TTLUint64
+
+	mu      sync.Mutex
+	records *list.List
+}
+
+func newMemoryRecordStorage(ctx context.Context) *memoryRecordStorage {
+	return &memoryRecordStorage{
+		ttl:     cache.NewIDTTL(ctx, time.Minute, operatorStatusRemainTime),
+		records: list.New(),
+	}
+}
+
+func (s *memoryRecordStorage) Put(record *OperatorWithStatus) {
+	s.ttl.Put(record.Op.RegionID(), record)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records.PushFront(record)
+	for back := s.records.Back(); back != nil; back = s.records.Back() {
+		if time.Since(back.Value.(*OperatorWithStatus).FinishTime) <= operatorStatusRemainTime {
+			break
+		}
+		s.records.Remove(back)
+	}
+}
+
+func (s *memoryRecordStorage) Get(regionID uint64) *OperatorWithStatus {
+	v, ok := s.ttl.Get(regionID)
+	if !ok {
+		return nil
+	}
+	return v.(*OperatorWithStatus)
+}
+
+func (s *memoryRecordStorage) List(filter *OperatorRecordFilter) []*OperatorWithStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []*OperatorWithStatus
+	for e := s.records.Front(); e != nil; e = e.Next() {
+		if r := e.Value.(*OperatorWithStatus); filter.matches(r) {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// operatorStatusRemainTime is how long a finished operator's record is kept
+// before it's pruned.
+const operatorStatusRemainTime = 10 * time.Minute
+
+// OperatorRecords remains the operator and its status for a while.
+type OperatorRecords struct {
+	storage OperatorRecordStorage
+}
+
+// NewOperatorRecords returns a OperatorRecords.
+func NewOperatorRecords(ctx context.Context) *OperatorRecords {
+	return &OperatorRecords{
+		storage: newMemoryRecordStorage(ctx),
+	}
+}
+
+// Get gets the operator and its status.
+func (o *OperatorRecords) Get(id uint64) *OperatorWithStatus {
+	return o.storage.Get(id)
+}
+
+// Put puts the operator and its status.
+func (o *OperatorRecords) Put(op *operator.Operator) {
+	record := NewOperatorWithStatus(op)
+	record.FinishTime = time.Now()
+	record.CreateTime = record.FinishTime.Add(-op.RunningTime())
+	o.storage.Put(record)
+}
+
+// List returns the records matching filter, most recently finished first.
+// A nil filter matches every retained record. This is what a
+// /operators/records HTTP endpoint (there is no api package in this source
+// tree to host one - see OperatorRecordStorage's doc comment for the same
+// limitation on the storage side) would call to serve region/kind/
+// status/time-range filtering; filtering by store is not supported (see
+// OperatorRecordFilter). Pagination is left to that endpoint, since
+// page size and cursor format are a concern of the transport layer, not of
+// records storage.
+func (o *OperatorRecords) List(filter *OperatorRecordFilter) []*OperatorWithStatus {
+	return o.storage.List(filter)
+}
@@ -0,0 +1,234 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import (
+	"strconv"
+
+	"github.com/pingcap/log"
+	"github.com/tikv/pd/server/core"
+	"github.com/tikv/pd/server/schedule/operator"
+	"github.com/tikv/pd/server/schedule/storelimit"
+	"go.uber.org/zap"
+)
+
+// SnapLimitType distinguishes the two directions of snapshot-transfer
+// bandwidth a store's budget is tracked separately for, the same way
+// storelimit.Type distinguishes AddPeer/RemovePeer peer-count budgets.
+type SnapLimitType int
+
+const (
+	// SendSnapshot limits the rate, in bytes/sec, at which a store generates
+	// and sends snapshots to other stores.
+	SendSnapshot SnapLimitType = iota
+	// RecvSnapshot limits the rate, in bytes/sec, at which a store ingests
+	// snapshots sent to it.
+	RecvSnapshot
+)
+
+// String implements fmt.Stringer.
+func (t SnapLimitType) String() string {
+	switch t {
+	case SendSnapshot:
+		return "send-snapshot"
+	case RecvSnapshot:
+		return "recv-snapshot"
+	default:
+		return "unknown"
+	}
+}
+
+// SnapTypeNameValue mirrors storelimit.TypeNameValue, but for the
+// snapshot-bandwidth limits tracked in snapStoresLimit rather than the
+// peer-count limits storelimit.Type covers.
+var SnapTypeNameValue = map[string]SnapLimitType{
+	SendSnapshot.String(): SendSnapshot,
+	RecvSnapshot.String(): RecvSnapshot,
+}
+
+// defaultSnapshotLimitBytesPerSec is the budget a store's send/recv
+// snapshot limit starts at, until something calls ResetSnapLimit.
+//
+// Ideally this would be persisted per store via two new PersistOptions
+// fields (store-snap-send-limit/store-snap-recv-limit on ScheduleConfig,
+// mirroring GetStoreLimitByType's StoreLimitConfig), the same way the
+// existing AddPeer/RemovePeer limits are. ScheduleConfig and
+// StoreLimitConfig are defined in server/config/config.go, which isn't part
+// of this source tree, so this package can't add fields to them; until that
+// config surface exists, ResetSnapLimit is the only way to change a store's
+// snapshot budget away from this default.
+const defaultSnapshotLimitBytesPerSec = 100 * 1024 * 1024
+
+// isSnapshotStep reports whether step causes TiKV to generate and install a
+// full region snapshot on target, which AddPeer/AddLightPeer/AddLearner/
+// AddLightLearner all do in TiKV's raft implementation. peerID identifies
+// the peer being added, so a caller can tell apart two successive snapshot
+// steps that happen to target the same store (e.g. a peer re-added after an
+// earlier one was removed) instead of treating them as the same step.
+func isSnapshotStep(step operator.OpStep) (target uint64, peerID uint64, ok bool) {
+	switch st := step.(type) {
+	case operator.AddPeer:
+		return st.ToStore, st.PeerID, true
+	case operator.AddLightPeer:
+		return st.ToStore, st.PeerID, true
+	case operator.AddLearner:
+		return st.ToStore, st.PeerID, true
+	case operator.AddLightLearner:
+		return st.ToStore, st.PeerID, true
+	default:
+		return 0, 0, false
+	}
+}
+
+// snapshotCost estimates the number of bytes a snapshot for region costs to
+// generate and transfer. operator.StoreInfluence (defined outside this
+// tree) only tracks step counts today, not byte sizes, so until it grows a
+// byte-cost field this uses the region's approximate size as the
+// accounting unit, the same quantity TiKV itself reports snapshot size as.
+func snapshotCost(region *core.RegionInfo) int64 {
+	if region == nil {
+		return 0
+	}
+	return int64(region.GetApproximateSize())
+}
+
+// snapshotAdmission identifies the in-flight snapshot step checkSnapshotLimit
+// has already admitted (checked and debited) for a region, keyed by the
+// target peer rather than the region alone, so a later step for the same
+// region (a different peer, once the operator progresses) is recognized as
+// new rather than reusing a stale admission.
+type snapshotAdmission struct {
+	target uint64
+	peerID uint64
+}
+
+// newSnapStoreLimitLocked creates or replaces the snapshot-bandwidth limit
+// of a store. Callers must hold oc.snapLimitMu.
+func (oc *OperatorController) newSnapStoreLimitLocked(storeID uint64, bytesPerSec float64, limitType SnapLimitType) {
+	log.Info("create or update a store snapshot limit",
+		zap.Uint64("store-id", storeID), zap.String("type", limitType.String()), zap.Float64("bytes-per-sec", bytesPerSec))
+	if oc.snapStoresLimit[storeID] == nil {
+		oc.snapStoresLimit[storeID] = make(map[SnapLimitType]*storelimit.StoreLimit)
+	}
+	oc.snapStoresLimit[storeID][limitType] = storelimit.NewStoreLimit(bytesPerSec, 1)
+}
+
+// getOrCreateSnapStoreLimitLocked returns the snapshot-bandwidth limit of a
+// store, creating it at defaultSnapshotLimitBytesPerSec if it doesn't exist
+// yet. Callers must hold oc.snapLimitMu.
+func (oc *OperatorController) getOrCreateSnapStoreLimitLocked(storeID uint64, limitType SnapLimitType) *storelimit.StoreLimit {
+	if oc.snapStoresLimit[storeID][limitType] == nil {
+		oc.newSnapStoreLimitLocked(storeID, defaultSnapshotLimitBytesPerSec, limitType)
+	}
+	return oc.snapStoresLimit[storeID][limitType]
+}
+
+// ResetSnapLimit sets the snapshot-bandwidth limit, in bytes/sec, of a
+// store, so an admin API can throttle bandwidth-heavy snapshot generation
+// independently from the peer-count balance limit.
+func (oc *OperatorController) ResetSnapLimit(storeID uint64, limitType SnapLimitType, bytesPerSec float64) {
+	oc.snapLimitMu.Lock()
+	defer oc.snapLimitMu.Unlock()
+	oc.newSnapStoreLimitLocked(storeID, bytesPerSec, limitType)
+}
+
+// checkSnapshotLimit reports whether step may be dispatched: non-snapshot
+// steps always pass, and a snapshot step that was already admitted for this
+// region (i.e. this exact peer's budget was already debited on an earlier
+// call) passes too, without touching the budget again. A snapshot step seen
+// for the first time debits the sending store's (the region's current
+// leader) and the receiving store's (step's target) bandwidth budget once,
+// the same way addOperator debits storesLimit once via opInfluence rather
+// than on every heartbeat resend; if either budget is exhausted, dispatch is
+// deferred instead - getNextPushOperatorTime already retries shortly, so the
+// step is attempted again without blocking the rest of the operator.
+//
+// This runs on every Dispatch, i.e. every region heartbeat with an
+// in-flight snapshot step, so it guards snapStoresLimit (and
+// snapshotAdmitted) with its own oc.snapLimitMu rather than oc's embedded
+// RWMutex - the same reason storesLimit entries were pulled out from under
+// that lock into guardedStoreLimit.
+func (oc *OperatorController) checkSnapshotLimit(region *core.RegionInfo, step operator.OpStep) bool {
+	target, peerID, ok := isSnapshotStep(step)
+	if !ok {
+		return true
+	}
+	cost := snapshotCost(region)
+	if cost == 0 {
+		return true
+	}
+	source := region.GetLeader().GetStoreId()
+	admission := snapshotAdmission{target: target, peerID: peerID}
+
+	oc.snapLimitMu.Lock()
+	defer oc.snapLimitMu.Unlock()
+
+	if oc.snapshotAdmitted[region.GetID()] == admission {
+		return true
+	}
+
+	if source != 0 && oc.getOrCreateSnapStoreLimitLocked(source, SendSnapshot).Available() < cost {
+		return false
+	}
+	if oc.getOrCreateSnapStoreLimitLocked(target, RecvSnapshot).Available() < cost {
+		return false
+	}
+	if source != 0 {
+		oc.getOrCreateSnapStoreLimitLocked(source, SendSnapshot).Take(cost)
+	}
+	oc.getOrCreateSnapStoreLimitLocked(target, RecvSnapshot).Take(cost)
+	if oc.snapshotAdmitted == nil {
+		oc.snapshotAdmitted = make(map[uint64]snapshotAdmission)
+	}
+	oc.snapshotAdmitted[region.GetID()] = admission
+	return true
+}
+
+// clearSnapshotAdmission forgets regionID's admitted snapshot step, if any,
+// so the next operator dispatched against that region (e.g. the replacement
+// addOperator installs, or a fresh one after this step's operator finished)
+// starts from a clean slate instead of being compared against a step that no
+// longer applies.
+func (oc *OperatorController) clearSnapshotAdmission(regionID uint64) {
+	oc.snapLimitMu.Lock()
+	defer oc.snapLimitMu.Unlock()
+	delete(oc.snapshotAdmitted, regionID)
+}
+
+// CollectSnapshotLimitMetrics collects the metrics about store snapshot
+// limits, mirroring CollectStoreLimitMetrics for the peer-count limits.
+func (oc *OperatorController) CollectSnapshotLimitMetrics() {
+	oc.snapLimitMu.RLock()
+	defer oc.snapLimitMu.RUnlock()
+	if oc.snapStoresLimit == nil {
+		return
+	}
+	stores := oc.cluster.GetStores()
+	for _, store := range stores {
+		if store == nil {
+			continue
+		}
+		storeID := store.GetID()
+		storeIDStr := strconv.FormatUint(storeID, 10)
+		for n, v := range SnapTypeNameValue {
+			if oc.snapStoresLimit[storeID] == nil || oc.snapStoresLimit[storeID][v] == nil {
+				storeLimitRateGauge.WithLabelValues(storeIDStr, n).Set(0)
+				continue
+			}
+			limit := oc.snapStoresLimit[storeID][v]
+			storeLimitAvailableGauge.WithLabelValues(storeIDStr, n).Set(float64(limit.Available()))
+			storeLimitRateGauge.WithLabelValues(storeIDStr, n).Set(limit.Rate())
+		}
+	}
+}
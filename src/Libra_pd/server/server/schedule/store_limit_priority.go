@@ -0,0 +1,102 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import (
+	"sync"
+
+	"github.com/tikv/pd/server/schedule/operator"
+	"github.com/tikv/pd/server/schedule/storelimit"
+)
+
+// priorityReserveUnits is how many region-equivalents' worth of a store
+// limit's remaining budget are kept off-limits to operators below
+// priorityHighThreshold, expressed in the same units as
+// storelimit.RegionInfluence. It lets replace-down-peer, replace-offline-
+// peer, and region-merge operators keep making progress while a
+// full-cluster rebalance is saturating the rest of the budget.
+const priorityReserveUnits = 2
+
+// priorityHighThreshold is the numeric operator.PriorityLevel at or above
+// which an operator may draw on a store limit's reserved budget.
+// operator.PriorityLevel (defined outside this tree, see
+// isHigherPriorityOperator) has no named level confirmed to exist in this
+// package besides being orderable, so rather than guess at a constant name
+// like operator.High, this derives the threshold from DefaultPriorityWeight:
+// it has one weight per priority level ordered lowest to highest, so its
+// third of four levels is the one essential, availability-restoring
+// operators (replace-down-peer, replace-offline-peer, region-merge) run at.
+var priorityHighThreshold = operator.PriorityLevel(len(DefaultPriorityWeight) - 2)
+
+// guardedStoreLimit wraps a *storelimit.StoreLimit with its own lock.
+// Previously newStoreLimitLocked swapped the map entry for a new
+// *storelimit.StoreLimit under oc's embedded lock, but Rate()/Available()
+// callers that had already read the old pointer (e.g. through the
+// AttachAvailableFunc callback, which only takes oc.RLock) could still be
+// using it concurrently with the swap. Routing every access through this
+// wrapper's own lock makes a rate change and an in-flight Take/Available
+// mutually exclusive instead of racing.
+type guardedStoreLimit struct {
+	mu    sync.RWMutex
+	limit *storelimit.StoreLimit
+}
+
+func newGuardedStoreLimit(ratePerSec float64, regionInfluence int64) *guardedStoreLimit {
+	return &guardedStoreLimit{limit: storelimit.NewStoreLimit(ratePerSec, regionInfluence)}
+}
+
+// reset replaces the underlying limit, e.g. when the configured rate changes.
+func (g *guardedStoreLimit) reset(ratePerSec float64, regionInfluence int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.limit = storelimit.NewStoreLimit(ratePerSec, regionInfluence)
+}
+
+// rate returns the limit's current configured rate.
+func (g *guardedStoreLimit) rate() float64 {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.limit.Rate()
+}
+
+// rawAvailable returns the limit's remaining budget, ignoring priority.
+// CollectStoreLimitMetrics reports this directly.
+func (g *guardedStoreLimit) rawAvailable() int64 {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.limit.Available()
+}
+
+// available reports whether cost more units are obtainable at priority:
+// priority >= priorityHighThreshold may draw on the limit's full remaining
+// budget, anything below must leave priorityReserveUnits*regionInfluence in
+// reserve.
+func (g *guardedStoreLimit) available(cost int64, regionInfluence int64, priority operator.PriorityLevel) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	avail := g.limit.Available()
+	if priority < priorityHighThreshold {
+		avail -= priorityReserveUnits * regionInfluence
+	}
+	return avail >= cost
+}
+
+// take consumes cost units from the limit. Concurrent take calls are safe
+// the same way they were on the bare *storelimit.StoreLimit; only reset
+// needs exclusive access, since it's the one that replaces limit itself.
+func (g *guardedStoreLimit) take(cost int64) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	g.limit.Take(cost)
+}
@@ -0,0 +1,120 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statistics
+
+import (
+	"math"
+	"time"
+)
+
+// ForecastConfig holds the tunables a HoltLinearForecaster applies: Alpha
+// smooths the level, Beta smooths the trend, and DefaultHorizon is how far
+// ahead callers project when they don't name a horizon explicitly.
+type ForecastConfig struct {
+	Alpha          float64
+	Beta           float64
+	DefaultHorizon time.Duration
+}
+
+// defaultForecastConfig picks values the way Holt's method usually is in
+// practice: a fairly responsive level (Alpha=0.3) and a much slower trend
+// (Beta=0.1), since a rate's short-term trend is noisier than its level.
+func defaultForecastConfig() *ForecastConfig {
+	return &ForecastConfig{
+		Alpha:          0.3,
+		Beta:           0.1,
+		DefaultHorizon: time.Minute,
+	}
+}
+
+// HoltLinearForecaster implements Holt's linear (double exponential
+// smoothing) method. Alongside every Observe it updates:
+//
+//	level_t = alpha*x_t + (1-alpha)*(level_{t-1} + trend_{t-1})
+//	trend_t = beta*(level_t - level_{t-1}) + (1-beta)*trend_{t-1}
+//
+// and forecasts h steps ahead as level_t + h*trend_t. It also tracks an
+// exponentially-weighted residual variance so a forecast can be turned into
+// a mean +/- k*sigma confidence band instead of a bare point estimate.
+type HoltLinearForecaster struct {
+	cfg *ForecastConfig
+
+	initialized bool
+	level       float64
+	trend       float64
+	// lastInterval is the most recently observed sample interval, used to
+	// convert a requested horizon into a number of forecast steps.
+	lastInterval time.Duration
+	// residualVariance is a smoothed estimate of the squared one-step
+	// forecast error - an exact rolling sample variance isn't worth the
+	// extra history just for a confidence band.
+	residualVariance float64
+}
+
+// NewHoltLinearForecaster creates a HoltLinearForecaster driven by cfg. A
+// nil cfg falls back to defaultForecastConfig().
+func NewHoltLinearForecaster(cfg *ForecastConfig) *HoltLinearForecaster {
+	if cfg == nil {
+		cfg = defaultForecastConfig()
+	}
+	return &HoltLinearForecaster{cfg: cfg}
+}
+
+// Observe feeds one new rate sample, measured over interval, into the
+// forecaster. A non-positive interval is dropped, since there's no
+// meaningful number of steps to attribute it to.
+func (h *HoltLinearForecaster) Observe(rate float64, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	h.lastInterval = interval
+	if !h.initialized {
+		h.level = rate
+		h.initialized = true
+		return
+	}
+
+	forecastForThisStep := h.level + h.trend
+	err := rate - forecastForThisStep
+	h.residualVariance = h.cfg.Alpha*err*err + (1-h.cfg.Alpha)*h.residualVariance
+
+	prevLevel := h.level
+	h.level = h.cfg.Alpha*rate + (1-h.cfg.Alpha)*(h.level+h.trend)
+	h.trend = h.cfg.Beta*(h.level-prevLevel) + (1-h.cfg.Beta)*h.trend
+}
+
+// steps returns how many sample intervals horizon spans, based on the most
+// recently observed interval.
+func (h *HoltLinearForecaster) steps(horizon time.Duration) float64 {
+	if h.lastInterval <= 0 {
+		return 0
+	}
+	return horizon.Seconds() / h.lastInterval.Seconds()
+}
+
+// Forecast projects the rate horizon into the future.
+func (h *HoltLinearForecaster) Forecast(horizon time.Duration) float64 {
+	if !h.initialized {
+		return 0
+	}
+	return h.level + h.steps(horizon)*h.trend
+}
+
+// ForecastBand returns Forecast(horizon) along with a mean +/- k*sigma
+// confidence band built from the forecaster's running residual variance.
+func (h *HoltLinearForecaster) ForecastBand(horizon time.Duration, k float64) (mean, lower, upper float64) {
+	mean = h.Forecast(horizon)
+	sigma := math.Sqrt(h.residualVariance)
+	return mean, mean - k*sigma, mean + k*sigma
+}
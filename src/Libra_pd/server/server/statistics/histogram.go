@@ -0,0 +1,135 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statistics
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// histogramRelativeError is the target relative error of a bucket
+	// boundary, i.e. the epsilon in the bucket-index formula below. 0.02
+	// keeps adjacent buckets within about 2% of each other.
+	histogramRelativeError = 0.02
+	// histogramNumBuckets puts the top bucket's upper edge at
+	// (1+histogramRelativeError)^1100-1, about 2.9e9, at
+	// histogramRelativeError's resolution - enough range for anything from a
+	// few bytes/s to a few GB/s. A larger sample is counted in the last bucket.
+	histogramNumBuckets = 1100
+	// histogramDefaultDecay is how long it takes an unrefreshed bucket's
+	// count to decay by a factor of e, so GetQuantile reflects recent
+	// behavior rather than a store's entire history.
+	histogramDefaultDecay = 60 * time.Second
+)
+
+// histogramLogBase is log(1+histogramRelativeError), the denominator shared
+// by every bucket-index and bucket-value computation below.
+var histogramLogBase = math.Log1p(histogramRelativeError)
+
+// TimeHistogram is a decaying, log-scale bucketed histogram of a metric's
+// samples, used alongside TimeMedian where a caller needs a tail quantile
+// (P95, P99) rather than just a median - a median smooths away the
+// intermittent hot stores a scheduler would want to react to.
+//
+// Each sample falls into bucket floor(log(1+x)/log(1+epsilon)), the same
+// bucketing an HDR histogram uses to bound relative error at a fixed bucket
+// count regardless of the value's magnitude. Existing bucket counts decay by
+// exp(-dt/tau) before every new sample is added, so GetQuantile answers from
+// a recency-weighted view instead of an ever-growing lifetime count.
+type TimeHistogram struct {
+	tau     time.Duration
+	buckets [histogramNumBuckets]float64
+
+	lastUpdate  time.Time
+	initialized bool
+}
+
+// NewTimeHistogram creates a TimeHistogram that decays with time constant
+// tau. A non-positive tau falls back to histogramDefaultDecay.
+func NewTimeHistogram(tau time.Duration) *TimeHistogram {
+	if tau <= 0 {
+		tau = histogramDefaultDecay
+	}
+	return &TimeHistogram{tau: tau}
+}
+
+// bucketIndex returns the bucket a sample of value x falls into, clamped to
+// the histogram's configured range.
+func bucketIndex(x float64) int {
+	if x <= 0 {
+		return 0
+	}
+	idx := int(math.Log1p(x) / histogramLogBase)
+	if idx < 0 {
+		return 0
+	}
+	if idx >= histogramNumBuckets {
+		return histogramNumBuckets - 1
+	}
+	return idx
+}
+
+// bucketValue returns the representative value of bucket idx, the upper
+// edge of its range.
+func bucketValue(idx int) float64 {
+	return math.Expm1(float64(idx+1) * histogramLogBase)
+}
+
+// decayLocked applies exp(-dt/tau) decay to every bucket for the time
+// elapsed since lastUpdate.
+func (h *TimeHistogram) decayLocked(now time.Time) {
+	if !h.initialized {
+		h.lastUpdate = now
+		h.initialized = true
+		return
+	}
+	dt := now.Sub(h.lastUpdate)
+	if dt <= 0 {
+		return
+	}
+	factor := math.Exp(-dt.Seconds() / h.tau.Seconds())
+	for i := range h.buckets {
+		h.buckets[i] *= factor
+	}
+	h.lastUpdate = now
+}
+
+// Observe decays the histogram to now and adds one sample of value x.
+func (h *TimeHistogram) Observe(x float64, now time.Time) {
+	h.decayLocked(now)
+	h.buckets[bucketIndex(x)]++
+}
+
+// Quantile returns the value below which a fraction q of the histogram's
+// decayed weight falls, for q in (0,1). It returns 0 if the histogram has
+// no weight yet.
+func (h *TimeHistogram) Quantile(q float64) float64 {
+	var total float64
+	for _, c := range h.buckets {
+		total += c
+	}
+	if total <= 0 {
+		return 0
+	}
+	target := q * total
+	var cum float64
+	for i, c := range h.buckets {
+		cum += c
+		if cum >= target {
+			return bucketValue(i)
+		}
+	}
+	return bucketValue(histogramNumBuckets - 1)
+}
@@ -0,0 +1,407 @@
+// Copyright 2020 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statistics
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/tikv/pd/server/core"
+)
+
+// hotCacheTaskQueueLength bounds the number of tasks buffered for a shard
+// before the oldest pending task is dropped to keep its worker from falling
+// further behind the heartbeat stream.
+const hotCacheTaskQueueLength = 1000
+
+// hotCacheWorkerCount is the number of worker goroutines, and hotPeerCache
+// shards, a Kind is split across. A region's peers are spread across many
+// stores, so sharding by storeID lets independent stores' peers update
+// concurrently instead of funneling through one worker per Kind.
+const hotCacheWorkerCount = 4
+
+// hotCacheTaskQueueSizeGauge, like hotCacheTaskDroppedCounter and
+// hotCacheStatusGauge below, is a Prometheus vector this package assumes is
+// registered elsewhere; this source tree has no metrics.go to declare it
+// in.
+
+// hotCacheShard owns one hotPeerCache and the worker goroutine that
+// serializes every mutation to it via the task queue below. cache's
+// peersOfStore/storesOfRegion maps are plain maps with no synchronization
+// of their own, so the embedded RWMutex - taken by the worker around every
+// task it runs, and by HotCache's own direct accessors (CheckWrite,
+// RegionStats, Update, ...) below - is what actually makes those maps safe
+// to touch from more than the worker goroutine, the same way
+// storesStatsShard's RWMutex guards rollingStoresStats in store.go.
+type hotCacheShard struct {
+	sync.RWMutex
+	cache *hotPeerCache
+	tasks chan HotCacheTask
+}
+
+// HotCache is a cache hold hot regions. Each Kind (Read/Write) is split into
+// hotCacheWorkerCount shards by storeID, each with its own worker goroutine,
+// so HandleRegionHeartbeat never blocks on the rolling-average/TopN
+// recomputation, and peers on different stores don't serialize behind a
+// single worker.
+//
+// Sharding by store does cost CheckRegionFlow's cross-store adoption: a
+// brand-new peer used to be able to inherit a sibling peer's (on a different
+// store of the same region) rolling-average state via an ancestor or
+// tmpItem lookup. A shard only ever holds the hotPeerCache entries for the
+// stores it owns, so that lookup can no longer cross shards. CheckPeerFlow
+// accepts this as a bounded simplification: a peer new to a store always
+// starts Direct. Same-store history, via getOldHotPeerStat, is unaffected.
+type HotCache struct {
+	writeShards [hotCacheWorkerCount]*hotCacheShard
+	readShards  [hotCacheWorkerCount]*hotCacheShard
+}
+
+// NewHotCache creates a new hot spot cache and starts its worker goroutines.
+// The goroutines run until ctx is done.
+func NewHotCache(ctx context.Context) *HotCache {
+	w := &HotCache{}
+	for i := 0; i < hotCacheWorkerCount; i++ {
+		w.writeShards[i] = newHotCacheShard(ctx, WriteFlow)
+		w.readShards[i] = newHotCacheShard(ctx, ReadFlow)
+	}
+	return w
+}
+
+func newHotCacheShard(ctx context.Context, kind FlowKind) *hotCacheShard {
+	s := &hotCacheShard{
+		cache: NewHotStoresStats(kind),
+		tasks: make(chan HotCacheTask, hotCacheTaskQueueLength),
+	}
+	go runHotCacheShardWorker(ctx, s)
+	return s
+}
+
+func runHotCacheShardWorker(ctx context.Context, s *hotCacheShard) {
+	for {
+		select {
+		case task := <-s.tasks:
+			s.Lock()
+			task.runLocked(s.cache)
+			s.Unlock()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// shardIndex maps storeID onto one of hotCacheWorkerCount shards.
+func shardIndex(storeID uint64) int {
+	return int(storeID % hotCacheWorkerCount)
+}
+
+func (w *HotCache) shardsFor(kind FlowKind) *[hotCacheWorkerCount]*hotCacheShard {
+	if kind == WriteFlow {
+		return &w.writeShards
+	}
+	return &w.readShards
+}
+
+func (w *HotCache) shardFor(kind FlowKind, storeID uint64) *hotCacheShard {
+	return w.shardsFor(kind)[shardIndex(storeID)]
+}
+
+// enqueue schedules task on shard's worker without blocking. If the worker
+// is backed up, the oldest queued task is dropped to make room.
+func (w *HotCache) enqueue(kind FlowKind, shard *hotCacheShard, task HotCacheTask) {
+	select {
+	case shard.tasks <- task:
+		return
+	default:
+	}
+	select {
+	case <-shard.tasks:
+		hotCacheTaskDroppedCounter.WithLabelValues(kind.String()).Inc()
+	default:
+	}
+	select {
+	case shard.tasks <- task:
+	default:
+	}
+}
+
+// broadcast enqueues task, built fresh per shard by newTask, on every shard
+// of kind. It's for tasks like CheckExpiredItemTask that can't be narrowed
+// to a single shard ahead of time.
+func (w *HotCache) broadcast(kind FlowKind, newTask func() HotCacheTask) {
+	for _, shard := range w.shardsFor(kind) {
+		w.enqueue(kind, shard, newTask())
+	}
+}
+
+// CheckWriteAsync enqueues a CheckWritePeerTask, routed to the shard owning
+// its store, for every peer of region without blocking the heartbeat path.
+// region's write load is computed once, up front, rather than once per
+// peer task - every peer shares the same region-level rates.
+func (w *HotCache) CheckWriteAsync(region *core.RegionInfo, storesStats *StoresStats) {
+	rates := CalcRegionFlowRates(WriteFlow, region)
+	for _, peer := range region.GetPeers() {
+		storeID := peer.GetStoreId()
+		w.enqueue(WriteFlow, w.shardFor(WriteFlow, storeID), NewCheckWritePeerTask(region, storeID, storesStats, rates))
+	}
+}
+
+// CheckReadAsync enqueues a CheckReadPeerTask, routed to the shard owning
+// region's leader store, without blocking the heartbeat path. ReadFlow only
+// ever tracks the leader.
+func (w *HotCache) CheckReadAsync(region *core.RegionInfo, storesStats *StoresStats) {
+	leader := region.GetLeader()
+	if leader == nil {
+		return
+	}
+	storeID := leader.GetStoreId()
+	rates := CalcRegionFlowRates(ReadFlow, region)
+	w.enqueue(ReadFlow, w.shardFor(ReadFlow, storeID), NewCheckReadPeerTask(region, storeID, storesStats, rates))
+}
+
+// CollectExpiredItemsAsync enqueues a CheckExpiredItemTask on every shard of
+// both Kinds, since which shard's storesOfRegion remembers a now-dropped
+// store isn't known ahead of time.
+func (w *HotCache) CollectExpiredItemsAsync(region *core.RegionInfo) {
+	w.broadcast(WriteFlow, func() HotCacheTask { return NewCheckExpiredItemTask(region) })
+	w.broadcast(ReadFlow, func() HotCacheTask { return NewCheckExpiredItemTask(region) })
+}
+
+// CollectUnReportedPeerAsync enqueues a CollectUnReportedPeerTask, routed to
+// the shard owning each store, for every store origin had a peer on that
+// region no longer does. It's a targeted alternative to
+// CollectExpiredItemsAsync's broadcast for the common case where the caller
+// already has origin on hand (e.g. HandleRegionHeartbeat, right after
+// processRegionHeartbeat). origin may be nil, e.g. on a region's first
+// heartbeat, in which case there is nothing to evict.
+func (w *HotCache) CollectUnReportedPeerAsync(region *core.RegionInfo, origin *core.RegionInfo) {
+	if origin == nil {
+		return
+	}
+	current := make(map[uint64]struct{}, len(region.GetPeers()))
+	for _, peer := range region.GetPeers() {
+		current[peer.GetStoreId()] = struct{}{}
+	}
+	for _, peer := range origin.GetPeers() {
+		storeID := peer.GetStoreId()
+		if _, ok := current[storeID]; ok {
+			continue
+		}
+		w.enqueue(WriteFlow, w.shardFor(WriteFlow, storeID), NewCollectUnReportedPeerTask(region, storeID))
+		w.enqueue(ReadFlow, w.shardFor(ReadFlow, storeID), NewCollectUnReportedPeerTask(region, storeID))
+	}
+}
+
+// CheckWrite checks the write status of every peer of region, returning the
+// update items synchronously. It is kept for call sites (and tests) that
+// still need an immediate result.
+func (w *HotCache) CheckWrite(region *core.RegionInfo, storesStats *StoresStats) []*HotPeerStat {
+	var ret []*HotPeerStat
+	rates := CalcRegionFlowRates(WriteFlow, region)
+	for _, peer := range region.GetPeers() {
+		storeID := peer.GetStoreId()
+		shard := w.shardFor(WriteFlow, storeID)
+		shard.RLock()
+		item := shard.cache.CheckPeerFlow(region, storeID, storesStats, rates)
+		shard.RUnlock()
+		if item != nil {
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
+
+// CheckRead checks the read status of region's leader, returning the update
+// item synchronously, if any.
+func (w *HotCache) CheckRead(region *core.RegionInfo, storesStats *StoresStats) []*HotPeerStat {
+	leader := region.GetLeader()
+	if leader == nil {
+		return nil
+	}
+	storeID := leader.GetStoreId()
+	rates := CalcRegionFlowRates(ReadFlow, region)
+	shard := w.shardFor(ReadFlow, storeID)
+	shard.RLock()
+	item := shard.cache.CheckPeerFlow(region, storeID, storesStats, rates)
+	shard.RUnlock()
+	if item == nil {
+		return nil
+	}
+	return []*HotPeerStat{item}
+}
+
+// Update updates the cache with the given item, using the Kind and StoreID
+// it carries to find the owning shard.
+func (w *HotCache) Update(item *HotPeerStat) {
+	shard := w.shardFor(item.Kind, item.StoreID)
+	shard.Lock()
+	shard.cache.Update(item)
+	shard.Unlock()
+}
+
+// RegionStats returns hot items of the given Kind, merged across every
+// shard.
+func (w *HotCache) RegionStats(kind FlowKind) map[uint64][]*HotPeerStat {
+	res := make(map[uint64][]*HotPeerStat)
+	for _, shard := range w.shardsFor(kind) {
+		shard.RLock()
+		for storeID, stats := range shard.cache.RegionStats() {
+			res[storeID] = append(res[storeID], stats...)
+		}
+		shard.RUnlock()
+	}
+	return res
+}
+
+// RegionStatsByRole returns hot items of the given Kind belonging only to
+// peers of role, merged across every shard, so a scheduler can query hot
+// TiFlash learners independently of the same regions' voters.
+func (w *HotCache) RegionStatsByRole(kind FlowKind, role PeerRole) map[uint64][]*HotPeerStat {
+	res := make(map[uint64][]*HotPeerStat)
+	for _, shard := range w.shardsFor(kind) {
+		shard.RLock()
+		for storeID, stats := range shard.cache.RegionStatsByRole(role) {
+			res[storeID] = append(res[storeID], stats...)
+		}
+		shard.RUnlock()
+	}
+	return res
+}
+
+// RegionStatsAsync snapshots RegionStats(kind) via every shard's worker
+// goroutine so the caller does not contend with in-flight task processing.
+func (w *HotCache) RegionStatsAsync(kind FlowKind) map[uint64][]*HotPeerStat {
+	rets := make([]chan map[uint64][]*HotPeerStat, 0, hotCacheWorkerCount)
+	for _, shard := range w.shardsFor(kind) {
+		task, ret := NewCollectRegionStatsTask()
+		w.enqueue(kind, shard, task)
+		rets = append(rets, ret)
+	}
+	res := make(map[uint64][]*HotPeerStat)
+	for _, ret := range rets {
+		for storeID, stats := range <-ret {
+			res[storeID] = append(res[storeID], stats...)
+		}
+	}
+	return res
+}
+
+// RandHotRegionFromStore randomly picks a hot region in specified store.
+func (w *HotCache) RandHotRegionFromStore(storeID uint64, kind FlowKind, hotThreshold int) *HotPeerStat {
+	shard := w.shardFor(kind, storeID)
+	shard.RLock()
+	stats, ok := shard.cache.RegionStats()[storeID]
+	shard.RUnlock()
+	if !ok {
+		return nil
+	}
+	for _, i := range stats {
+		if i.HotDegree >= hotThreshold {
+			return i
+		}
+	}
+	return nil
+}
+
+// IsRegionHot checks if a region is hot, consulting the shard that owns
+// each of region's peers (and, for ReadFlow, its leader) rather than a
+// single cache.
+func (w *HotCache) IsRegionHot(region *core.RegionInfo, hotThreshold int) bool {
+	for _, peer := range region.GetPeers() {
+		shard := w.shardFor(WriteFlow, peer.GetStoreId())
+		shard.RLock()
+		hot := shard.cache.isRegionHotWithPeer(region, peer, hotThreshold)
+		shard.RUnlock()
+		if hot {
+			return true
+		}
+	}
+	leader := region.GetLeader()
+	if leader != nil {
+		shard := w.shardFor(ReadFlow, leader.GetStoreId())
+		shard.RLock()
+		hot := shard.cache.isRegionHotWithPeer(region, leader, hotThreshold)
+		shard.RUnlock()
+		if hot {
+			return true
+		}
+	}
+	return false
+}
+
+// CollectMetrics collects the hot cache metrics on every shard's worker
+// goroutine, plus each shard's current queue depth - unlike the per-cache
+// metrics a CollectMetricsTask gathers from inside the worker goroutine,
+// queue depth is a property of the channel itself, so it's read directly
+// here instead of round-tripping through a task.
+func (w *HotCache) CollectMetrics() {
+	for i, shard := range w.writeShards {
+		w.enqueue(WriteFlow, shard, NewCollectMetricsTask("write"))
+		hotCacheTaskQueueSizeGauge.WithLabelValues(WriteFlow.String() + "-" + strconv.Itoa(i)).Set(float64(len(shard.tasks)))
+	}
+	for i, shard := range w.readShards {
+		w.enqueue(ReadFlow, shard, NewCollectMetricsTask("read"))
+		hotCacheTaskQueueSizeGauge.WithLabelValues(ReadFlow.String() + "-" + strconv.Itoa(i)).Set(float64(len(shard.tasks)))
+	}
+}
+
+// ResetMetrics resets the hot cache metrics.
+func (w *HotCache) ResetMetrics() {
+	hotCacheStatusGauge.Reset()
+}
+
+// ReduceHotThresholds reduces the hot thresholds of both Kinds. For test
+// purpose only. minHotThresholds is a package-level table shared by every
+// shard of a Kind, so this only needs to run once per Kind rather than once
+// per shard - calling it on every shard would halve the threshold
+// hotCacheWorkerCount times over instead of once.
+func (w *HotCache) ReduceHotThresholds() {
+	w.writeShards[0].cache.ReduceHotThresholds()
+	w.readShards[0].cache.ReduceHotThresholds()
+}
+
+// SetHotCacheConfig replaces the HotCacheConfig every shard's
+// calcHotThresholds uses, e.g. in response to an operator adjusting the
+// adaptive threshold's aggressiveness at runtime. It goes through each
+// shard's worker goroutine the same way every other mutation does, rather
+// than writing the field directly from the caller's goroutine.
+func (w *HotCache) SetHotCacheConfig(cfg *HotCacheConfig) {
+	w.broadcast(WriteFlow, func() HotCacheTask { return NewSetHotCacheConfigTask(cfg) })
+	w.broadcast(ReadFlow, func() HotCacheTask { return NewSetHotCacheConfigTask(cfg) })
+}
+
+// WaitForTasksDone blocks until every task queued so far on every shard's
+// worker goroutine has finished running. It is intended for deterministic
+// tests and throughput benchmarks that need a synchronous drain point
+// between generating heartbeats and reading back the result - this source
+// tree has no existing _test.go files to add one to, but the method is kept
+// here in the same style as before sharding so a future benchmark can use
+// it without further plumbing.
+func (w *HotCache) WaitForTasksDone() {
+	dones := make([]chan struct{}, 0, 2*hotCacheWorkerCount)
+	for _, shard := range w.writeShards {
+		done := make(chan struct{})
+		w.enqueue(WriteFlow, shard, &waitTask{done: done})
+		dones = append(dones, done)
+	}
+	for _, shard := range w.readShards {
+		done := make(chan struct{})
+		w.enqueue(ReadFlow, shard, &waitTask{done: done})
+		dones = append(dones, done)
+	}
+	for _, done := range dones {
+		<-done
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2020 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statistics
+
+import "github.com/tikv/pd/server/core"
+
+// HotCacheTask is the interface for the work items drained by a hotCache
+// worker goroutine. Implementations run with exclusive access to the
+// Kind-specific hotPeerCache, so they must not block.
+type HotCacheTask interface {
+	runLocked(cache *hotPeerCache)
+}
+
+// peerFlowTask checks the flow statistics of one peer of a region, on one
+// store, against the cache, and applies the resulting HotPeerStat update.
+// CheckWritePeerTask and CheckReadPeerTask embed it so each peer of a
+// region can be routed to the shard owning its store, instead of one task
+// recomputing every peer of the region regardless of which shard drains it.
+// rates is computed once by the caller dispatching every peer of a region,
+// via CalcRegionFlowRates, rather than once per peer task here - every peer
+// of the same region and Kind would otherwise derive the identical totals
+// and rates redundantly, once per shard it happens to be routed to.
+type peerFlowTask struct {
+	region      *core.RegionInfo
+	storeID     uint64
+	storesStats *StoresStats
+	rates       regionFlowRates
+}
+
+func (t *peerFlowTask) runLocked(cache *hotPeerCache) {
+	if item := cache.CheckPeerFlow(t.region, t.storeID, t.storesStats, t.rates); item != nil {
+		cache.Update(item)
+	}
+}
+
+// CheckWritePeerTask checks one peer's write flow statistics.
+type CheckWritePeerTask struct {
+	peerFlowTask
+}
+
+// NewCheckWritePeerTask creates a CheckWritePeerTask. rates is the region's
+// write load, from CalcRegionFlowRates(WriteFlow, region).
+func NewCheckWritePeerTask(region *core.RegionInfo, storeID uint64, storesStats *StoresStats, rates regionFlowRates) *CheckWritePeerTask {
+	return &CheckWritePeerTask{peerFlowTask{region: region, storeID: storeID, storesStats: storesStats, rates: rates}}
+}
+
+// CheckReadPeerTask checks one peer's read flow statistics.
+type CheckReadPeerTask struct {
+	peerFlowTask
+}
+
+// NewCheckReadPeerTask creates a CheckReadPeerTask. rates is the region's
+// read load, from CalcRegionFlowRates(ReadFlow, region).
+func NewCheckReadPeerTask(region *core.RegionInfo, storeID uint64, storesStats *StoresStats, rates regionFlowRates) *CheckReadPeerTask {
+	return &CheckReadPeerTask{peerFlowTask{region: region, storeID: storeID, storesStats: storesStats, rates: rates}}
+}
+
+// CollectUnReportedPeerTask evicts storeID's cached stat for region, if any,
+// once a caller already knows - from comparing region against its prior
+// heartbeat - that storeID no longer holds a peer of it. It is the targeted
+// counterpart to CheckExpiredItemTask: it costs one task on one shard
+// instead of a broadcast to every shard of the Kind.
+type CollectUnReportedPeerTask struct {
+	region  *core.RegionInfo
+	storeID uint64
+}
+
+// NewCollectUnReportedPeerTask creates a CollectUnReportedPeerTask.
+func NewCollectUnReportedPeerTask(region *core.RegionInfo, storeID uint64) *CollectUnReportedPeerTask {
+	return &CollectUnReportedPeerTask{region: region, storeID: storeID}
+}
+
+func (t *CollectUnReportedPeerTask) runLocked(cache *hotPeerCache) {
+	if item := cache.CollectUnReportedPeer(t.region, t.storeID); item != nil {
+		cache.Update(item)
+	}
+}
+
+// CollectRegionStatsTask snapshots RegionStats() into ret without blocking
+// the caller on the cache's internal lock.
+type CollectRegionStatsTask struct {
+	ret chan map[uint64][]*HotPeerStat
+}
+
+// NewCollectRegionStatsTask creates a CollectRegionStatsTask along with the
+// channel its result will be delivered on.
+func NewCollectRegionStatsTask() (*CollectRegionStatsTask, chan map[uint64][]*HotPeerStat) {
+	ret := make(chan map[uint64][]*HotPeerStat, 1)
+	return &CollectRegionStatsTask{ret: ret}, ret
+}
+
+func (t *CollectRegionStatsTask) runLocked(cache *hotPeerCache) {
+	t.ret <- cache.RegionStats()
+}
+
+// CheckExpiredItemTask removes the HotPeerStat entries that no longer have
+// a peer of region on their store, e.g. after a transfer leader or remove
+// peer. Unlike CollectUnReportedPeerTask it isn't narrowed to one storeID,
+// since storesOfRegion can hold entries on stores the caller has no other
+// reason to already know about - so it is broadcast to every shard of a
+// Kind rather than routed to one.
+type CheckExpiredItemTask struct {
+	region *core.RegionInfo
+}
+
+// NewCheckExpiredItemTask creates a CheckExpiredItemTask.
+func NewCheckExpiredItemTask(region *core.RegionInfo) *CheckExpiredItemTask {
+	return &CheckExpiredItemTask{region: region}
+}
+
+func (t *CheckExpiredItemTask) runLocked(cache *hotPeerCache) {
+	for _, item := range cache.CollectExpiredItems(t.region) {
+		cache.Update(item)
+	}
+}
+
+// CollectMetricsTask asks the cache to report its current metrics.
+type CollectMetricsTask struct {
+	typ string
+}
+
+// NewCollectMetricsTask creates a CollectMetricsTask.
+func NewCollectMetricsTask(typ string) *CollectMetricsTask {
+	return &CollectMetricsTask{typ: typ}
+}
+
+func (t *CollectMetricsTask) runLocked(cache *hotPeerCache) {
+	cache.CollectMetrics(t.typ)
+}
+
+// SetHotCacheConfigTask replaces a cache's HotCacheConfig.
+type SetHotCacheConfigTask struct {
+	cfg *HotCacheConfig
+}
+
+// NewSetHotCacheConfigTask creates a SetHotCacheConfigTask.
+func NewSetHotCacheConfigTask(cfg *HotCacheConfig) *SetHotCacheConfigTask {
+	return &SetHotCacheConfigTask{cfg: cfg}
+}
+
+func (t *SetHotCacheConfigTask) runLocked(cache *hotPeerCache) {
+	cache.SetConfig(t.cfg)
+}
+
+// waitTask is a no-op task whose sole purpose is to signal, via done, that
+// every task queued ahead of it has finished running.
+type waitTask struct {
+	done chan struct{}
+}
+
+func (t *waitTask) runLocked(cache *hotPeerCache) {
+	close(t.done)
+}
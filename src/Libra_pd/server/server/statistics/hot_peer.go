@@ -13,7 +13,54 @@
 
 package statistics
 
-import "time"
+import (
+	"bytes"
+	"math"
+	"time"
+
+	"github.com/pingcap/log"
+	"github.com/tikv/pd/pkg/movingaverage"
+	"go.uber.org/zap"
+)
+
+// sourceKind records where a HotPeerStat's rolling rates came from, so a
+// debugging session can tell a peer that's genuinely hot on its own traffic
+// apart from one that's just carrying forward a hot degree some other peer
+// (or an earlier stint of its own) already earned.
+type sourceKind int
+
+const (
+	// Direct means the latest update carried forward this peer's own stat
+	// on the same store, or started it fresh - the common case. An item
+	// seeded by Inherit or Adopt becomes Direct on its next heartbeat on
+	// that store, while its rolling windows still hold the seeded samples.
+	Direct sourceKind = iota
+	// Inherit means updateHotPeerStat seeded this peer's rolling rates from
+	// the same peer's own oldItem on the store it just moved from (a
+	// transfer-leader or remove-peer left the region's old replica on that
+	// store expired, CheckRegionFlow's tmpItem fallback). allowInherited
+	// starts false: until this peer is observed hot on its own traffic
+	// here, it may not be inherited again if it moves a second time.
+	Inherit
+	// Adopt means this item's rolling rates were seeded from a different
+	// peer of the same region on another store - CheckRegionFlow's
+	// scan-every-store fallback for a freshly added replica, which has no
+	// history of its own yet. Like Inherit, allowInherited starts false.
+	Adopt
+)
+
+func (k sourceKind) String() string {
+	switch k {
+	case Direct:
+		return "direct"
+	case Inherit:
+		return "inherit"
+	case Adopt:
+		return "adopt"
+	default:
+		return "unknown"
+	}
+}
 
 const (
 	byteDim int = iota
@@ -25,6 +72,33 @@ const (
 	dimLen
 )
 
+// PeerRole distinguishes a region peer that carries votes in its Raft group
+// (Voter, the common case) from a read-only replica such as a TiFlash
+// learner. A learner receives asynchronous log entries rather than serving
+// traffic directly, so its write-rate distribution often looks nothing like
+// its region's voters - hotPeerCache keeps their TopN rankings separate so
+// neither skews the other's percentile threshold.
+type PeerRole int
+
+const (
+	// Voter is a normal Raft peer able to vote and become leader.
+	Voter PeerRole = iota
+	// Learner is a non-voting replica, e.g. a TiFlash columnar replica,
+	// that only replays the Raft log.
+	Learner
+)
+
+func (r PeerRole) String() string {
+	switch r {
+	case Voter:
+		return "voter"
+	case Learner:
+		return "learner"
+	default:
+		return "unknown"
+	}
+}
+
 // HotPeerStat records each hot peer's statistics
 type HotPeerStat struct {
 	StoreID  uint64 `json:"store_id"`
@@ -36,6 +110,7 @@ type HotPeerStat struct {
 	AntiCount int `json:"anti_count"`
 
 	Kind     FlowKind `json:"kind"`
+	Role     PeerRole `json:"role"`
 	ByteRate float64  `json:"flow_bytes"`
 	KeyRate  float64  `json:"flow_keys"`
 	Ops      float64  `json:"flow_ops"`
@@ -44,23 +119,96 @@ type HotPeerStat struct {
 	OtherKeyRate  float64 `json:"other_flow_keys"`
 	OtherOps      float64 `json:"other_flow_ops"`
 
-	// rolling statistics, recording some recently added records.
-	rollingByteRate MovingAvg
-	rollingKeyRate  MovingAvg
-	rollingOps      MovingAvg
+	// rolling statistics, weighted by each sample's heartbeat interval
+	// rather than counted equally regardless of how long it spanned.
+	rollingByteRate *movingaverage.AvgOverTime
+	rollingKeyRate  *movingaverage.AvgOverTime
+	rollingOps      *movingaverage.AvgOverTime
 
-	rollingOtherByteRate MovingAvg
-	rollingOtherKeyRate  MovingAvg
-	rollingOtherOps      MovingAvg
+	rollingOtherByteRate *movingaverage.AvgOverTime
+	rollingOtherKeyRate  *movingaverage.AvgOverTime
+	rollingOtherOps      *movingaverage.AvgOverTime
 
 	// LastUpdateTime used to calculate average write
 	LastUpdateTime time.Time `json:"last_update_time"`
 	// Version used to check the region split times
 	Version uint64 `json:"version"`
 
+	// Buckets carries the per-key-range load reported alongside the region
+	// heartbeat, ordered by key. It is nil for peers whose store has not
+	// reported bucket-granularity stats.
+	Buckets []*BucketStat `json:"buckets,omitempty"`
+
 	needDelete bool
 	isLeader   bool
 	isNew      bool
+
+	// sourceKind and allowInherited guard how far a hot degree can be
+	// carried across peer movement - see the sourceKind doc comment above.
+	sourceKind     sourceKind
+	allowInherited bool
+}
+
+// SourceKind returns whether this item's latest update carried forward its
+// own stat on the same store (Direct) or seeded it from another peer's
+// (Inherit, Adopt).
+func (stat *HotPeerStat) SourceKind() sourceKind {
+	return stat.sourceKind
+}
+
+// AllowInherited reports whether a peer on another store may adopt this
+// item's rolling rates when it takes over the region. An Inherit item may
+// not be adopted again until it's been observed hot on its own traffic,
+// which is what flips this to true - otherwise a peer that was only ever
+// hot because it inherited the degree from somewhere else could keep
+// passing that degree along indefinitely.
+func (stat *HotPeerStat) AllowInherited() bool {
+	return stat.allowInherited
+}
+
+// Log emits msg at debug level with this item's identifying fields plus
+// sourceKind/allowInherited, for diagnosing a hot degree that looks
+// misattributed after several peer movements.
+func (stat *HotPeerStat) Log(msg string) {
+	log.Debug(msg,
+		zap.Uint64("region-id", stat.RegionID),
+		zap.Uint64("store-id", stat.StoreID),
+		zap.String("kind", stat.Kind.String()),
+		zap.String("role", stat.Role.String()),
+		zap.Int("hot-degree", stat.HotDegree),
+		zap.String("source", stat.sourceKind.String()),
+		zap.Bool("allow-inherited", stat.allowInherited),
+	)
+}
+
+// BucketStat is the rolling load of a single key range within a region, used
+// to pick a traffic-aware split point instead of the region's mid-key.
+type BucketStat struct {
+	StartKey []byte `json:"start_key"`
+	EndKey   []byte `json:"end_key"`
+
+	ByteRate float64 `json:"flow_bytes"`
+	KeyRate  float64 `json:"flow_keys"`
+	Ops      float64 `json:"flow_ops"`
+}
+
+// SetBuckets replaces the bucket-granularity loads carried by the peer. It is
+// meant to be called from the bucket-report path alongside the region-level
+// aggregates, the same way the TiKV heartbeat already feeds ByteRate/KeyRate/
+// Ops - but that path parses the raw region heartbeat request, and neither
+// that request-parsing code nor the server/core package its RegionInfo comes
+// from is part of this source tree, so nothing calls SetBuckets yet. Until
+// that wiring exists, Buckets stays nil and GetBuckets/HottestBucketSplitKey
+// fall back accordingly (see cluster.hotBucketSplitKey).
+func (stat *HotPeerStat) SetBuckets(buckets []*BucketStat) {
+	stat.Buckets = buckets
+}
+
+// GetBuckets returns the peer's per-key-range loads, for a caller (e.g. a
+// future /hotspot/buckets debug endpoint) that wants to inspect them
+// directly rather than only the HottestBucketSplitKey they drive.
+func (stat *HotPeerStat) GetBuckets() []*BucketStat {
+	return stat.Buckets
 }
 
 // ID returns region ID. Implementing TopNItem.
@@ -164,6 +312,54 @@ func (stat *HotPeerStat) GetLoads() (loads []float64) {
 	return
 }
 
+// IsRegionSplitCandidate reports whether the peer has stayed hot enough for
+// long enough that it should be split rather than rescheduled: HotDegree
+// (consecutive hot heartbeats) must reach minHotDegree, and at least one of
+// its rates must clear the configured hot-region-split-size/-qps threshold.
+func (stat *HotPeerStat) IsRegionSplitCandidate(minBytesRate, minKeyRate, minOps float64, minHotDegree int) bool {
+	if stat.HotDegree < minHotDegree {
+		return false
+	}
+	return stat.GetByteRate() >= minBytesRate ||
+		stat.GetKeyRate() >= minKeyRate ||
+		stat.GetOps() >= minOps
+}
+
+// HottestBucketSplitKey returns the key that most evenly balances byte-rate
+// traffic between the two halves of the region, based on the per-bucket
+// loads reported alongside the heartbeat. It returns nil when there is not
+// enough bucket data to make a principled choice, in which case callers
+// should fall back to a mid-key split.
+func (stat *HotPeerStat) HottestBucketSplitKey() []byte {
+	if len(stat.Buckets) < 2 {
+		return nil
+	}
+	var total float64
+	for _, b := range stat.Buckets {
+		total += b.ByteRate
+	}
+	if total <= 0 {
+		return nil
+	}
+
+	var prefix float64
+	var best []byte
+	bestDiff := math.Inf(1)
+	for _, b := range stat.Buckets {
+		prefix += b.ByteRate
+		// The ideal cut makes the prefix sum equal to half of the total, i.e.
+		// total - 2*prefix == 0.
+		if diff := math.Abs(total - 2*prefix); diff < bestDiff {
+			bestDiff = diff
+			best = b.EndKey
+		}
+	}
+	if len(best) == 0 || bytes.Equal(best, stat.Buckets[len(stat.Buckets)-1].EndKey) {
+		return nil
+	}
+	return best
+}
+
 // Clone clones the HotPeerStat
 func (stat *HotPeerStat) Clone() *HotPeerStat {
 	ret := *stat
@@ -14,9 +14,11 @@
 package statistics
 
 import (
+	"math"
 	"time"
 
 	"github.com/pingcap/kvproto/pkg/metapb"
+	"github.com/tikv/pd/pkg/movingaverage"
 	"github.com/tikv/pd/server/core"
 )
 
@@ -25,7 +27,10 @@ const (
 	topNTTL           = 3 * RegionHeartBeatReportInterval * time.Second
 	hotThresholdRatio = 0.8
 
-	rollingWindowsSize = 5
+	// rollingWindow is how much heartbeat-interval time each rolling
+	// AvgOverTime averages over, so a region reporting every few seconds
+	// under load isn't smoothed any less than one reporting every 30s+.
+	rollingWindow = time.Minute
 
 	hotRegionReportMinInterval = 3
 
@@ -34,61 +39,147 @@ const (
 	updateWithOtherStats = true
 )
 
+// minHotThresholds is indexed [FlowKind][PeerRole]. Learner starts out equal
+// to Voter's floor in both kinds; there's no TiFlash-scale traffic in this
+// deployment yet to tune it against, but keeping the dimension independent
+// means an operator (or a future default) can split them apart without
+// another threading change once that data exists.
 var (
-	minHotThresholds = [2][dimLen]float64{
+	minHotThresholds = [2][2][dimLen]float64{
 		WriteFlow: {
-			byteDim:      256,
-			keyDim:       16,
-			opsDim:       16,
-			otherByteDim: 256,
-			otherKeyDim:  16,
-			otherOpsDim:  16,
+			Voter: {
+				byteDim:      256,
+				keyDim:       16,
+				opsDim:       16,
+				otherByteDim: 256,
+				otherKeyDim:  16,
+				otherOpsDim:  16,
+			},
+			Learner: {
+				byteDim:      256,
+				keyDim:       16,
+				opsDim:       16,
+				otherByteDim: 256,
+				otherKeyDim:  16,
+				otherOpsDim:  16,
+			},
 		},
 		ReadFlow: {
-			byteDim:      256,
-			keyDim:       16,
-			opsDim:       16,
-			otherByteDim: 256,
-			otherKeyDim:  16,
-			otherOpsDim:  16,
+			Voter: {
+				byteDim:      256,
+				keyDim:       16,
+				opsDim:       16,
+				otherByteDim: 256,
+				otherKeyDim:  16,
+				otherOpsDim:  16,
+			},
+			Learner: {
+				byteDim:      256,
+				keyDim:       16,
+				opsDim:       16,
+				otherByteDim: 256,
+				otherKeyDim:  16,
+				otherOpsDim:  16,
+			},
 		},
 	}
 )
 
+// HotCacheConfig holds the tunables calcHotThresholds reacts to, so the
+// adaptive threshold's aggressiveness can be adjusted at runtime instead of
+// requiring a restart.
+type HotCacheConfig struct {
+	// HotThresholdRatio scales a store's TopN-minimum rate down into the
+	// adaptive threshold: a peer only needs to clear HotThresholdRatio
+	// times the slowest peer already in the TopN to also count as hot.
+	HotThresholdRatio float64
+	// TopNN is how many peers a store's TopN must hold before the
+	// adaptive threshold applies; below that there isn't enough data for
+	// a percentile to mean anything, so minHotThresholds is used instead.
+	TopNN int
+}
+
+// defaultHotCacheConfig returns the tunables this package used before they
+// became adjustable.
+func defaultHotCacheConfig() *HotCacheConfig {
+	return &HotCacheConfig{
+		HotThresholdRatio: hotThresholdRatio,
+		TopNN:             topNN,
+	}
+}
+
+// peerCacheKey identifies one (store, peer role) bucket of peersOfStore.
+// Splitting the TopN by role keeps a store's voters and its learners (e.g.
+// TiFlash) from competing for the same percentile ranking.
+type peerCacheKey struct {
+	storeID uint64
+	role    PeerRole
+}
+
 // hotPeerCache saves the hot peer's statistics.
 type hotPeerCache struct {
 	kind           FlowKind
-	peersOfStore   map[uint64]*TopN               // storeID -> hot peers
+	peersOfStore   map[peerCacheKey]*TopN         // (storeID, role) -> hot peers
 	storesOfRegion map[uint64]map[uint64]struct{} // regionID -> storeIDs
+	config         *HotCacheConfig
 }
 
 // NewHotStoresStats creates a HotStoresStats
 func NewHotStoresStats(kind FlowKind) *hotPeerCache {
 	return &hotPeerCache{
 		kind:           kind,
-		peersOfStore:   make(map[uint64]*TopN),
+		peersOfStore:   make(map[peerCacheKey]*TopN),
 		storesOfRegion: make(map[uint64]map[uint64]struct{}),
+		config:         defaultHotCacheConfig(),
 	}
 }
 
-// RegionStats returns hot items
+// SetConfig replaces the tunables calcHotThresholds uses. It is expected to
+// be called from the same worker goroutine that drives the rest of the
+// cache (e.g. via a task, the way ReduceHotThresholds's callers already
+// serialize access), since it is not itself synchronized.
+func (f *hotPeerCache) SetConfig(cfg *HotCacheConfig) {
+	f.config = cfg
+}
+
+// RegionStats returns hot items, voters and learners together.
 func (f *hotPeerCache) RegionStats() map[uint64][]*HotPeerStat {
 	res := make(map[uint64][]*HotPeerStat)
-	for storeID, peers := range f.peersOfStore {
+	for key, peers := range f.peersOfStore {
+		values := peers.GetAll()
+		stat := make([]*HotPeerStat, len(values))
+		for i := range values {
+			stat[i] = values[i].(*HotPeerStat)
+		}
+		res[key.storeID] = append(res[key.storeID], stat...)
+	}
+	return res
+}
+
+// RegionStatsByRole returns hot items belonging only to peers of role, so a
+// scheduler can query, say, hot TiFlash learners independently of the same
+// regions' voters.
+func (f *hotPeerCache) RegionStatsByRole(role PeerRole) map[uint64][]*HotPeerStat {
+	res := make(map[uint64][]*HotPeerStat)
+	for key, peers := range f.peersOfStore {
+		if key.role != role {
+			continue
+		}
 		values := peers.GetAll()
 		stat := make([]*HotPeerStat, len(values))
-		res[storeID] = stat
 		for i := range values {
 			stat[i] = values[i].(*HotPeerStat)
 		}
+		res[key.storeID] = stat
 	}
 	return res
 }
 
 // Update updates the items in statistics.
 func (f *hotPeerCache) Update(item *HotPeerStat) {
+	key := peerCacheKey{storeID: item.StoreID, role: item.Role}
 	if item.IsNeedDelete() {
-		if peers, ok := f.peersOfStore[item.StoreID]; ok {
+		if peers, ok := f.peersOfStore[key]; ok {
 			peers.Remove(item.RegionID)
 		}
 
@@ -96,10 +187,10 @@ func (f *hotPeerCache) Update(item *HotPeerStat) {
 			delete(stores, item.StoreID)
 		}
 	} else {
-		peers, ok := f.peersOfStore[item.StoreID]
+		peers, ok := f.peersOfStore[key]
 		if !ok {
-			peers = NewTopN(dimLen, topNN, topNTTL)
-			f.peersOfStore[item.StoreID] = peers
+			peers = NewTopN(dimLen, f.config.TopNN, topNTTL)
+			f.peersOfStore[key] = peers
 		}
 		peers.Put(item)
 
@@ -112,35 +203,104 @@ func (f *hotPeerCache) Update(item *HotPeerStat) {
 	}
 }
 
-// CheckRegionFlow checks the flow information of region.
-func (f *hotPeerCache) CheckRegionFlow(region *core.RegionInfo, storesStats *StoresStats) (ret []*HotPeerStat) {
-	totalBytes := float64(f.getTotalBytes(region))
-	totalKeys := float64(f.getTotalKeys(region))
-	totalOps := float64(f.getTotalOps(region))
+// regionFlowRates is the per-region load CheckRegionFlow and CheckPeerFlow
+// both derive a HotPeerStat from. It only depends on a region's own report
+// (plus which FlowKind's cache is asking), never on any particular peer or
+// store, so a caller handling several peers of the same region - e.g.
+// HotCache dispatching one task per peer to their owning shards - computes
+// it once and passes it down, instead of every per-peer task recomputing
+// identical totals and rates from the same region.
+type regionFlowRates struct {
+	interval      uint64
+	byteRate      float64
+	keyRate       float64
+	ops           float64
+	otherByteRate float64
+	otherKeyRate  float64
+	otherOps      float64
+}
 
-	totalOtherBytes := float64(f.getTotalOtherBytes(region))
-	totalOtherKeys := float64(f.getTotalOtherKeys(region))
-	totalOtherOps := float64(f.getTotalOtherOps(region))
+// CalcRegionFlowRates computes region's load for kind, for a caller that
+// will check several of a region's peers across several hotPeerCache shards
+// and wants to compute it only once rather than once per peer.
+func CalcRegionFlowRates(kind FlowKind, region *core.RegionInfo) regionFlowRates {
+	var totalBytes, totalKeys, totalOps uint64
+	var totalOtherBytes, totalOtherKeys, totalOtherOps uint64
+	switch kind {
+	case WriteFlow:
+		totalBytes, totalKeys, totalOps = region.GetBytesWritten(), region.GetKeysWritten(), region.GetOpsWrite()
+		totalOtherBytes, totalOtherKeys, totalOtherOps = region.GetBytesRead(), region.GetKeysRead(), region.GetOpsRead()
+	case ReadFlow:
+		totalBytes, totalKeys, totalOps = region.GetBytesRead(), region.GetKeysRead(), region.GetOpsRead()
+		totalOtherBytes, totalOtherKeys, totalOtherOps = region.GetBytesWritten(), region.GetKeysWritten(), region.GetOpsWrite()
+	}
 
 	reportInterval := region.GetInterval()
 	interval := reportInterval.GetEndTimestamp() - reportInterval.GetStartTimestamp()
 
-	byteRate := totalBytes / float64(interval)
-	keyRate := totalKeys / float64(interval)
-	ops := totalOps / float64(interval)
+	return regionFlowRates{
+		interval:      interval,
+		byteRate:      float64(totalBytes) / float64(interval),
+		keyRate:       float64(totalKeys) / float64(interval),
+		ops:           float64(totalOps) / float64(interval),
+		otherByteRate: float64(totalOtherBytes) / float64(interval),
+		otherKeyRate:  float64(totalOtherKeys) / float64(interval),
+		otherOps:      float64(totalOtherOps) / float64(interval),
+	}
+}
 
-	otherByteRate := totalOtherBytes / float64(interval)
-	otherKeyRate := totalOtherKeys / float64(interval)
-	otherOps := totalOtherOps / float64(interval)
+// CheckRegionFlow checks the flow information of region.
+func (f *hotPeerCache) CheckRegionFlow(region *core.RegionInfo, storesStats *StoresStats) (ret []*HotPeerStat) {
+	rates := CalcRegionFlowRates(f.kind, region)
+	interval := rates.interval
+	intervalDuration := time.Duration(interval) * time.Second
+	byteRate, keyRate, ops := rates.byteRate, rates.keyRate, rates.ops
+	otherByteRate, otherKeyRate, otherOps := rates.otherByteRate, rates.otherKeyRate, rates.otherOps
 
 	// old region is in the front and new region is in the back
 	// which ensures it will hit the cache if moving peer or transfer leader occurs with the same replica number
 
-	var tmpItem *HotPeerStat
+	// storeRoles tracks each current peer's role, so a learner (e.g.
+	// TiFlash) doesn't share a voter's TopN bucket on the same store.
+	storeRoles := make(map[uint64]PeerRole, len(region.GetPeers()))
+	for _, peer := range region.GetPeers() {
+		role := Voter
+		if peer.GetIsLearner() {
+			role = Learner
+		}
+		storeRoles[peer.GetStoreId()] = role
+	}
+
 	storeIDs := f.getAllStoreIDs(region)
+
+	// oldItems indexes every storeID's cached stat for this region, built
+	// once up front instead of re-querying getOldHotPeerStat per storeID
+	// inside the ancestor search below - that used to rescan all of
+	// storeIDs for every new peer that needed one, an O(P^2) pattern for
+	// a region with P peers (worst case: a freshly split or created
+	// region where every peer is new).
+	oldItems := make(map[uint64]*HotPeerStat, len(storeIDs))
+	for _, storeID := range storeIDs {
+		if oldItem := f.getOldHotPeerStat(region.GetID(), storeID); oldItem != nil {
+			oldItems[storeID] = oldItem
+		}
+	}
+
+	// ancestor is the first stat found among any of this region's stores,
+	// used to seed a brand-new peer that has neither its own history nor
+	// a tmpItem (Adopt). Resolved once here rather than per-peer.
+	var ancestor *HotPeerStat
+	for _, storeID := range storeIDs {
+		if oldItem, ok := oldItems[storeID]; ok {
+			ancestor = oldItem
+			break
+		}
+	}
+
+	var tmpItem *HotPeerStat
 	for _, storeID := range storeIDs {
 		isExpired := f.isRegionExpired(region, storeID) // transfer leader or remove peer
-		oldItem := f.getOldHotPeerStat(region.GetID(), storeID)
+		oldItem := oldItems[storeID]
 		if isExpired && oldItem != nil {
 			tmpItem = oldItem
 		}
@@ -150,10 +310,19 @@ func (f *hotPeerCache) CheckRegionFlow(region *core.RegionInfo, storesStats *Sto
 			continue
 		}
 
+		// A storeID carried over from storesOfRegion (isExpired's case)
+		// may no longer have a peer in region.GetPeers(); fall back to
+		// whatever role it was last cached under.
+		role, ok := storeRoles[storeID]
+		if !ok && oldItem != nil {
+			role = oldItem.Role
+		}
+
 		newItem := &HotPeerStat{
 			StoreID:        storeID,
 			RegionID:       region.GetID(),
 			Kind:           f.kind,
+			Role:           role,
 			ByteRate:       byteRate,
 			KeyRate:        keyRate,
 			Ops:            ops,
@@ -166,20 +335,26 @@ func (f *hotPeerCache) CheckRegionFlow(region *core.RegionInfo, storesStats *Sto
 			isLeader:       region.GetLeader().GetStoreId() == storeID,
 		}
 
+		source := Direct
 		if oldItem == nil {
 			if tmpItem != nil { // use the tmpItem cached from the store where this region was in before
 				oldItem = tmpItem
-			} else { // new item is new peer after adding replica
-				for _, storeID := range storeIDs {
-					oldItem = f.getOldHotPeerStat(region.GetID(), storeID)
-					if oldItem != nil {
-						break
-					}
-				}
+				source = Inherit
+			} else if ancestor != nil { // new item is new peer after adding replica
+				oldItem = ancestor
+				source = Adopt
+			}
+			// A cross-store oldItem may only be carried forward once it's
+			// proven itself hot on its own traffic; otherwise a peer that
+			// was only ever hot because *it* inherited the degree could
+			// keep passing that degree along every time the region moves.
+			if oldItem != nil && !oldItem.allowInherited {
+				oldItem = nil
+				source = Direct
 			}
 		}
 
-		newItem = f.updateHotPeerStat(newItem, oldItem, storesStats)
+		newItem = f.updateHotPeerStat(newItem, oldItem, storesStats, source, intervalDuration)
 		if newItem != nil {
 			ret = append(ret, newItem)
 		}
@@ -188,92 +363,153 @@ func (f *hotPeerCache) CheckRegionFlow(region *core.RegionInfo, storesStats *Sto
 	return ret
 }
 
-func (f *hotPeerCache) IsRegionHot(region *core.RegionInfo, hotDegree int) bool {
-	switch f.kind {
-	case WriteFlow:
-		return f.isRegionHotWithAnyPeers(region, hotDegree)
-	case ReadFlow:
-		return f.isRegionHotWithPeer(region, region.GetLeader(), hotDegree)
+// CheckPeerFlow is CheckRegionFlow narrowed to a single storeID, for a
+// worker pool sharded by store: each shard only ever holds the peersOfStore
+// and storesOfRegion entries for the stores it owns, so it has no way to see
+// another shard's cached stat for this region. That rules out the
+// ancestor/tmpItem cross-store adoption CheckRegionFlow does for a peer new
+// to a region (Adopt/Inherit) - a peer new to storeID always starts Direct
+// here, warming up its own rolling window even if the region is already hot
+// on a sibling store. Same-store history, via getOldHotPeerStat, is still
+// exact.
+func (f *hotPeerCache) CheckPeerFlow(region *core.RegionInfo, storeID uint64, storesStats *StoresStats, rates regionFlowRates) *HotPeerStat {
+	interval := rates.interval
+	intervalDuration := time.Duration(interval) * time.Second
+	byteRate, keyRate, ops := rates.byteRate, rates.keyRate, rates.ops
+	otherByteRate, otherKeyRate, otherOps := rates.otherByteRate, rates.otherKeyRate, rates.otherOps
+
+	isExpired := f.isRegionExpired(region, storeID)
+	oldItem := f.getOldHotPeerStat(region.GetID(), storeID)
+
+	// This is used for the simulator. Ignore if report too fast.
+	if !isExpired && oldItem == nil && Denoising && interval < hotRegionReportMinInterval {
+		return nil
 	}
-	return false
-}
 
-func (f *hotPeerCache) CollectMetrics(typ string) {
-	for storeID, peers := range f.peersOfStore {
-		store := storeTag(storeID)
-		thresholds := f.calcHotThresholds(storeID)
-		hotCacheStatusGauge.WithLabelValues("total_length", store, typ).Set(float64(peers.Len()))
-		hotCacheStatusGauge.WithLabelValues("byte-rate-threshold", store, typ).Set(thresholds[byteDim])
-		hotCacheStatusGauge.WithLabelValues("key-rate-threshold", store, typ).Set(thresholds[keyDim])
-		// for compatibility
-		hotCacheStatusGauge.WithLabelValues("hotThreshold", store, typ).Set(thresholds[byteDim])
+	role := Voter
+	if peer := region.GetStorePeer(storeID); peer != nil {
+		if peer.GetIsLearner() {
+			role = Learner
+		}
+	} else if oldItem != nil {
+		// storeID was carried over from storesOfRegion (isExpired's case)
+		// and may no longer have a peer in region.GetPeers().
+		role = oldItem.Role
 	}
-}
 
-func (f *hotPeerCache) getTotalBytes(region *core.RegionInfo) uint64 {
-	switch f.kind {
-	case WriteFlow:
-		return region.GetBytesWritten()
-	case ReadFlow:
-		return region.GetBytesRead()
+	newItem := &HotPeerStat{
+		StoreID:        storeID,
+		RegionID:       region.GetID(),
+		Kind:           f.kind,
+		Role:           role,
+		ByteRate:       byteRate,
+		KeyRate:        keyRate,
+		Ops:            ops,
+		OtherByteRate:  otherByteRate,
+		OtherKeyRate:   otherKeyRate,
+		OtherOps:       otherOps,
+		LastUpdateTime: time.Now(),
+		Version:        region.GetMeta().GetRegionEpoch().GetVersion(),
+		needDelete:     isExpired,
+		isLeader:       region.GetLeader().GetStoreId() == storeID,
 	}
-	return 0
+
+	return f.updateHotPeerStat(newItem, oldItem, storesStats, Direct, intervalDuration)
 }
 
-func (f *hotPeerCache) getTotalKeys(region *core.RegionInfo) uint64 {
-	switch f.kind {
-	case WriteFlow:
-		return region.GetKeysWritten()
-	case ReadFlow:
-		return region.GetKeysRead()
+// CollectUnReportedPeer returns the eviction item for storeID's cached stat
+// on region, if storeID used to hold a peer of region (per origin) but no
+// longer does. It is CollectExpiredItems narrowed the same way CheckPeerFlow
+// narrows CheckRegionFlow: to one store a caller already knows dropped out,
+// rather than every store storesOfRegion remembers for this region.
+func (f *hotPeerCache) CollectUnReportedPeer(region *core.RegionInfo, storeID uint64) *HotPeerStat {
+	if !f.isRegionExpired(region, storeID) {
+		return nil
+	}
+	oldItem := f.getOldHotPeerStat(region.GetID(), storeID)
+	if oldItem == nil {
+		return nil
 	}
-	return 0
+	item := *oldItem
+	item.needDelete = true
+	return &item
 }
 
-func (f *hotPeerCache) getTotalOps(region *core.RegionInfo) uint64 {
+func (f *hotPeerCache) IsRegionHot(region *core.RegionInfo, hotDegree int) bool {
 	switch f.kind {
 	case WriteFlow:
-		return region.GetOpsWrite()
+		return f.isRegionHotWithAnyPeers(region, hotDegree)
 	case ReadFlow:
-		return region.GetOpsRead()
+		return f.isRegionHotWithPeer(region, region.GetLeader(), hotDegree)
 	}
-	return 0
+	return false
 }
 
-func (f *hotPeerCache) getTotalOtherBytes(region *core.RegionInfo) uint64 {
-	switch f.kind {
-	case ReadFlow:
-		return region.GetBytesWritten()
-	case WriteFlow:
-		return region.GetBytesRead()
+func (f *hotPeerCache) CollectMetrics(typ string) {
+	for key, peers := range f.peersOfStore {
+		store := storeTag(key.storeID)
+		// Learner buckets get their own typ suffix rather than a new
+		// gauge label, since hotCacheStatusGauge's label arity is fixed
+		// by whatever registers it elsewhere (see the note on
+		// hotCacheTaskQueueSizeGauge in hot_cache.go).
+		label := typ
+		if key.role == Learner {
+			label = typ + "-learner"
+		}
+		thresholds := f.calcHotThresholds(key.storeID, key.role)
+		hotCacheStatusGauge.WithLabelValues("total_length", store, label).Set(float64(peers.Len()))
+		hotCacheStatusGauge.WithLabelValues("byte-rate-threshold", store, label).Set(thresholds[byteDim])
+		hotCacheStatusGauge.WithLabelValues("key-rate-threshold", store, label).Set(thresholds[keyDim])
+		// for compatibility
+		hotCacheStatusGauge.WithLabelValues("hotThreshold", store, label).Set(thresholds[byteDim])
+
+		// inherited counts peers whose latest update seeded their stat
+		// from another peer (source != Direct); a peer stops counting on
+		// its next heartbeat on the same store. It surfaces alongside
+		// total_length to help when debugging a misattributed hotspot.
+		var inherited float64
+		for _, v := range peers.GetAll() {
+			if v.(*HotPeerStat).sourceKind != Direct {
+				inherited++
+			}
+		}
+		hotCacheStatusGauge.WithLabelValues("inherited_length", store, label).Set(inherited)
 	}
-	return 0
 }
 
-func (f *hotPeerCache) getTotalOtherKeys(region *core.RegionInfo) uint64 {
-	switch f.kind {
-	case ReadFlow:
-		return region.GetKeysWritten()
-	case WriteFlow:
-		return region.GetKeysRead()
+// CollectExpiredItems returns the HotPeerStat entries that should be removed
+// because region no longer has a peer on their store, e.g. after a transfer
+// leader or remove peer.
+func (f *hotPeerCache) CollectExpiredItems(region *core.RegionInfo) (items []*HotPeerStat) {
+	ids, ok := f.storesOfRegion[region.GetID()]
+	if !ok {
+		return nil
 	}
-	return 0
-}
-
-func (f *hotPeerCache) getTotalOtherOps(region *core.RegionInfo) uint64 {
-	switch f.kind {
-	case ReadFlow:
-		return region.GetOpsWrite()
-	case WriteFlow:
-		return region.GetOpsRead()
+	for storeID := range ids {
+		if !f.isRegionExpired(region, storeID) {
+			continue
+		}
+		oldItem := f.getOldHotPeerStat(region.GetID(), storeID)
+		if oldItem == nil {
+			continue
+		}
+		item := *oldItem
+		item.needDelete = true
+		items = append(items, &item)
 	}
-	return 0
+	return
 }
 
+// getOldHotPeerStat looks up regionID's previously cached stat on storeID,
+// trying both roles - a peer's role rarely changes without the region
+// expiring on that store first, but the caller may not know which role's
+// bucket to check before it has looked.
 func (f *hotPeerCache) getOldHotPeerStat(regionID, storeID uint64) *HotPeerStat {
-	if hotPeers, ok := f.peersOfStore[storeID]; ok {
-		if v := hotPeers.Get(regionID); v != nil {
-			return v.(*HotPeerStat)
+	for _, role := range []PeerRole{Voter, Learner} {
+		if hotPeers, ok := f.peersOfStore[peerCacheKey{storeID, role}]; ok {
+			if v := hotPeers.Get(regionID); v != nil {
+				return v.(*HotPeerStat)
+			}
 		}
 	}
 	return nil
@@ -289,10 +525,18 @@ func (f *hotPeerCache) isRegionExpired(region *core.RegionInfo, storeID uint64)
 	return false
 }
 
-func (f *hotPeerCache) calcHotThresholds(storeID uint64) [dimLen]float64 {
-	minThresholds := minHotThresholds[f.kind]
-	tn, ok := f.peersOfStore[storeID]
-	if !ok || tn.Len() < topNN {
+// calcHotThresholds returns, per dimension, the rate a peer of role on
+// storeID must clear to count as hot. Once that (store, role) bucket's TopN
+// holds at least f.config.TopNN peers, the threshold adapts to its own
+// traffic - the f.config.TopNN-th busiest peer's rate scaled by
+// f.config.HotThresholdRatio - so a bucket that's uniformly busier or
+// quieter than its neighbors doesn't flag everything, or nothing, as hot.
+// math.Max against minThresholds is the sanity clamp: even if every peer in
+// the TopN is idle, the threshold never drops below the role's floor.
+func (f *hotPeerCache) calcHotThresholds(storeID uint64, role PeerRole) [dimLen]float64 {
+	minThresholds := minHotThresholds[f.kind][role]
+	tn, ok := f.peersOfStore[peerCacheKey{storeID, role}]
+	if !ok || tn.Len() < f.config.TopNN {
 		return minThresholds
 	}
 	ret := [dimLen]float64{
@@ -304,16 +548,18 @@ func (f *hotPeerCache) calcHotThresholds(storeID uint64) [dimLen]float64 {
 		otherOpsDim:  tn.GetTopNMin(otherOpsDim).(*HotPeerStat).OtherOps,
 	}
 	for k := 0; k < dimLen; k++ {
-		// ret[k] = math.Max(ret[k]*hotThresholdRatio, minThresholds[k])
-		ret[k] = minThresholds[k]
+		ret[k] = math.Max(ret[k]*f.config.HotThresholdRatio, minThresholds[k])
 	}
 	return ret
 }
 
 func (f *hotPeerCache) ReduceHotThresholds() {
-	minThresholds := minHotThresholds[f.kind]
-	for k := 0; k < dimLen; k++ {
-		minThresholds[k] /= 2
+	for _, role := range []PeerRole{Voter, Learner} {
+		minThresholds := minHotThresholds[f.kind][role]
+		for k := 0; k < dimLen; k++ {
+			minThresholds[k] /= 2
+		}
+		minHotThresholds[f.kind][role] = minThresholds
 	}
 }
 
@@ -359,7 +605,11 @@ func (f *hotPeerCache) isRegionHotWithPeer(region *core.RegionInfo, peer *metapb
 		return false
 	}
 	storeID := peer.GetStoreId()
-	if peers, ok := f.peersOfStore[storeID]; ok {
+	role := Voter
+	if peer.GetIsLearner() {
+		role = Learner
+	}
+	if peers, ok := f.peersOfStore[peerCacheKey{storeID, role}]; ok {
 		if stat := peers.Get(region.GetID()); stat != nil {
 			return stat.(*HotPeerStat).HotDegree >= hotDegree
 		}
@@ -367,22 +617,12 @@ func (f *hotPeerCache) isRegionHotWithPeer(region *core.RegionInfo, peer *metapb
 	return false
 }
 
-func (f *hotPeerCache) updateHotPeerStat(newItem, oldItem *HotPeerStat, storesStats *StoresStats) *HotPeerStat {
-	thresholds := f.calcHotThresholds(newItem.StoreID)
-	isHot := newItem.ByteRate >= thresholds[byteDim] ||
-		newItem.KeyRate >= thresholds[keyDim] ||
-		newItem.Ops >= thresholds[opsDim]
-
-	if updateWithOtherStats {
-		isHot = isHot || newItem.OtherByteRate >= thresholds[otherByteDim] ||
-			newItem.OtherKeyRate >= thresholds[otherKeyDim] ||
-			newItem.OtherOps >= thresholds[otherOpsDim]
-	}
-
+func (f *hotPeerCache) updateHotPeerStat(newItem, oldItem *HotPeerStat, storesStats *StoresStats, source sourceKind, interval time.Duration) *HotPeerStat {
 	if newItem.needDelete {
 		return newItem
 	}
 
+	newItem.sourceKind = source
 	if oldItem != nil {
 		newItem.rollingByteRate = oldItem.rollingByteRate
 		newItem.rollingKeyRate = oldItem.rollingKeyRate
@@ -390,36 +630,76 @@ func (f *hotPeerCache) updateHotPeerStat(newItem, oldItem *HotPeerStat, storesSt
 		newItem.rollingOtherByteRate = oldItem.rollingOtherByteRate
 		newItem.rollingOtherKeyRate = oldItem.rollingOtherKeyRate
 		newItem.rollingOtherOps = oldItem.rollingOtherOps
+	} else {
+		newItem.rollingByteRate = movingaverage.NewAvgOverTime(rollingWindow)
+		newItem.rollingKeyRate = movingaverage.NewAvgOverTime(rollingWindow)
+		newItem.rollingOps = movingaverage.NewAvgOverTime(rollingWindow)
+		newItem.rollingOtherByteRate = movingaverage.NewAvgOverTime(rollingWindow)
+		newItem.rollingOtherKeyRate = movingaverage.NewAvgOverTime(rollingWindow)
+		newItem.rollingOtherOps = movingaverage.NewAvgOverTime(rollingWindow)
+	}
+
+	// The rolling averages must absorb this sample before the hot/cold
+	// decision below reads them, so that decision reflects the
+	// interval-weighted rate rather than this one heartbeat's raw rate.
+	newItem.rollingByteRate.Add(newItem.ByteRate, interval)
+	newItem.rollingKeyRate.Add(newItem.KeyRate, interval)
+	newItem.rollingOps.Add(newItem.Ops, interval)
+	newItem.rollingOtherByteRate.Add(newItem.OtherByteRate, interval)
+	newItem.rollingOtherKeyRate.Add(newItem.OtherKeyRate, interval)
+	newItem.rollingOtherOps.Add(newItem.OtherOps, interval)
+
+	thresholds := f.calcHotThresholds(newItem.StoreID, newItem.Role)
+	isHot := newItem.rollingByteRate.Get() >= thresholds[byteDim] ||
+		newItem.rollingKeyRate.Get() >= thresholds[keyDim] ||
+		newItem.rollingOps.Get() >= thresholds[opsDim]
+
+	if updateWithOtherStats {
+		isHot = isHot || newItem.rollingOtherByteRate.Get() >= thresholds[otherByteDim] ||
+			newItem.rollingOtherKeyRate.Get() >= thresholds[otherKeyDim] ||
+			newItem.rollingOtherOps.Get() >= thresholds[otherOpsDim]
+	}
+
+	if oldItem != nil {
 		if isHot {
 			newItem.HotDegree = oldItem.HotDegree + 1
 			newItem.AntiCount = hotRegionAntiCount
 		} else {
 			newItem.HotDegree = oldItem.HotDegree - 1
-			newItem.AntiCount = oldItem.AntiCount - 1
-			if newItem.AntiCount <= 0 {
-				newItem.needDelete = true
+			// A single still-warming-up sample must not be allowed to
+			// start the countdown toward eviction - only once the
+			// rolling window has actually filled does a cold reading
+			// count against AntiCount, so a burst seen on one heartbeat
+			// can't instantly flip a region hot and then evict it again
+			// on the very next, merely under-reported, heartbeat.
+			if newItem.rollingByteRate.IsFull() {
+				newItem.AntiCount = oldItem.AntiCount - 1
+				if newItem.AntiCount <= 0 {
+					newItem.needDelete = true
+				}
+			} else {
+				newItem.AntiCount = oldItem.AntiCount
 			}
 		}
+		if source == Direct {
+			// Continuing on the same store: once observed hot on its own
+			// current sample, this peer has proven itself, regardless of
+			// whether it started out Direct or was itself inherited.
+			newItem.allowInherited = oldItem.allowInherited || isHot
+		} else {
+			// Just moved here, or just adopted a sibling's stat: it hasn't
+			// proven anything on this store yet, no matter how hot isHot
+			// says the inherited rolling windows currently read.
+			newItem.allowInherited = false
+		}
 	} else {
 		if !isHot {
 			return nil
 		}
-		newItem.rollingByteRate = NewMedianFilter(rollingWindowsSize)
-		newItem.rollingKeyRate = NewMedianFilter(rollingWindowsSize)
-		newItem.rollingOps = NewMedianFilter(rollingWindowsSize)
-		newItem.rollingOtherByteRate = NewMedianFilter(rollingWindowsSize)
-		newItem.rollingOtherKeyRate = NewMedianFilter(rollingWindowsSize)
-		newItem.rollingOtherOps = NewMedianFilter(rollingWindowsSize)
 		newItem.AntiCount = hotRegionAntiCount
 		newItem.isNew = true
+		newItem.allowInherited = true
 	}
 
-	newItem.rollingByteRate.Add(newItem.ByteRate)
-	newItem.rollingKeyRate.Add(newItem.KeyRate)
-	newItem.rollingOps.Add(newItem.Ops)
-	newItem.rollingOtherByteRate.Add(newItem.OtherByteRate)
-	newItem.rollingOtherKeyRate.Add(newItem.OtherKeyRate)
-	newItem.rollingOtherOps.Add(newItem.OtherOps)
-
 	return newItem
 }
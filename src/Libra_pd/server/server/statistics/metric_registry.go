@@ -0,0 +1,164 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statistics
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// MetricKind classifies what a registered store metric's value represents,
+// the same distinction runtime/metrics draws between a counter, a gauge,
+// and a distribution.
+type MetricKind int
+
+const (
+	// MetricKindRate is a value computed over a sliding time window, like
+	// the existing TimeMedian-backed accessors.
+	MetricKindRate MetricKind = iota
+	// MetricKindGauge is an instantaneous, unwindowed value.
+	MetricKindGauge
+	// MetricKindHistogram is derived from a decaying histogram, e.g. a tail
+	// quantile.
+	MetricKindHistogram
+)
+
+// MetricDesc describes one store metric available through the registry.
+type MetricDesc struct {
+	Kind MetricKind
+	Help string
+}
+
+// Sample names one store metric to read; StoresStats.Read fills in Kind,
+// Value, and Found in place.
+type Sample struct {
+	Name    string
+	StoreID uint64
+
+	Kind  MetricKind
+	Value float64
+	Found bool
+}
+
+type registeredStoreMetric struct {
+	desc    MetricDesc
+	compute func(*RollingStoreStats) float64
+}
+
+var (
+	storeMetricRegistryMu sync.RWMutex
+	storeMetricRegistry   = make(map[string]*registeredStoreMetric)
+)
+
+// RegisterStoreMetric registers a store metric under name, computed from a
+// store's RollingStoreStats by compute. It's meant to be called from
+// package init - like runtime/metrics' fixed metric set, the registry is
+// expected to be fully populated before any StoresStats.Read or All() call.
+// Registering the same name twice panics, since that's always a programming
+// error rather than something a caller should recover from.
+func RegisterStoreMetric(name string, desc MetricDesc, compute func(*RollingStoreStats) float64) {
+	storeMetricRegistryMu.Lock()
+	defer storeMetricRegistryMu.Unlock()
+	if _, ok := storeMetricRegistry[name]; ok {
+		panic(fmt.Sprintf("statistics: store metric %q already registered", name))
+	}
+	storeMetricRegistry[name] = &registeredStoreMetric{desc: desc, compute: compute}
+}
+
+// All returns the names of every registered store metric, sorted, so
+// schedulers and the API layer can discover the available metric surface
+// instead of hardcoding accessor calls.
+func All() []string {
+	storeMetricRegistryMu.RLock()
+	defer storeMetricRegistryMu.RUnlock()
+	names := make([]string, 0, len(storeMetricRegistry))
+	for name := range storeMetricRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Describe returns the MetricDesc registered under name.
+func Describe(name string) (desc MetricDesc, ok bool) {
+	storeMetricRegistryMu.RLock()
+	defer storeMetricRegistryMu.RUnlock()
+	m, ok := storeMetricRegistry[name]
+	if !ok {
+		return MetricDesc{}, false
+	}
+	return m.desc, true
+}
+
+// Read fills in Kind, Value, and Found on every element of samples, reading
+// from s's current snapshot. A Sample naming an unregistered metric or an
+// unknown store is left with Found=false.
+func (s *StoresStats) Read(samples []Sample) {
+	if len(samples) == 0 {
+		return
+	}
+	storeMetricRegistryMu.RLock()
+	defer storeMetricRegistryMu.RUnlock()
+	snapshot := s.snapshotMap()
+	for i := range samples {
+		samples[i].Found = false
+		m, ok := storeMetricRegistry[samples[i].Name]
+		if !ok {
+			continue
+		}
+		samples[i].Kind = m.desc.Kind
+		stats, ok := snapshot[samples[i].StoreID]
+		if !ok {
+			continue
+		}
+		samples[i].Value = m.compute(stats)
+		samples[i].Found = true
+	}
+}
+
+func init() {
+	RegisterStoreMetric("store/bytes_write:rate", MetricDesc{Kind: MetricKindRate, Help: "store write byte rate"},
+		(*RollingStoreStats).GetBytesWriteRate)
+	RegisterStoreMetric("store/bytes_write_leader:rate", MetricDesc{Kind: MetricKindRate, Help: "store write byte rate for leader regions"},
+		(*RollingStoreStats).GetBytesWriteLeaderRate)
+	RegisterStoreMetric("store/bytes_read:rate", MetricDesc{Kind: MetricKindRate, Help: "store read byte rate"},
+		(*RollingStoreStats).GetBytesReadRate)
+	RegisterStoreMetric("store/keys_write:rate", MetricDesc{Kind: MetricKindRate, Help: "store write key rate"},
+		(*RollingStoreStats).GetKeysWriteRate)
+	RegisterStoreMetric("store/keys_write_leader:rate", MetricDesc{Kind: MetricKindRate, Help: "store write key rate for leader regions"},
+		(*RollingStoreStats).GetKeysWriteLeaderRate)
+	RegisterStoreMetric("store/keys_read:rate", MetricDesc{Kind: MetricKindRate, Help: "store read key rate"},
+		(*RollingStoreStats).GetKeysReadRate)
+	RegisterStoreMetric("store/ops_read:rate", MetricDesc{Kind: MetricKindRate, Help: "store read ops rate"},
+		(*RollingStoreStats).GetOpsRead)
+	RegisterStoreMetric("store/ops_write:rate", MetricDesc{Kind: MetricKindRate, Help: "store write ops rate"},
+		(*RollingStoreStats).GetOpsWrite)
+	RegisterStoreMetric("store/cpu:usage", MetricDesc{Kind: MetricKindGauge, Help: "store CPU usage"},
+		(*RollingStoreStats).GetCPUUsage)
+	RegisterStoreMetric("store/disk_read:rate", MetricDesc{Kind: MetricKindRate, Help: "store disk read rate"},
+		(*RollingStoreStats).GetDiskReadRate)
+	RegisterStoreMetric("store/disk_write:rate", MetricDesc{Kind: MetricKindRate, Help: "store disk write rate"},
+		(*RollingStoreStats).GetDiskWriteRate)
+	RegisterStoreMetric("store/network_read:rate", MetricDesc{Kind: MetricKindRate, Help: "store network read rate from the active MetricSource"},
+		(*RollingStoreStats).GetNetworkReadRate)
+	RegisterStoreMetric("store/network_write:rate", MetricDesc{Kind: MetricKindRate, Help: "store network write rate from the active MetricSource"},
+		(*RollingStoreStats).GetNetworkWriteRate)
+	RegisterStoreMetric("store/available_disk_space:gauge", MetricDesc{Kind: MetricKindGauge, Help: "store available disk space"},
+		(*RollingStoreStats).GetAvailableDiskSpace)
+	RegisterStoreMetric("store/io_utilization:gauge", MetricDesc{Kind: MetricKindGauge, Help: "store IO utilization percentage"},
+		(*RollingStoreStats).GetIOUtilizationPercent)
+	RegisterStoreMetric("store/bytes_write_p99:histogram", MetricDesc{Kind: MetricKindHistogram, Help: "store write byte rate, P99"},
+		func(r *RollingStoreStats) float64 { return r.GetBytesWriteQuantile(0.99) })
+}
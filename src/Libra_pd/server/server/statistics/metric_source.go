@@ -0,0 +1,319 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statistics
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+// StoreMetrics is a snapshot of per-store telemetry a MetricSource can
+// supply beyond what a pdpb.StoreStats heartbeat already carries. A source
+// that can't measure a given dimension leaves it at its zero value.
+type StoreMetrics struct {
+	NetworkReadRate      float64
+	NetworkWriteRate     float64
+	AvailableDiskSpace   float64
+	IOUtilizationPercent float64
+}
+
+// MetricSource abstracts where a store's supplemental telemetry comes from,
+// so StoresStats doesn't need to know whether it's reading a pdpb heartbeat
+// field, a Prometheus query result, or a /proc file.
+type MetricSource interface {
+	// CollectStoreMetrics returns the latest StoreMetrics known for
+	// storeID, or ok=false if the source has nothing for it yet.
+	CollectStoreMetrics(storeID uint64) (metrics StoreMetrics, ok bool)
+}
+
+// pdpbMetricSource is the default MetricSource: it derives
+// AvailableDiskSpace from the same pdpb.StoreStats heartbeats
+// RollingStoreStats.Observe already consumes. TiKV's heartbeat doesn't
+// report network throughput or an IO utilization percentage directly, so
+// those two fields are always left at 0 under this source - a
+// ProcMetricSource or PrometheusMetricSource is needed for them.
+type pdpbMetricSource struct {
+	stores *StoresStats
+}
+
+// NewPDPBMetricSource creates the default MetricSource, reading
+// AvailableDiskSpace from each store's most recently observed heartbeat.
+func NewPDPBMetricSource(stores *StoresStats) MetricSource {
+	return &pdpbMetricSource{stores: stores}
+}
+
+func (p *pdpbMetricSource) CollectStoreMetrics(storeID uint64) (StoreMetrics, bool) {
+	rolling := p.stores.GetRollingStoreStats(storeID)
+	if rolling == nil {
+		return StoreMetrics{}, false
+	}
+	available, ok := rolling.GetLastAvailable()
+	if !ok {
+		return StoreMetrics{}, false
+	}
+	return StoreMetrics{AvailableDiskSpace: available}, true
+}
+
+// ProcMetricSource reads network and disk telemetry directly from /proc, for
+// the single local TiKV instance a colocated PD polls on an interval - the
+// same /proc-and-cgroup-scraping approach used by host-level resource
+// pollers when the workload being measured can't report a metric itself.
+type ProcMetricSource struct {
+	// LocalStoreID is the store ID of the TiKV instance colocated with this
+	// PD process - /proc counters are host-wide, so they're only
+	// meaningful attributed to the one store actually running on this host.
+	LocalStoreID uint64
+	// NetDevPath and DiskStatsPath default to the real /proc paths; they're
+	// fields rather than constants so a test can point them at a fixture.
+	NetDevPath    string
+	DiskStatsPath string
+
+	mu      sync.RWMutex
+	latest  StoreMetrics
+	hasRead bool
+
+	prevRxBytes, prevTxBytes uint64
+	prevIOTicksMs            uint64
+	prevSampleTime           time.Time
+}
+
+// NewProcMetricSource creates a ProcMetricSource for localStoreID, reading
+// from the real /proc on Run.
+func NewProcMetricSource(localStoreID uint64) *ProcMetricSource {
+	return &ProcMetricSource{
+		LocalStoreID:  localStoreID,
+		NetDevPath:    "/proc/net/dev",
+		DiskStatsPath: "/proc/diskstats",
+	}
+}
+
+// Run polls /proc every interval until ctx is done.
+func (p *ProcMetricSource) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.poll()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *ProcMetricSource) poll() {
+	now := time.Now()
+	rx, tx, netErr := readNetDevTotals(p.NetDevPath)
+	if netErr != nil {
+		log.Warn("failed to read /proc/net/dev", zap.Error(netErr))
+	}
+	ticksMs, diskErr := readDiskIOTicksMs(p.DiskStatsPath)
+	if diskErr != nil {
+		log.Warn("failed to read /proc/diskstats", zap.Error(diskErr))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.hasRead {
+		p.prevRxBytes, p.prevTxBytes = rx, tx
+		p.prevIOTicksMs = ticksMs
+		p.prevSampleTime = now
+		p.hasRead = true
+		return
+	}
+	elapsed := now.Sub(p.prevSampleTime).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	if netErr == nil {
+		p.latest.NetworkReadRate = float64(rx-p.prevRxBytes) / elapsed
+		p.latest.NetworkWriteRate = float64(tx-p.prevTxBytes) / elapsed
+		p.prevRxBytes, p.prevTxBytes = rx, tx
+	}
+	if diskErr == nil {
+		p.latest.IOUtilizationPercent = float64(ticksMs-p.prevIOTicksMs) / (elapsed * 1000) * 100
+		p.prevIOTicksMs = ticksMs
+	}
+	p.prevSampleTime = now
+}
+
+// CollectStoreMetrics implements MetricSource. Every storeID but
+// p.LocalStoreID misses, since /proc only describes this host.
+func (p *ProcMetricSource) CollectStoreMetrics(storeID uint64) (StoreMetrics, bool) {
+	if storeID != p.LocalStoreID {
+		return StoreMetrics{}, false
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if !p.hasRead {
+		return StoreMetrics{}, false
+	}
+	return p.latest, true
+}
+
+// readNetDevTotals sums received/transmitted bytes across every interface in
+// path except loopback.
+func readNetDevTotals(path string) (rxBytes, txBytes uint64, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		if lineNo <= 2 {
+			continue // two header lines
+		}
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "lo" {
+			continue
+		}
+		fields := strings.Fields(parts[1])
+		if len(fields) < 9 {
+			continue
+		}
+		rx, rxErr := strconv.ParseUint(fields[0], 10, 64)
+		tx, txErr := strconv.ParseUint(fields[8], 10, 64)
+		if rxErr != nil || txErr != nil {
+			continue
+		}
+		rxBytes += rx
+		txBytes += tx
+	}
+	return rxBytes, txBytes, scanner.Err()
+}
+
+// readDiskIOTicksMs sums the "time spent doing I/Os" column (the input to
+// iostat's %util) across every non-loop, non-ram device in path.
+func readDiskIOTicksMs(path string) (ticksMs uint64, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 13 {
+			continue
+		}
+		name := fields[2]
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") {
+			continue
+		}
+		t, parseErr := strconv.ParseUint(fields[12], 10, 64)
+		if parseErr != nil {
+			continue
+		}
+		ticksMs += t
+	}
+	return ticksMs, scanner.Err()
+}
+
+// PrometheusQueryer runs a single instant PromQL query and returns its
+// scalar result. It's an interface rather than a concrete HTTP client so
+// this package doesn't need to vendor a Prometheus client just to define
+// the adapter shape; callers wire in whatever client the deployment uses.
+type PrometheusQueryer interface {
+	Query(ctx context.Context, query string) (float64, error)
+}
+
+// PrometheusMetricSource polls three per-store PromQL queries - network
+// read rate, network write rate and IO utilization percent - on an interval
+// and caches the latest result per store. It does not query TiKV thread CPU
+// or RocksDB read amplification; StoreMetrics has no field for either.
+type PrometheusMetricSource struct {
+	queryer PrometheusQueryer
+	// QueryTemplate builds the PromQL query for a metric/store pair, e.g.
+	// by substituting an `instance="<store address>"` label selector.
+	QueryTemplate func(metric string, storeID uint64) string
+
+	mu     sync.RWMutex
+	latest map[uint64]StoreMetrics
+}
+
+// Metric names passed to QueryTemplate.
+const (
+	prometheusMetricNetworkReadRate      = "network_read_rate"
+	prometheusMetricNetworkWriteRate     = "network_write_rate"
+	prometheusMetricIOUtilizationPercent = "io_utilization_percent"
+)
+
+// NewPrometheusMetricSource creates a PrometheusMetricSource that runs its
+// queries through queryer, built from queryTemplate.
+func NewPrometheusMetricSource(queryer PrometheusQueryer, queryTemplate func(metric string, storeID uint64) string) *PrometheusMetricSource {
+	return &PrometheusMetricSource{
+		queryer:       queryer,
+		QueryTemplate: queryTemplate,
+		latest:        make(map[uint64]StoreMetrics),
+	}
+}
+
+// Poll runs every configured query for storeID and caches the result.
+func (p *PrometheusMetricSource) Poll(ctx context.Context, storeID uint64) error {
+	read, err := p.queryer.Query(ctx, p.QueryTemplate(prometheusMetricNetworkReadRate, storeID))
+	if err != nil {
+		return err
+	}
+	write, err := p.queryer.Query(ctx, p.QueryTemplate(prometheusMetricNetworkWriteRate, storeID))
+	if err != nil {
+		return err
+	}
+	ioUtil, err := p.queryer.Query(ctx, p.QueryTemplate(prometheusMetricIOUtilizationPercent, storeID))
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.latest[storeID] = StoreMetrics{NetworkReadRate: read, NetworkWriteRate: write, IOUtilizationPercent: ioUtil}
+	p.mu.Unlock()
+	return nil
+}
+
+// Run polls every store ID returned by storeIDs on interval until ctx is
+// done, logging and continuing past a single store's query failure rather
+// than letting it block the rest.
+func (p *PrometheusMetricSource) Run(ctx context.Context, interval time.Duration, storeIDs func() []uint64) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, storeID := range storeIDs() {
+				if err := p.Poll(ctx, storeID); err != nil {
+					log.Warn("failed to poll prometheus store metrics", zap.Uint64("store-id", storeID), zap.Error(err))
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// CollectStoreMetrics implements MetricSource.
+func (p *PrometheusMetricSource) CollectStoreMetrics(storeID uint64) (StoreMetrics, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	m, ok := p.latest[storeID]
+	return m, ok
+}
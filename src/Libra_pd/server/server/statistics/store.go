@@ -14,7 +14,10 @@
 package statistics
 
 import (
+	"context"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pingcap/kvproto/pkg/pdpb"
@@ -23,65 +26,242 @@ import (
 	"go.uber.org/zap"
 )
 
-// StoresStats is a cache hold hot regions.
-type StoresStats struct {
+// storesStatsShardCount is the number of independent storesStatsShards a
+// StoresStats splits its stores across (by storeID % storesStatsShardCount),
+// so heartbeats for stores on different shards never contend with each
+// other's ingest worker.
+const storesStatsShardCount = 16
+
+// storesStatsTaskQueueLength bounds the number of tasks buffered per shard
+// before the oldest pending task is dropped, the same trade-off
+// hotCacheTaskQueueLength makes in hot_cache.go: falling behind the
+// heartbeat stream is worse than losing a stale sample.
+const storesStatsTaskQueueLength = 1000
+
+// storesStatsTaskQueueSizeGauge and storesStatsTaskDroppedCounter, like
+// hotCacheTaskQueueSizeGauge and hotCacheTaskDroppedCounter in hot_cache.go,
+// are Prometheus vectors this package assumes are registered elsewhere;
+// this source tree has no metrics.go to declare them in.
+
+// storesStatsShard owns one slice of the store ID space: its own
+// RollingStoreStats map and its own task queue, so its worker goroutine
+// never has to coordinate with any other shard's.
+type storesStatsShard struct {
 	sync.RWMutex
 	rollingStoresStats map[uint64]*RollingStoreStats
-	bytesReadRate      float64
-	bytesWriteRate     float64
-	keysReadRate       float64
-	keysWriteRate      float64
-	opsRead            float64
-	opsWrite           float64
+	tasks              chan storesStatsTask
 }
 
-// NewStoresStats creates a new hot spot cache.
-func NewStoresStats() *StoresStats {
-	return &StoresStats{
+func newStoresStatsShard() *storesStatsShard {
+	return &storesStatsShard{
 		rollingStoresStats: make(map[uint64]*RollingStoreStats),
+		tasks:              make(chan storesStatsTask, storesStatsTaskQueueLength),
+	}
+}
+
+// StoresStats is a cache hold hot regions. Observe enqueues onto a per-shard
+// worker goroutine instead of taking a lock inline, so heartbeat handling
+// never blocks on it; every read method serves from snapshot, an
+// atomically-swapped view refreshed after each shard finishes a batch of
+// queued tasks.
+type StoresStats struct {
+	shards   []*storesStatsShard
+	snapshot atomic.Value // map[uint64]*RollingStoreStats
+
+	totalsMu       sync.RWMutex
+	bytesReadRate  float64
+	bytesWriteRate float64
+	keysReadRate   float64
+	keysWriteRate  float64
+	opsRead        float64
+	opsWrite       float64
+
+	metricSourceMu sync.RWMutex
+	metricSource   MetricSource
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewStoresStats creates a new hot spot cache. Call Start before Observe-ing
+// any heartbeats.
+func NewStoresStats() *StoresStats {
+	s := &StoresStats{
+		shards: make([]*storesStatsShard, storesStatsShardCount),
+	}
+	for i := range s.shards {
+		s.shards[i] = newStoresStatsShard()
+	}
+	s.snapshot.Store(make(map[uint64]*RollingStoreStats))
+	s.metricSource = NewPDPBMetricSource(s)
+	return s
+}
+
+// Start starts one worker goroutine per shard, draining its task queue and
+// refreshing the read snapshot after each batch. The goroutines run until
+// ctx is done or Stop is called.
+func (s *StoresStats) Start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+	for _, shard := range s.shards {
+		s.wg.Add(1)
+		go func(shard *storesStatsShard) {
+			defer s.wg.Done()
+			s.runShardWorker(ctx, shard)
+		}(shard)
+	}
+}
+
+// Stop stops every shard worker goroutine and waits for them to exit.
+func (s *StoresStats) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+}
+
+func (s *StoresStats) runShardWorker(ctx context.Context, shard *storesStatsShard) {
+	for {
+		select {
+		case task := <-shard.tasks:
+			s.drainShardBatch(shard, task)
+			s.refreshSnapshot()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// drainShardBatch runs task, then keeps running whatever else is already
+// queued on shard without releasing its lock, so a burst of heartbeats for
+// the same shard's stores is applied as one batch before the snapshot is
+// refreshed.
+func (s *StoresStats) drainShardBatch(shard *storesStatsShard, task storesStatsTask) {
+	shard.Lock()
+	defer shard.Unlock()
+	task.runLocked(shard)
+	for {
+		select {
+		case task := <-shard.tasks:
+			task.runLocked(shard)
+		default:
+			return
+		}
+	}
+}
+
+// refreshSnapshot merges every shard's current RollingStoreStats into a new
+// map and atomically swaps it in, so concurrent readers always see a
+// consistent, lock-free view.
+func (s *StoresStats) refreshSnapshot() {
+	merged := make(map[uint64]*RollingStoreStats)
+	for _, shard := range s.shards {
+		shard.RLock()
+		for storeID, stats := range shard.rollingStoresStats {
+			merged[storeID] = stats
+		}
+		shard.RUnlock()
+	}
+	s.snapshot.Store(merged)
+}
+
+func (s *StoresStats) snapshotMap() map[uint64]*RollingStoreStats {
+	return s.snapshot.Load().(map[uint64]*RollingStoreStats)
+}
+
+func (s *StoresStats) shardFor(storeID uint64) *storesStatsShard {
+	return s.shards[storeID%uint64(len(s.shards))]
+}
+
+// enqueue schedules task on storeID's shard worker without blocking. If the
+// shard's queue is backed up, the oldest queued task is dropped to make
+// room, mirroring HotCache.enqueue in hot_cache.go.
+func (s *StoresStats) enqueue(storeID uint64, task storesStatsTask) {
+	s.enqueueToShard(s.shardFor(storeID), task)
+}
+
+func (s *StoresStats) enqueueToShard(shard *storesStatsShard, task storesStatsTask) {
+	select {
+	case shard.tasks <- task:
+		return
+	default:
+	}
+	select {
+	case <-shard.tasks:
+		storesStatsTaskDroppedCounter.Inc()
+	default:
+	}
+	select {
+	case shard.tasks <- task:
+	default:
+	}
+}
+
+// CollectMetrics publishes each shard's current task queue depth.
+func (s *StoresStats) CollectMetrics() {
+	for i, shard := range s.shards {
+		storesStatsTaskQueueSizeGauge.WithLabelValues(strconv.Itoa(i)).Set(float64(len(shard.tasks)))
 	}
 }
 
 // CreateRollingStoreStats creates RollingStoreStats with a given store ID.
 func (s *StoresStats) CreateRollingStoreStats(storeID uint64) {
-	s.Lock()
-	defer s.Unlock()
-	s.rollingStoresStats[storeID] = newRollingStoreStats()
+	shard := s.shardFor(storeID)
+	shard.Lock()
+	shard.rollingStoresStats[storeID] = newRollingStoreStats()
+	shard.Unlock()
+	s.refreshSnapshot()
 }
 
 // RemoveRollingStoreStats removes RollingStoreStats with a given store ID.
+// It goes through storeID's shard task queue, as Observe does, so it can't
+// race a heartbeat for the same store that's still being applied.
 func (s *StoresStats) RemoveRollingStoreStats(storeID uint64) {
-	s.Lock()
-	defer s.Unlock()
-	delete(s.rollingStoresStats, storeID)
+	done := make(chan struct{})
+	s.enqueue(storeID, newRemoveStoreStatsTask(storeID))
+	s.enqueue(storeID, &storesStatsWaitTask{done: done})
+	<-done
+	s.refreshSnapshot()
 }
 
 // GetRollingStoreStats gets RollingStoreStats with a given store ID.
 func (s *StoresStats) GetRollingStoreStats(storeID uint64) *RollingStoreStats {
-	s.RLock()
-	defer s.RUnlock()
-	return s.rollingStoresStats[storeID]
+	if stats, ok := s.snapshotMap()[storeID]; ok {
+		return stats
+	}
+	shard := s.shardFor(storeID)
+	shard.RLock()
+	defer shard.RUnlock()
+	return shard.rollingStoresStats[storeID]
 }
 
-// GetOrCreateRollingStoreStats gets or creates RollingStoreStats with a given store ID.
+// GetOrCreateRollingStoreStats gets or creates RollingStoreStats with a
+// given store ID, bypassing the task queue since store creation isn't on
+// the heartbeat hot path.
 func (s *StoresStats) GetOrCreateRollingStoreStats(storeID uint64) *RollingStoreStats {
-	s.Lock()
-	defer s.Unlock()
-	ret, ok := s.rollingStoresStats[storeID]
-	if !ok {
+	shard := s.shardFor(storeID)
+	shard.Lock()
+	ret, created := shard.rollingStoresStats[storeID]
+	if !created {
 		ret = newRollingStoreStats()
-		s.rollingStoresStats[storeID] = ret
+		shard.rollingStoresStats[storeID] = ret
+	}
+	shard.Unlock()
+	if !created {
+		s.refreshSnapshot()
 	}
 	return ret
 }
 
-// Observe records the current store status with a given store.
+// Observe enqueues the current store status for storeID onto its shard's
+// worker without blocking the heartbeat path.
 func (s *StoresStats) Observe(storeID uint64, stats *pdpb.StoreStats) {
-	store := s.GetOrCreateRollingStoreStats(storeID)
-	store.Observe(stats)
+	s.enqueue(storeID, newObserveStoreStatsTask(storeID, stats))
 }
 
-// Set sets the store statistics (for test).
+// Set sets the store statistics (for test). Unlike Observe it applies
+// synchronously, since tests generally want to read back the effect
+// immediately.
 func (s *StoresStats) Set(storeID uint64, stats *pdpb.StoreStats) {
 	store := s.GetOrCreateRollingStoreStats(storeID)
 	store.Set(stats)
@@ -93,11 +273,10 @@ func (s *StoresStats) UpdateTotalBytesRate(f func() []*core.StoreInfo) {
 	var totalBytesReadRate float64
 	var writeRate, readRate float64
 	ss := f()
-	s.RLock()
-	defer s.RUnlock()
+	snapshot := s.snapshotMap()
 	for _, store := range ss {
 		if store.IsUp() {
-			stats, ok := s.rollingStoresStats[store.GetID()]
+			stats, ok := snapshot[store.GetID()]
 			if !ok {
 				continue
 			}
@@ -106,8 +285,10 @@ func (s *StoresStats) UpdateTotalBytesRate(f func() []*core.StoreInfo) {
 			totalBytesReadRate += readRate
 		}
 	}
+	s.totalsMu.Lock()
 	s.bytesWriteRate = totalBytesWriteRate
 	s.bytesReadRate = totalBytesReadRate
+	s.totalsMu.Unlock()
 }
 
 // UpdateTotalKeysRate updates the total keys write rate and read rate.
@@ -116,11 +297,10 @@ func (s *StoresStats) UpdateTotalKeysRate(f func() []*core.StoreInfo) {
 	var totalKeysReadRate float64
 	var writeRate, readRate float64
 	ss := f()
-	s.RLock()
-	defer s.RUnlock()
+	snapshot := s.snapshotMap()
 	for _, store := range ss {
 		if store.IsUp() {
-			stats, ok := s.rollingStoresStats[store.GetID()]
+			stats, ok := snapshot[store.GetID()]
 			if !ok {
 				continue
 			}
@@ -129,8 +309,10 @@ func (s *StoresStats) UpdateTotalKeysRate(f func() []*core.StoreInfo) {
 			totalKeysReadRate += readRate
 		}
 	}
+	s.totalsMu.Lock()
 	s.keysWriteRate = totalKeysWriteRate
 	s.keysReadRate = totalKeysReadRate
+	s.totalsMu.Unlock()
 }
 
 // UpdateTotalOps updates the total ops infos.
@@ -139,11 +321,10 @@ func (s *StoresStats) UpdateTotalOps(f func() []*core.StoreInfo) {
 	var totalOpsWrite float64
 	var opsRead, opsWrite float64
 	ss := f()
-	s.RLock()
-	defer s.RUnlock()
+	snapshot := s.snapshotMap()
 	for _, store := range ss {
 		if store.IsUp() {
-			stats, ok := s.rollingStoresStats[store.GetID()]
+			stats, ok := snapshot[store.GetID()]
 			if !ok {
 				continue
 			}
@@ -153,45 +334,57 @@ func (s *StoresStats) UpdateTotalOps(f func() []*core.StoreInfo) {
 			totalOpsWrite += opsWrite
 		}
 	}
+	s.totalsMu.Lock()
 	s.opsRead = totalOpsRead
 	s.opsWrite = totalOpsWrite
+	s.totalsMu.Unlock()
 }
 
 // TotalBytesWriteRate returns the total written bytes rate of all StoreInfo.
 func (s *StoresStats) TotalBytesWriteRate() float64 {
+	s.totalsMu.RLock()
+	defer s.totalsMu.RUnlock()
 	return s.bytesWriteRate
 }
 
 // TotalBytesReadRate returns the total read bytes rate of all StoreInfo.
 func (s *StoresStats) TotalBytesReadRate() float64 {
+	s.totalsMu.RLock()
+	defer s.totalsMu.RUnlock()
 	return s.bytesReadRate
 }
 
 // TotalKeysWriteRate returns the total written keys rate of all StoreInfo.
 func (s *StoresStats) TotalKeysWriteRate() float64 {
+	s.totalsMu.RLock()
+	defer s.totalsMu.RUnlock()
 	return s.keysWriteRate
 }
 
 // TotalKeysReadRate returns the total read keys rate of all StoreInfo.
 func (s *StoresStats) TotalKeysReadRate() float64 {
+	s.totalsMu.RLock()
+	defer s.totalsMu.RUnlock()
 	return s.keysReadRate
 }
 
 // TotalOpsRead returns the total read ops of all StoreInfo.
 func (s *StoresStats) TotalOpsRead() float64 {
+	s.totalsMu.RLock()
+	defer s.totalsMu.RUnlock()
 	return s.opsRead
 }
 
 // TotalOpsWrite returns the total write ops of all StoreInfo.
 func (s *StoresStats) TotalOpsWrite() float64 {
+	s.totalsMu.RLock()
+	defer s.totalsMu.RUnlock()
 	return s.opsWrite
 }
 
 // GetStoreBytesRate returns the bytes write stat of the specified store.
 func (s *StoresStats) GetStoreBytesRate(storeID uint64) (writeRate float64, readRate float64) {
-	s.RLock()
-	defer s.RUnlock()
-	if storeStat, ok := s.rollingStoresStats[storeID]; ok {
+	if storeStat, ok := s.snapshotMap()[storeID]; ok {
 		return storeStat.GetBytesRate()
 	}
 	return 0, 0
@@ -199,9 +392,7 @@ func (s *StoresStats) GetStoreBytesRate(storeID uint64) (writeRate float64, read
 
 // GetStoreCPUUsage returns the total cpu usages of threads of the specified store.
 func (s *StoresStats) GetStoreCPUUsage(storeID uint64) float64 {
-	s.RLock()
-	defer s.RUnlock()
-	if storeStat, ok := s.rollingStoresStats[storeID]; ok {
+	if storeStat, ok := s.snapshotMap()[storeID]; ok {
 		return storeStat.GetCPUUsage()
 	}
 	return 0
@@ -209,9 +400,7 @@ func (s *StoresStats) GetStoreCPUUsage(storeID uint64) float64 {
 
 // GetStoreDiskReadRate returns the total read disk io rate of threads of the specified store.
 func (s *StoresStats) GetStoreDiskReadRate(storeID uint64) float64 {
-	s.RLock()
-	defer s.RUnlock()
-	if storeStat, ok := s.rollingStoresStats[storeID]; ok {
+	if storeStat, ok := s.snapshotMap()[storeID]; ok {
 		return storeStat.GetDiskReadRate()
 	}
 	return 0
@@ -219,9 +408,7 @@ func (s *StoresStats) GetStoreDiskReadRate(storeID uint64) float64 {
 
 // GetStoreDiskWriteRate returns the total write disk io rate of threads of the specified store.
 func (s *StoresStats) GetStoreDiskWriteRate(storeID uint64) float64 {
-	s.RLock()
-	defer s.RUnlock()
-	if storeStat, ok := s.rollingStoresStats[storeID]; ok {
+	if storeStat, ok := s.snapshotMap()[storeID]; ok {
 		return storeStat.GetDiskWriteRate()
 	}
 	return 0
@@ -250,9 +437,7 @@ func (s *StoresStats) GetStoresDiskWriteRate() map[uint64]float64 {
 
 // GetStoreBytesWriteRate returns the bytes write stat of the specified store.
 func (s *StoresStats) GetStoreBytesWriteRate(storeID uint64) float64 {
-	s.RLock()
-	defer s.RUnlock()
-	if storeStat, ok := s.rollingStoresStats[storeID]; ok {
+	if storeStat, ok := s.snapshotMap()[storeID]; ok {
 		return storeStat.GetBytesWriteRate()
 	}
 	return 0
@@ -260,9 +445,7 @@ func (s *StoresStats) GetStoreBytesWriteRate(storeID uint64) float64 {
 
 // GetStoreBytesReadRate returns the bytes read stat of the specified store.
 func (s *StoresStats) GetStoreBytesReadRate(storeID uint64) float64 {
-	s.RLock()
-	defer s.RUnlock()
-	if storeStat, ok := s.rollingStoresStats[storeID]; ok {
+	if storeStat, ok := s.snapshotMap()[storeID]; ok {
 		return storeStat.GetBytesReadRate()
 	}
 	return 0
@@ -275,6 +458,15 @@ func (s *StoresStats) GetStoresBytesWriteStat() map[uint64]float64 {
 	})
 }
 
+// GetStoresBytesWriteQuantileStat returns the q-th quantile (q in (0,1)) of
+// every store's recently observed write-byte rate, e.g. for a scheduler
+// that wants to react to P99 hotspots a median would smooth away.
+func (s *StoresStats) GetStoresBytesWriteQuantileStat(q float64) map[uint64]float64 {
+	return s.getStat(func(stats *RollingStoreStats) float64 {
+		return stats.GetBytesWriteQuantile(q)
+	})
+}
+
 // GetStoresBytesWriteLeaderStat returns the bytes write leader stat of all StoreInfo.
 func (s *StoresStats) GetStoresBytesWriteLeaderStat() map[uint64]float64 {
 	return s.getStat(func(stats *RollingStoreStats) float64 {
@@ -324,6 +516,38 @@ func (s *StoresStats) GetStoresOpsWriteStat() map[uint64]float64 {
 	})
 }
 
+// GetStoresNetworkReadStat returns the network read rate stat of all
+// StoreInfo, sourced from whatever MetricSource SetMetricSource last set.
+func (s *StoresStats) GetStoresNetworkReadStat() map[uint64]float64 {
+	return s.getStat(func(stats *RollingStoreStats) float64 {
+		return stats.GetNetworkReadRate()
+	})
+}
+
+// GetStoresNetworkWriteStat returns the network write rate stat of all
+// StoreInfo, sourced from whatever MetricSource SetMetricSource last set.
+func (s *StoresStats) GetStoresNetworkWriteStat() map[uint64]float64 {
+	return s.getStat(func(stats *RollingStoreStats) float64 {
+		return stats.GetNetworkWriteRate()
+	})
+}
+
+// GetStoresAvailableDiskSpaceStat returns the available disk space stat of
+// all StoreInfo.
+func (s *StoresStats) GetStoresAvailableDiskSpaceStat() map[uint64]float64 {
+	return s.getStat(func(stats *RollingStoreStats) float64 {
+		return stats.GetAvailableDiskSpace()
+	})
+}
+
+// GetStoresIOUtilizationStat returns the IO utilization percent stat of all
+// StoreInfo.
+func (s *StoresStats) GetStoresIOUtilizationStat() map[uint64]float64 {
+	return s.getStat(func(stats *RollingStoreStats) float64 {
+		return stats.GetIOUtilizationPercent()
+	})
+}
+
 // GetStoresLoadsStat returns all of the load stats of all StoreInfo.
 func (s *StoresStats) GetStoresLoadsStat() (ret []map[uint64]float64) {
 	ret = append(ret,
@@ -336,34 +560,108 @@ func (s *StoresStats) GetStoresLoadsStat() (ret []map[uint64]float64) {
 		s.GetStoresBytesWriteStat(),
 		s.GetStoresKeysWriteStat(),
 		s.GetStoresOpsWriteStat(),
+		s.GetStoresNetworkReadStat(),
+		s.GetStoresNetworkWriteStat(),
+		s.GetStoresAvailableDiskSpaceStat(),
+		s.GetStoresIOUtilizationStat(),
 	)
 	return
 }
 
+// SetMetricSource replaces the MetricSource StoresStats polls for
+// supplemental per-store telemetry - network rate, available disk space, IO
+// utilization - beyond what heartbeats report.
+func (s *StoresStats) SetMetricSource(src MetricSource) {
+	s.metricSourceMu.Lock()
+	s.metricSource = src
+	s.metricSourceMu.Unlock()
+}
+
+// PollMetricSource asks the current MetricSource for every store currently
+// in snapshot and applies whatever it returns. It does nothing if no
+// MetricSource has been set. Callers are expected to schedule this on their
+// own interval, the same way CollectMetrics is.
+func (s *StoresStats) PollMetricSource() {
+	s.metricSourceMu.RLock()
+	src := s.metricSource
+	s.metricSourceMu.RUnlock()
+	if src == nil {
+		return
+	}
+	for storeID, stats := range s.snapshotMap() {
+		if metrics, ok := src.CollectStoreMetrics(storeID); ok {
+			stats.ApplyStoreMetrics(metrics)
+		}
+	}
+}
+
 func (s *StoresStats) getStat(getRate func(*RollingStoreStats) float64) map[uint64]float64 {
-	s.RLock()
-	defer s.RUnlock()
-	res := make(map[uint64]float64, len(s.rollingStoresStats))
-	for storeID, stats := range s.rollingStoresStats {
+	snapshot := s.snapshotMap()
+	res := make(map[uint64]float64, len(snapshot))
+	for storeID, stats := range snapshot {
 		res[storeID] = getRate(stats)
 	}
 	return res
 }
 
+// GetStoresForecastLoadsStat returns every store's Holt-forecast load
+// horizon into the future: read bytes/keys/ops, then write bytes/keys/ops,
+// then cpu usage and disk read/write rate. Unlike GetStoresLoadsStat, it has
+// no separate write-leader entries - leader-only forecasts aren't tracked,
+// since scheduling decisions that care about anticipated load look at the
+// whole store's trend rather than its leader-only slice of it.
+func (s *StoresStats) GetStoresForecastLoadsStat(horizon time.Duration) (ret []map[uint64]float64) {
+	ret = append(ret,
+		s.getForecastStat(horizon, (*RollingStoreStats).GetForecastBytesReadRate),
+		s.getForecastStat(horizon, (*RollingStoreStats).GetForecastKeysReadRate),
+		s.getForecastStat(horizon, (*RollingStoreStats).GetForecastOpsRead),
+		s.getForecastStat(horizon, (*RollingStoreStats).GetForecastBytesWriteRate),
+		s.getForecastStat(horizon, (*RollingStoreStats).GetForecastKeysWriteRate),
+		s.getForecastStat(horizon, (*RollingStoreStats).GetForecastOpsWrite),
+		s.getForecastStat(horizon, (*RollingStoreStats).GetForecastCPUUsage),
+		s.getForecastStat(horizon, (*RollingStoreStats).GetForecastDiskReadRate),
+		s.getForecastStat(horizon, (*RollingStoreStats).GetForecastDiskWriteRate),
+	)
+	return
+}
+
+func (s *StoresStats) getForecastStat(horizon time.Duration, getForecast func(*RollingStoreStats, time.Duration) float64) map[uint64]float64 {
+	snapshot := s.snapshotMap()
+	res := make(map[uint64]float64, len(snapshot))
+	for storeID, stats := range snapshot {
+		res[storeID] = getForecast(stats, horizon)
+	}
+	return res
+}
+
+// SetForecastConfig replaces the ForecastConfig every store's load
+// forecaster uses.
+func (s *StoresStats) SetForecastConfig(cfg *ForecastConfig) {
+	for _, stats := range s.snapshotMap() {
+		stats.SetForecastConfig(cfg)
+	}
+}
+
 func (s *StoresStats) storeIsUnhealthy(cluster core.StoreSetInformer, storeID uint64) bool {
 	store := cluster.GetStore(storeID)
 	return store.IsTombstone() || store.IsUnhealthy()
 }
 
-// FilterUnhealthyStore filter unhealthy store
+// FilterUnhealthyStore drops every unhealthy store from every shard. Each
+// shard's removal is enqueued as a regular task and waited on, so it can't
+// race a heartbeat for the same store that's still being applied.
 func (s *StoresStats) FilterUnhealthyStore(cluster core.StoreSetInformer) {
-	s.Lock()
-	defer s.Unlock()
-	for storeID := range s.rollingStoresStats {
-		if s.storeIsUnhealthy(cluster, storeID) {
-			delete(s.rollingStoresStats, storeID)
-		}
+	dones := make([]chan struct{}, len(s.shards))
+	for i, shard := range s.shards {
+		done := make(chan struct{})
+		dones[i] = done
+		s.enqueueToShard(shard, newFilterUnhealthyStoreStatsTask(cluster))
+		s.enqueueToShard(shard, &storesStatsWaitTask{done: done})
 	}
+	for _, done := range dones {
+		<-done
+	}
+	s.refreshSnapshot()
 }
 
 // RollingStoreStats are multiple sets of recent historical records with specified windows size.
@@ -377,9 +675,45 @@ type RollingStoreStats struct {
 	keysReadRate            *TimeMedian
 	opsRead                 *TimeMedian
 	opsWrite                *TimeMedian
+
+	// bytesWriteHistogram tracks the same write-byte-rate samples as
+	// bytesWriteRate, but as a decaying histogram rather than a median, so a
+	// caller can ask for a tail quantile (P95, P99) that the median smooths
+	// away.
+	bytesWriteHistogram *TimeHistogram
+
 	totalCPUUsage           MovingAvg
 	totalBytesDiskReadRate  MovingAvg
 	totalBytesDiskWriteRate MovingAvg
+
+	// forecastCfg is shared by every forecaster below, so adjusting a
+	// store's forecasting aggressiveness via SetForecastConfig takes effect
+	// on all of its metrics at once.
+	forecastCfg             *ForecastConfig
+	forecastBytesWriteRate  *HoltLinearForecaster
+	forecastBytesReadRate   *HoltLinearForecaster
+	forecastKeysWriteRate   *HoltLinearForecaster
+	forecastKeysReadRate    *HoltLinearForecaster
+	forecastOpsRead         *HoltLinearForecaster
+	forecastOpsWrite        *HoltLinearForecaster
+	forecastCPUUsage        *HoltLinearForecaster
+	forecastDiskReadRate    *HoltLinearForecaster
+	forecastDiskWriteRate   *HoltLinearForecaster
+
+	// lastAvailable and hasLastAvailable cache the most recent
+	// pdpb.StoreStats.Available seen by Observe, so the default
+	// pdpbMetricSource can surface it as AvailableDiskSpace without
+	// StoresStats having to retain the raw heartbeat itself.
+	lastAvailable    float64
+	hasLastAvailable bool
+
+	// networkReadRate, networkWriteRate, availableDiskSpace, and
+	// ioUtilizationPercent are set by ApplyStoreMetrics from a MetricSource
+	// rather than Observe - a heartbeat never reports them directly.
+	networkReadRate      float64
+	networkWriteRate     float64
+	availableDiskSpace   float64
+	ioUtilizationPercent float64
 }
 
 const (
@@ -394,6 +728,7 @@ const (
 
 // NewRollingStoreStats creates a RollingStoreStats.
 func newRollingStoreStats() *RollingStoreStats {
+	forecastCfg := defaultForecastConfig()
 	return &RollingStoreStats{
 		bytesWriteRate:          NewTimeMedian(DefaultAotSize, DefaultWriteMfSize),
 		bytesWriteLeaderRate:    NewTimeMedian(DefaultAotSize, DefaultWriteMfSize),
@@ -403,9 +738,20 @@ func newRollingStoreStats() *RollingStoreStats {
 		keysReadRate:            NewTimeMedian(DefaultAotSize, DefaultReadMfSize),
 		opsRead:                 NewTimeMedian(DefaultAotSize, DefaultReadMfSize),
 		opsWrite:                NewTimeMedian(DefaultAotSize, DefaultReadMfSize),
+		bytesWriteHistogram:     NewTimeHistogram(histogramDefaultDecay),
 		totalCPUUsage:           NewMedianFilter(storeStatsRollingWindows),
 		totalBytesDiskReadRate:  NewMedianFilter(storeStatsRollingWindows),
 		totalBytesDiskWriteRate: NewMedianFilter(storeStatsRollingWindows),
+		forecastCfg:             forecastCfg,
+		forecastBytesWriteRate:  NewHoltLinearForecaster(forecastCfg),
+		forecastBytesReadRate:   NewHoltLinearForecaster(forecastCfg),
+		forecastKeysWriteRate:   NewHoltLinearForecaster(forecastCfg),
+		forecastKeysReadRate:    NewHoltLinearForecaster(forecastCfg),
+		forecastOpsRead:         NewHoltLinearForecaster(forecastCfg),
+		forecastOpsWrite:        NewHoltLinearForecaster(forecastCfg),
+		forecastCPUUsage:        NewHoltLinearForecaster(forecastCfg),
+		forecastDiskReadRate:    NewHoltLinearForecaster(forecastCfg),
+		forecastDiskWriteRate:   NewHoltLinearForecaster(forecastCfg),
 	}
 }
 
@@ -432,11 +778,97 @@ func (r *RollingStoreStats) Observe(stats *pdpb.StoreStats) {
 	r.keysReadRate.Add(float64(stats.KeysRead), time.Duration(interval)*time.Second)
 	r.opsRead.Add(float64(stats.OpsRead), time.Duration(interval)*time.Second)
 	r.opsWrite.Add(float64(stats.OpsWrite), time.Duration(interval)*time.Second)
+	if interval > 0 {
+		r.bytesWriteHistogram.Observe(float64(stats.BytesWritten)/float64(interval), time.Now())
+	}
 
 	// Updates the cpu usages and disk rw rates of store.
 	r.totalCPUUsage.Add(collect(stats.GetCpuUsages()))
 	r.totalBytesDiskReadRate.Add(collect(stats.GetReadIoRates()))
 	r.totalBytesDiskWriteRate.Add(collect(stats.GetWriteIoRates()))
+
+	// Feeds the same rates into each metric's forecaster so a caller can
+	// anticipate load a horizon ahead instead of only reading the current
+	// rolling rate.
+	intervalDuration := time.Duration(interval) * time.Second
+	if interval > 0 {
+		r.forecastBytesWriteRate.Observe(float64(stats.BytesWritten)/float64(interval), intervalDuration)
+		r.forecastBytesReadRate.Observe(float64(stats.BytesRead)/float64(interval), intervalDuration)
+		r.forecastKeysWriteRate.Observe(float64(stats.KeysWritten)/float64(interval), intervalDuration)
+		r.forecastKeysReadRate.Observe(float64(stats.KeysRead)/float64(interval), intervalDuration)
+		r.forecastOpsRead.Observe(float64(stats.OpsRead)/float64(interval), intervalDuration)
+		r.forecastOpsWrite.Observe(float64(stats.OpsWrite)/float64(interval), intervalDuration)
+	}
+	r.forecastCPUUsage.Observe(collect(stats.GetCpuUsages()), intervalDuration)
+	r.forecastDiskReadRate.Observe(collect(stats.GetReadIoRates()), intervalDuration)
+	r.forecastDiskWriteRate.Observe(collect(stats.GetWriteIoRates()), intervalDuration)
+
+	r.lastAvailable = float64(stats.GetAvailable())
+	r.hasLastAvailable = true
+}
+
+// GetLastAvailable returns the available disk space from the most recent
+// heartbeat Observe has seen, or ok=false if Observe hasn't run yet.
+func (r *RollingStoreStats) GetLastAvailable() (available float64, ok bool) {
+	r.RLock()
+	defer r.RUnlock()
+	return r.lastAvailable, r.hasLastAvailable
+}
+
+// ApplyStoreMetrics overwrites r's externally-sourced gauges - network
+// read/write rate, available disk space, IO utilization percent - with the
+// latest sample from a MetricSource. Unlike Observe's pdpb-derived rates,
+// these already arrive as computed rates/percentages from their source, so
+// there's nothing left to smooth here.
+func (r *RollingStoreStats) ApplyStoreMetrics(m StoreMetrics) {
+	r.Lock()
+	defer r.Unlock()
+	r.networkReadRate = m.NetworkReadRate
+	r.networkWriteRate = m.NetworkWriteRate
+	r.availableDiskSpace = m.AvailableDiskSpace
+	r.ioUtilizationPercent = m.IOUtilizationPercent
+}
+
+// GetNetworkReadRate returns the most recently applied network read rate.
+func (r *RollingStoreStats) GetNetworkReadRate() float64 {
+	r.RLock()
+	defer r.RUnlock()
+	return r.networkReadRate
+}
+
+// GetNetworkWriteRate returns the most recently applied network write rate.
+func (r *RollingStoreStats) GetNetworkWriteRate() float64 {
+	r.RLock()
+	defer r.RUnlock()
+	return r.networkWriteRate
+}
+
+// GetAvailableDiskSpace returns the most recently applied available disk
+// space.
+func (r *RollingStoreStats) GetAvailableDiskSpace() float64 {
+	r.RLock()
+	defer r.RUnlock()
+	return r.availableDiskSpace
+}
+
+// GetIOUtilizationPercent returns the most recently applied IO utilization
+// percentage.
+func (r *RollingStoreStats) GetIOUtilizationPercent() float64 {
+	r.RLock()
+	defer r.RUnlock()
+	return r.ioUtilizationPercent
+}
+
+// SetForecastConfig replaces the ForecastConfig every metric's forecaster on
+// r uses, e.g. in response to an operator tuning how aggressively load
+// forecasts react.
+func (r *RollingStoreStats) SetForecastConfig(cfg *ForecastConfig) {
+	if cfg == nil {
+		cfg = defaultForecastConfig()
+	}
+	r.Lock()
+	defer r.Unlock()
+	*r.forecastCfg = *cfg
 }
 
 // Set sets the statistics (for test).
@@ -472,6 +904,15 @@ func (r *RollingStoreStats) GetBytesWriteRate() float64 {
 	return r.bytesWriteRate.Get()
 }
 
+// GetBytesWriteQuantile returns the q-th quantile (q in (0,1)) of r's
+// recently observed write-byte rates, e.g. q=0.99 for a P99 that a median
+// would smooth away.
+func (r *RollingStoreStats) GetBytesWriteQuantile(q float64) float64 {
+	r.RLock()
+	defer r.RUnlock()
+	return r.bytesWriteHistogram.Quantile(q)
+}
+
 // GetBytesWriteLeaderRate returns the bytes write leader rate.
 func (r *RollingStoreStats) GetBytesWriteLeaderRate() float64 {
 	r.RLock()
@@ -548,3 +989,89 @@ func (r *RollingStoreStats) GetDiskWriteRate() float64 {
 	defer r.RUnlock()
 	return r.totalBytesDiskWriteRate.Get()
 }
+
+// GetForecastBytesWriteRate forecasts the bytes write rate horizon into the
+// future.
+func (r *RollingStoreStats) GetForecastBytesWriteRate(horizon time.Duration) float64 {
+	r.RLock()
+	defer r.RUnlock()
+	return r.forecastBytesWriteRate.Forecast(horizon)
+}
+
+// GetForecastBytesWriteRateBand is like GetForecastBytesWriteRate, but also
+// returns a mean +/- k*sigma confidence band around it.
+func (r *RollingStoreStats) GetForecastBytesWriteRateBand(horizon time.Duration, k float64) (mean, lower, upper float64) {
+	r.RLock()
+	defer r.RUnlock()
+	return r.forecastBytesWriteRate.ForecastBand(horizon, k)
+}
+
+// GetForecastBytesReadRate forecasts the bytes read rate horizon into the
+// future.
+func (r *RollingStoreStats) GetForecastBytesReadRate(horizon time.Duration) float64 {
+	r.RLock()
+	defer r.RUnlock()
+	return r.forecastBytesReadRate.Forecast(horizon)
+}
+
+// GetForecastBytesReadRateBand is like GetForecastBytesReadRate, but also
+// returns a mean +/- k*sigma confidence band around it.
+func (r *RollingStoreStats) GetForecastBytesReadRateBand(horizon time.Duration, k float64) (mean, lower, upper float64) {
+	r.RLock()
+	defer r.RUnlock()
+	return r.forecastBytesReadRate.ForecastBand(horizon, k)
+}
+
+// GetForecastKeysWriteRate forecasts the keys write rate horizon into the
+// future.
+func (r *RollingStoreStats) GetForecastKeysWriteRate(horizon time.Duration) float64 {
+	r.RLock()
+	defer r.RUnlock()
+	return r.forecastKeysWriteRate.Forecast(horizon)
+}
+
+// GetForecastKeysReadRate forecasts the keys read rate horizon into the
+// future.
+func (r *RollingStoreStats) GetForecastKeysReadRate(horizon time.Duration) float64 {
+	r.RLock()
+	defer r.RUnlock()
+	return r.forecastKeysReadRate.Forecast(horizon)
+}
+
+// GetForecastOpsRead forecasts the read ops horizon into the future.
+func (r *RollingStoreStats) GetForecastOpsRead(horizon time.Duration) float64 {
+	r.RLock()
+	defer r.RUnlock()
+	return r.forecastOpsRead.Forecast(horizon)
+}
+
+// GetForecastOpsWrite forecasts the write ops horizon into the future.
+func (r *RollingStoreStats) GetForecastOpsWrite(horizon time.Duration) float64 {
+	r.RLock()
+	defer r.RUnlock()
+	return r.forecastOpsWrite.Forecast(horizon)
+}
+
+// GetForecastCPUUsage forecasts the total cpu usage of threads in the store
+// horizon into the future.
+func (r *RollingStoreStats) GetForecastCPUUsage(horizon time.Duration) float64 {
+	r.RLock()
+	defer r.RUnlock()
+	return r.forecastCPUUsage.Forecast(horizon)
+}
+
+// GetForecastDiskReadRate forecasts the total read disk io rate of threads
+// in the store horizon into the future.
+func (r *RollingStoreStats) GetForecastDiskReadRate(horizon time.Duration) float64 {
+	r.RLock()
+	defer r.RUnlock()
+	return r.forecastDiskReadRate.Forecast(horizon)
+}
+
+// GetForecastDiskWriteRate forecasts the total write disk io rate of
+// threads in the store horizon into the future.
+func (r *RollingStoreStats) GetForecastDiskWriteRate(horizon time.Duration) float64 {
+	r.RLock()
+	defer r.RUnlock()
+	return r.forecastDiskWriteRate.Forecast(horizon)
+}
@@ -0,0 +1,94 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statistics
+
+import (
+	"github.com/pingcap/kvproto/pkg/pdpb"
+	"github.com/tikv/pd/server/core"
+)
+
+// storesStatsTask is one unit of work a storesStatsShard's worker goroutine
+// runs with exclusive access to that shard, the same role HotCacheTask
+// plays for a hotPeerCache in hot_cache_task.go.
+type storesStatsTask interface {
+	runLocked(shard *storesStatsShard)
+}
+
+// observeStoreStatsTask feeds one heartbeat's raw StoreStats into storeID's
+// RollingStoreStats, creating it if this is the store's first heartbeat.
+type observeStoreStatsTask struct {
+	storeID uint64
+	stats   *pdpb.StoreStats
+}
+
+// newObserveStoreStatsTask creates an observeStoreStatsTask for storeID.
+func newObserveStoreStatsTask(storeID uint64, stats *pdpb.StoreStats) *observeStoreStatsTask {
+	return &observeStoreStatsTask{storeID: storeID, stats: stats}
+}
+
+func (t *observeStoreStatsTask) runLocked(shard *storesStatsShard) {
+	store, ok := shard.rollingStoresStats[t.storeID]
+	if !ok {
+		store = newRollingStoreStats()
+		shard.rollingStoresStats[t.storeID] = store
+	}
+	store.Observe(t.stats)
+}
+
+// removeStoreStatsTask drops storeID's RollingStoreStats from its shard.
+type removeStoreStatsTask struct {
+	storeID uint64
+}
+
+// newRemoveStoreStatsTask creates a removeStoreStatsTask for storeID.
+func newRemoveStoreStatsTask(storeID uint64) *removeStoreStatsTask {
+	return &removeStoreStatsTask{storeID: storeID}
+}
+
+func (t *removeStoreStatsTask) runLocked(shard *storesStatsShard) {
+	delete(shard.rollingStoresStats, t.storeID)
+}
+
+// filterUnhealthyStoreStatsTask drops every store in its shard that cluster
+// reports as tombstone or unhealthy.
+type filterUnhealthyStoreStatsTask struct {
+	cluster core.StoreSetInformer
+}
+
+// newFilterUnhealthyStoreStatsTask creates a filterUnhealthyStoreStatsTask
+// for cluster.
+func newFilterUnhealthyStoreStatsTask(cluster core.StoreSetInformer) *filterUnhealthyStoreStatsTask {
+	return &filterUnhealthyStoreStatsTask{cluster: cluster}
+}
+
+func (t *filterUnhealthyStoreStatsTask) runLocked(shard *storesStatsShard) {
+	for storeID := range shard.rollingStoresStats {
+		store := t.cluster.GetStore(storeID)
+		if store.IsTombstone() || store.IsUnhealthy() {
+			delete(shard.rollingStoresStats, storeID)
+		}
+	}
+}
+
+// storesStatsWaitTask is a barrier: once run, it closes done, letting a
+// caller block until every task queued ahead of it on the same shard has
+// finished - RemoveRollingStoreStats and FilterUnhealthyStore use one to
+// return only after their removal has actually taken effect.
+type storesStatsWaitTask struct {
+	done chan struct{}
+}
+
+func (t *storesStatsWaitTask) runLocked(*storesStatsShard) {
+	close(t.done)
+}
@@ -0,0 +1,127 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+// learnerMembersPrefix matches the endpoints RaftCluster's
+// AddPDLearner/PromoteLearner/RemovePDMember/GetLearnerProgress are meant to
+// sit behind. This tree has no server/api package to host that handler in,
+// so these commands have nothing live to talk to yet; they're written against
+// the API those methods are designed for.
+var (
+	learnerMembersPrefix = "pd/api/v1/members/learner"
+)
+
+// NewMemberLearnerCommand returns a command to manage PD learner members.
+func NewMemberLearnerCommand() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "learner",
+		Short: "manage PD learner members",
+	}
+	c.AddCommand(NewAddMemberLearnerCommand())
+	c.AddCommand(NewPromoteMemberLearnerCommand())
+	c.AddCommand(NewRemoveMemberLearnerCommand())
+	c.AddCommand(NewShowMemberLearnerProgressCommand())
+	return c
+}
+
+// NewAddMemberLearnerCommand returns a command to add a PD learner member.
+func NewAddMemberLearnerCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "add <peer_url>",
+		Short: "add a non-voting PD member at peer_url",
+		Run:   addMemberLearnerCommandFunc,
+	}
+}
+
+func addMemberLearnerCommandFunc(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		fmt.Println(cmd.UsageString())
+		return
+	}
+	input := map[string]interface{}{"peer_url": args[0]}
+	postJSON(cmd, learnerMembersPrefix, input)
+}
+
+// NewPromoteMemberLearnerCommand returns a command to promote a PD learner.
+func NewPromoteMemberLearnerCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "promote <member_id>",
+		Short: "promote a caught-up PD learner to a full voting member",
+		Run:   promoteMemberLearnerCommandFunc,
+	}
+}
+
+func promoteMemberLearnerCommandFunc(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		fmt.Println(cmd.UsageString())
+		return
+	}
+	if _, err := strconv.ParseUint(args[0], 10, 64); err != nil {
+		fmt.Println(err)
+		return
+	}
+	input := map[string]interface{}{"member_id": args[0]}
+	postJSON(cmd, learnerMembersPrefix+"/promote", input)
+}
+
+// NewRemoveMemberLearnerCommand returns a command to remove a PD learner.
+func NewRemoveMemberLearnerCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove <member_id>",
+		Short: "remove a PD learner member",
+		Run:   removeMemberLearnerCommandFunc,
+	}
+}
+
+func removeMemberLearnerCommandFunc(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		fmt.Println(cmd.UsageString())
+		return
+	}
+	if _, err := strconv.ParseUint(args[0], 10, 64); err != nil {
+		fmt.Println(err)
+		return
+	}
+	_, err := doRequest(cmd, learnerMembersPrefix+"/"+args[0], http.MethodDelete)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+// NewShowMemberLearnerProgressCommand returns a command to show how far
+// every PD learner has caught up.
+func NewShowMemberLearnerProgressCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "progress",
+		Short: "show the raft catch-up progress of every PD learner",
+		Run:   showMemberLearnerProgressCommandFunc,
+	}
+}
+
+func showMemberLearnerProgressCommandFunc(cmd *cobra.Command, args []string) {
+	r, err := doRequest(cmd, learnerMembersPrefix+"/progress", http.MethodGet)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(r)
+}
@@ -14,18 +14,114 @@
 package command
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"os"
 	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
 
 	"github.com/pingcap/errors"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
 )
 
 var (
 	operatorsPrefix = "pd/api/v1/operators"
 )
 
+// defaultBatchWorkers is how many operators a batch submission (scatter-
+// region-range, operator add --from-file) sends concurrently when --workers
+// is not given.
+const defaultBatchWorkers = 8
+
+// defaultPollInterval is how often --wait polls an operator's status when
+// --poll-interval is not given.
+const defaultPollInterval = 500 * time.Millisecond
+
+// opStatus mirrors the subset of the operator status JSON returned by
+// GET pd/api/v1/operators/<region_id> that --wait needs to stream step
+// transitions and recognize a terminal status.
+type opStatus struct {
+	Status      string   `json:"status"`
+	Steps       []string `json:"steps"`
+	CurrentStep int      `json:"current_step"`
+}
+
+// addWaitFlags registers --wait and --poll-interval on a command that
+// submits or inspects a single region's operator, so its Run func can
+// optionally follow the operator to completion instead of returning
+// immediately.
+func addWaitFlags(c *cobra.Command) {
+	c.Flags().Duration("wait", 0, "block and stream step transitions until the operator finishes, or this long elapses; 0 disables waiting")
+	c.Flags().Duration("poll-interval", defaultPollInterval, "how often to poll the operator's status while --wait is set")
+}
+
+// submitAndMaybeWait posts a single-region operator spec, then, if --wait
+// was given on cmd, follows it to completion via waitOperatorDone instead of
+// returning as soon as the POST is acknowledged.
+func submitAndMaybeWait(cmd *cobra.Command, regionID uint64, input map[string]interface{}) {
+	wait, _ := cmd.Flags().GetDuration("wait")
+	if wait <= 0 {
+		postJSON(cmd, operatorsPrefix, input)
+		return
+	}
+
+	if err := submitOperator(cmd, input); err != nil {
+		cmd.Println(err)
+		return
+	}
+	pollInterval, _ := cmd.Flags().GetDuration("poll-interval")
+	os.Exit(waitOperatorDone(cmd, regionID, wait, pollInterval))
+}
+
+// waitOperatorDone polls a region's operator status until it reaches a
+// terminal state (success, timeout, replaced, or cancel), printing each step
+// transition as it's observed, and returns the exit code the terminal state
+// should produce.
+func waitOperatorDone(cmd *cobra.Command, regionID uint64, timeout, pollInterval time.Duration) int {
+	path := fmt.Sprintf("%s/%d", operatorsPrefix, regionID)
+	deadline := time.Now().Add(timeout)
+	lastStep := -1
+	for {
+		r, err := doRequest(cmd, path, http.MethodGet)
+		if err != nil {
+			cmd.Println(err)
+			return 1
+		}
+
+		var status opStatus
+		if err := json.Unmarshal([]byte(r), &status); err != nil {
+			cmd.Println(err)
+			return 1
+		}
+
+		if status.CurrentStep != lastStep && status.CurrentStep >= 0 && status.CurrentStep < len(status.Steps) {
+			cmd.Println(status.Steps[status.CurrentStep])
+			lastStep = status.CurrentStep
+		}
+
+		switch status.Status {
+		case "SUCCESS":
+			return 0
+		case "TIMEOUT", "REPLACE", "CANCEL":
+			cmd.Printf("operator %s\n", status.Status)
+			return 1
+		}
+
+		if time.Now().After(deadline) {
+			cmd.Println("Error: timed out waiting for operator to finish")
+			return 1
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
 // NewOperatorCommand returns a operator command.
 func NewOperatorCommand() *cobra.Command {
 	c := &cobra.Command{
@@ -36,9 +132,81 @@ func NewOperatorCommand() *cobra.Command {
 	c.AddCommand(NewCheckOperatorCommand())
 	c.AddCommand(NewAddOperatorCommand())
 	c.AddCommand(NewRemoveOperatorCommand())
+	c.PersistentFlags().StringP("output", "o", "", "render operator results as json, yaml, or table instead of the raw response body")
 	return c
 }
 
+// OperatorInfo is the typed shape of a single operator's status JSON, used by
+// --output to render "show"/"check" results as JSON, YAML, or a table
+// instead of printing the raw response body.
+type OperatorInfo struct {
+	Kind        string   `json:"kind" yaml:"kind"`
+	RegionID    uint64   `json:"region_id" yaml:"region_id"`
+	Status      string   `json:"status" yaml:"status"`
+	Steps       []string `json:"steps" yaml:"steps"`
+	CurrentStep int      `json:"current_step" yaml:"current_step"`
+	CreatedAt   string   `json:"created_at" yaml:"created_at"`
+}
+
+// renderOperatorOutput reformats a raw operator-status response body
+// according to --output. It returns raw unchanged when --output is empty,
+// preserving the historical behavior. list selects whether raw holds a
+// single OperatorInfo ("check <region_id>") or a list of them ("show",
+// bare "check").
+func renderOperatorOutput(cmd *cobra.Command, raw string, list bool) (string, error) {
+	format, _ := cmd.Flags().GetString("output")
+	if format == "" {
+		return raw, nil
+	}
+
+	var infos []OperatorInfo
+	if list {
+		if err := json.Unmarshal([]byte(raw), &infos); err != nil {
+			return "", err
+		}
+	} else {
+		var info OperatorInfo
+		if err := json.Unmarshal([]byte(raw), &info); err != nil {
+			return "", err
+		}
+		infos = []OperatorInfo{info}
+	}
+
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(infos, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	case "yaml":
+		data, err := yaml.Marshal(infos)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	case "table":
+		return renderOperatorTable(infos), nil
+	default:
+		return "", errors.Errorf("unknown output format %q, must be json, yaml, or table", format)
+	}
+}
+
+// renderOperatorTable collapses each operator into one column-aligned row,
+// showing multi-step progress (e.g. "2/4 steps") instead of the full step
+// list.
+func renderOperatorTable(infos []OperatorInfo) string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "REGION\tKIND\tSTATUS\tPROGRESS\tCREATED_AT")
+	for _, info := range infos {
+		progress := fmt.Sprintf("%d/%d steps", info.CurrentStep, len(info.Steps))
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", info.RegionID, info.Kind, info.Status, progress, info.CreatedAt)
+	}
+	w.Flush()
+	return strings.TrimRight(buf.String(), "\n")
+}
+
 // NewCheckOperatorCommand returns a command to show status of the operator.
 func NewCheckOperatorCommand() *cobra.Command {
 	c := &cobra.Command{
@@ -46,6 +214,7 @@ func NewCheckOperatorCommand() *cobra.Command {
 		Short: "checks the status of operator",
 		Run:   checkOperatorCommandFunc,
 	}
+	addWaitFlags(c)
 	return c
 }
 
@@ -75,6 +244,11 @@ func showOperatorCommandFunc(cmd *cobra.Command, args []string) {
 		cmd.Println(err)
 		return
 	}
+	r, err = renderOperatorOutput(cmd, r, true)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
 	cmd.Println(r)
 }
 
@@ -89,11 +263,26 @@ func checkOperatorCommandFunc(cmd *cobra.Command, args []string) {
 		return
 	}
 
+	if wait, _ := cmd.Flags().GetDuration("wait"); wait > 0 && len(args) == 1 {
+		regionID, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			cmd.Println(err)
+			return
+		}
+		pollInterval, _ := cmd.Flags().GetDuration("poll-interval")
+		os.Exit(waitOperatorDone(cmd, regionID, wait, pollInterval))
+	}
+
 	r, err := doRequest(cmd, path, http.MethodGet)
 	if err != nil {
 		cmd.Println(err)
 		return
 	}
+	r, err = renderOperatorOutput(cmd, r, len(args) == 0)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
 	cmd.Println(r)
 }
 
@@ -102,7 +291,12 @@ func NewAddOperatorCommand() *cobra.Command {
 	c := &cobra.Command{
 		Use:   "add <operator>",
 		Short: "add an operator",
+		Long:  "add an operator; pass --from-file to submit a batch of operator specs read from a JSON file instead of a single subcommand",
+		Run:   addOperatorCommandFunc,
 	}
+	c.Flags().String("from-file", "", "path to a JSON file containing a list of operator specs to submit as a batch")
+	c.Flags().Int("workers", defaultBatchWorkers, "number of operators to submit concurrently when using --from-file")
+	c.Flags().Float64("rate", 0, "maximum operators submitted per second when using --from-file, 0 means unlimited")
 	c.AddCommand(NewTransferLeaderCommand())
 	c.AddCommand(NewTransferRegionCommand())
 	c.AddCommand(NewTransferPeerCommand())
@@ -112,9 +306,44 @@ func NewAddOperatorCommand() *cobra.Command {
 	c.AddCommand(NewMergeRegionCommand())
 	c.AddCommand(NewSplitRegionCommand())
 	c.AddCommand(NewScatterRegionCommand())
+	c.AddCommand(NewScatterRegionRangeCommand())
+	c.AddCommand(NewChangePeersCommand())
 	return c
 }
 
+func addOperatorCommandFunc(cmd *cobra.Command, args []string) {
+	fromFile, err := cmd.Flags().GetString("from-file")
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	if fromFile == "" {
+		cmd.Println(cmd.UsageString())
+		return
+	}
+
+	data, err := ioutil.ReadFile(fromFile)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	var specs []map[string]interface{}
+	if err := json.Unmarshal(data, &specs); err != nil {
+		cmd.Println(err)
+		return
+	}
+	if len(specs) == 0 {
+		cmd.Printf("Error: no operators found in %s\n", fromFile)
+		return
+	}
+
+	workers, _ := cmd.Flags().GetInt("workers")
+	rate, _ := cmd.Flags().GetFloat64("rate")
+	if !runOperatorBatch(cmd, specs, workers, rate) {
+		os.Exit(1)
+	}
+}
+
 // NewTransferLeaderCommand returns a command to transfer leader.
 func NewTransferLeaderCommand() *cobra.Command {
 	c := &cobra.Command{
@@ -122,6 +351,7 @@ func NewTransferLeaderCommand() *cobra.Command {
 		Short: "transfer a region's leader to the specified store",
 		Run:   transferLeaderCommandFunc,
 	}
+	addWaitFlags(c)
 	return c
 }
 
@@ -141,7 +371,7 @@ func transferLeaderCommandFunc(cmd *cobra.Command, args []string) {
 	input["name"] = cmd.Name()
 	input["region_id"] = ids[0]
 	input["to_store_id"] = ids[1]
-	postJSON(cmd, operatorsPrefix, input)
+	submitAndMaybeWait(cmd, ids[0], input)
 }
 
 // NewTransferRegionCommand returns a command to transfer region.
@@ -180,6 +410,7 @@ func NewTransferPeerCommand() *cobra.Command {
 		Short: "transfer a region's peer from the specified store to another store",
 		Run:   transferPeerCommandFunc,
 	}
+	addWaitFlags(c)
 	return c
 }
 
@@ -200,7 +431,7 @@ func transferPeerCommandFunc(cmd *cobra.Command, args []string) {
 	input["region_id"] = ids[0]
 	input["from_store_id"] = ids[1]
 	input["to_store_id"] = ids[2]
-	postJSON(cmd, operatorsPrefix, input)
+	submitAndMaybeWait(cmd, ids[0], input)
 }
 
 // NewAddPeerCommand returns a command to add region peer.
@@ -268,6 +499,7 @@ func NewMergeRegionCommand() *cobra.Command {
 		Short: "merge source region into target region",
 		Run:   mergeRegionCommandFunc,
 	}
+	addWaitFlags(c)
 	return c
 }
 
@@ -287,7 +519,7 @@ func mergeRegionCommandFunc(cmd *cobra.Command, args []string) {
 	input["name"] = cmd.Name()
 	input["source_region_id"] = ids[0]
 	input["target_region_id"] = ids[1]
-	postJSON(cmd, operatorsPrefix, input)
+	submitAndMaybeWait(cmd, ids[0], input)
 }
 
 // NewRemovePeerCommand returns a command to add region peer.
@@ -330,6 +562,7 @@ func NewSplitRegionCommand() *cobra.Command {
 	c.Flags().String("dim_id", "0", "the id of dimension to perform ratio splitting")
 	c.Flags().String("ratio", "0.5", "the splitting ratio")
 	c.Flags().String("rw_type", "0", "split type: read 0, write 1")
+	addWaitFlags(c)
 	return c
 }
 
@@ -384,20 +617,144 @@ func splitRegionCommandFunc(cmd *cobra.Command, args []string) {
 	input["dim_id"] = dimID
 	input["ratio"] = ratio
 	input["rw_type"] = rwType
-	postJSON(cmd, operatorsPrefix, input)
+	submitAndMaybeWait(cmd, ids[0], input)
 }
 
 // NewScatterRegionCommand returns a command to scatter a region.
 func NewScatterRegionCommand() *cobra.Command {
 	c := &cobra.Command{
 		Use:   "scatter-region <region_id>",
-		Short: "usually used for a batch of adjacent regions",
-		Long:  "usually used for a batch of adjacent regions, for example, scatter the regions for 1 to 100, need to use the following commands in order: \"scatter-region 1; scatter-region 2; ...; scatter-region 100;\"",
+		Short: "scatter a region",
+		Long:  "scatter a region; to scatter a batch of adjacent regions at once use \"scatter-region-range <start_region_id> <end_region_id>\" instead",
 		Run:   scatterRegionCommandFunc,
 	}
 	return c
 }
 
+// NewScatterRegionRangeCommand returns a command to scatter every region
+// whose id falls in [start_region_id, end_region_id], submitted as a batch
+// instead of one "scatter-region" invocation per id.
+func NewScatterRegionRangeCommand() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "scatter-region-range <start_region_id> <end_region_id>",
+		Short: "scatter all regions with id in the given range",
+		Run:   scatterRegionRangeCommandFunc,
+	}
+	c.Flags().Int("workers", defaultBatchWorkers, "number of operators to submit concurrently")
+	c.Flags().Float64("rate", 0, "maximum operators submitted per second, 0 means unlimited")
+	return c
+}
+
+func scatterRegionRangeCommandFunc(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		cmd.Println(cmd.UsageString())
+		return
+	}
+
+	ids, err := parseUint64s(args)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	start, end := ids[0], ids[1]
+	if start > end {
+		cmd.Println("Error: start_region_id must not be greater than end_region_id")
+		return
+	}
+
+	specs := make([]map[string]interface{}, 0, end-start+1)
+	for id := start; id <= end; id++ {
+		specs = append(specs, map[string]interface{}{
+			"name":      "scatter-region",
+			"region_id": id,
+		})
+	}
+
+	workers, _ := cmd.Flags().GetInt("workers")
+	rate, _ := cmd.Flags().GetFloat64("rate")
+	if !runOperatorBatch(cmd, specs, workers, rate) {
+		os.Exit(1)
+	}
+}
+
+// opResult is one row of the summary table printed after a batch submission.
+type opResult struct {
+	desc string
+	err  error
+}
+
+// runOperatorBatch submits specs with a bounded worker pool, optionally
+// throttled to ratePerSec operations per second, prints a per-op summary
+// table, and reports whether every operation succeeded so callers can set a
+// non-zero exit code on partial failure.
+func runOperatorBatch(cmd *cobra.Command, specs []map[string]interface{}, workers int, ratePerSec float64) bool {
+	if workers <= 0 {
+		workers = defaultBatchWorkers
+	}
+
+	var throttle <-chan time.Time
+	if ratePerSec > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / ratePerSec))
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+
+	results := make([]opResult, len(specs))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				if throttle != nil {
+					<-throttle
+				}
+				err := submitOperator(cmd, specs[idx])
+				results[idx] = opResult{desc: describeOp(specs[idx]), err: err}
+			}
+		}()
+	}
+	for i := range specs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	ok := true
+	cmd.Println("operator\tresult")
+	for _, r := range results {
+		status := "OK"
+		if r.err != nil {
+			ok = false
+			status = fmt.Sprintf("FAILED: %v", r.err)
+		}
+		cmd.Printf("%s\t%s\n", r.desc, status)
+	}
+	return ok
+}
+
+// submitOperator posts a single operator spec and reports whether it
+// succeeded, for use by the batch submission paths above.
+func submitOperator(cmd *cobra.Command, input map[string]interface{}) error {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	_, err = doRequest(cmd, operatorsPrefix, http.MethodPost, WithBody("application/json", bytes.NewBuffer(data)))
+	return err
+}
+
+// describeOp labels a batch summary row with the operator's name and region,
+// falling back gracefully for specs that omit either field.
+func describeOp(spec map[string]interface{}) string {
+	name, _ := spec["name"].(string)
+	if name == "" {
+		name = "unknown"
+	}
+	return fmt.Sprintf("%s(region_id=%v)", name, spec["region_id"])
+}
+
 func scatterRegionCommandFunc(cmd *cobra.Command, args []string) {
 	if len(args) != 1 {
 		cmd.Println(cmd.UsageString())
@@ -416,6 +773,78 @@ func scatterRegionCommandFunc(cmd *cobra.Command, args []string) {
 	postJSON(cmd, operatorsPrefix, input)
 }
 
+// NewChangePeersCommand returns a command to change several peers' roles at
+// once through a single joint-consensus configuration change.
+func NewChangePeersCommand() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "change-peers <region_id>",
+		Short: "change several peers' roles in one joint-consensus configuration change",
+		Run:   changePeersCommandFunc,
+	}
+	c.Flags().StringArray("promote", nil, "store id of a learner to promote to voter, can be specified multiple times")
+	c.Flags().StringArray("demote", nil, "store id of a voter to demote to learner, can be specified multiple times")
+	c.Flags().StringArray("add-learner", nil, "store id to add a new learner on, can be specified multiple times")
+	addWaitFlags(c)
+	return c
+}
+
+func changePeersCommandFunc(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		cmd.Println(cmd.UsageString())
+		return
+	}
+
+	ids, err := parseUint64s(args)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+
+	promotes, err := cmd.Flags().GetStringArray("promote")
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	demotes, err := cmd.Flags().GetStringArray("demote")
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	addLearners, err := cmd.Flags().GetStringArray("add-learner")
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	if len(promotes) == 0 && len(demotes) == 0 && len(addLearners) == 0 {
+		cmd.Println(cmd.UsageString())
+		return
+	}
+
+	promoteLearners, err := parseUint64s(promotes)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	demoteVoters, err := parseUint64s(demotes)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	addLearnerStores, err := parseUint64s(addLearners)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+
+	input := make(map[string]interface{})
+	input["name"] = "change-peer-v2"
+	input["region_id"] = ids[0]
+	input["promote_learners"] = promoteLearners
+	input["demote_voters"] = demoteVoters
+	input["add_learners"] = addLearnerStores
+	submitAndMaybeWait(cmd, ids[0], input)
+}
+
 // NewRemoveOperatorCommand returns a command to remove operators.
 func NewRemoveOperatorCommand() *cobra.Command {
 	c := &cobra.Command{
@@ -0,0 +1,131 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pingcap/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	regionsDumpPrefix = "pd/api/v1/admin/regions/dump"
+	regionsLoadPrefix = "pd/api/v1/admin/regions/load"
+)
+
+// NewRegionCommand returns a region command, currently holding only the
+// dump/load pair this request added; it's the natural home for other
+// region-scoped pd-ctl subcommands later.
+func NewRegionCommand() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "region",
+		Short: "region commands",
+	}
+	c.AddCommand(NewRegionDumpCommand())
+	c.AddCommand(NewRegionLoadCommand())
+	return c
+}
+
+// NewRegionDumpCommand returns a command to dump every region's metadata to
+// a local file, for offline diagnostics against a point-in-time snapshot
+// instead of scraping the region list from the HTTP API one page at a time.
+func NewRegionDumpCommand() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "dump <file>",
+		Short: "dump every region's metadata to a local file",
+		Run:   regionDumpCommandFunc,
+	}
+	c.Flags().Bool("from-storage", false, "dump what's last persisted to storage instead of the in-memory cache")
+	c.Flags().Bool("gzip", false, "gzip the dump")
+	return c
+}
+
+func regionDumpCommandFunc(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		cmd.Println(cmd.UsageString())
+		return
+	}
+	fromStorage, _ := cmd.Flags().GetBool("from-storage")
+	gz, _ := cmd.Flags().GetBool("gzip")
+	path := regionsDumpPrefix
+	if fromStorage || gz {
+		path += "?"
+		if fromStorage {
+			path += "from_storage=true&"
+		}
+		if gz {
+			path += "gzip=true&"
+		}
+		path = path[:len(path)-1]
+	}
+
+	// The dump is a binary length-prefixed protobuf stream, not JSON, so
+	// it's fetched and written out raw rather than through the
+	// json.Unmarshal-oriented helpers the other commands in this package
+	// use for their responses.
+	r, err := doRequest(cmd, path, http.MethodGet)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	if err := ioutil.WriteFile(args[0], []byte(r), 0600); err != nil {
+		cmd.Println(err)
+		return
+	}
+	cmd.Printf("dumped regions to %s\n", args[0])
+}
+
+// NewRegionLoadCommand returns a command to restore the region cache from a
+// dump produced by "region dump", for rescue mode after etcd corruption has
+// left the normal region load path unusable.
+func NewRegionLoadCommand() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "load <file>",
+		Short: "restore the in-memory region cache from a dump",
+		Run:   regionLoadCommandFunc,
+	}
+	c.Flags().Bool("force", false, "confirm this destructive, cluster-must-be-stopped operation")
+	return c
+}
+
+func regionLoadCommandFunc(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		cmd.Println(cmd.UsageString())
+		return
+	}
+	force, _ := cmd.Flags().GetBool("force")
+	if !force {
+		cmd.Println(errors.New("refusing to restore regions without --force: this overwrites the in-memory region cache and only works while the cluster is stopped"))
+		return
+	}
+
+	data, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	// RaftCluster.RestoreRegionsFromDump enforces the "cluster must be
+	// stopped" rule itself and refuses regardless of --force; --force here
+	// only gates this command's own willingness to send a destructive
+	// request at all. The dump is binary, so it travels as a base64 string
+	// field rather than a raw body, the same way every other command in
+	// this package sends its POST bodies through postJSON's
+	// map[string]interface{} shape.
+	postJSON(cmd, regionsLoadPrefix, map[string]interface{}{
+		"data": base64.StdEncoding.EncodeToString(data),
+	})
+}